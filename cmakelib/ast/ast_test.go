@@ -234,6 +234,27 @@ func TestQuotedArgument(t *testing.T) {
 	}
 }
 
+func TestQuotedEvaluation(t *testing.T) {
+	tests := map[string]string{
+		`"a\"b"`:             `a"b`,
+		`"line\nbreak"`:      "line\nbreak",
+		`"tab\tand\rreturn"`: "tab\tand\rreturn",
+		`"back\\slash"`:      `back\slash`,
+		`"\${LITERAL}"`:      "${LITERAL}",
+		`"a\;b"`:             `a\;b`,
+		`"${VAR}\n"`:         "C:\\new\n",
+	}
+	vars := binder{"VAR": `C:\new`}
+	for input, expected := range tests {
+		root, err := parseQuotedArgument(input)
+		if err != nil {
+			t.Errorf("Error parsing %#v: %s", input, err)
+		} else if diff := cmp.Diff([]string{expected}, root.Eval(vars)); diff != "" {
+			t.Errorf("Unexpected evaluation %#v:\n%s", input, diff)
+		}
+	}
+}
+
 func TestArgumentList(t *testing.T) {
 	tests := map[string]ArgumentList{
 		`()`:             {},
@@ -62,15 +62,22 @@ func (a *QuotedArgument) Eval(vars Bindings) []string {
 	for _, e := range a.Elements {
 		parts = append(parts, e.Eval(vars)...)
 	}
-	return []string{replaceEscapes(strings.Join(parts, ""))}
+	return []string{strings.Join(parts, "")}
 }
 
 // Eval returns a slice of values after resolving variable references using vars.
+// Escape sequences are replaced only in literal text, not in the values of variables.
+// As in CMake, an escaped semicolon within a quoted argument encodes itself.
 func (e *QuotedElement) Eval(vars Bindings) []string {
 	if e.Ref != nil {
 		return e.Ref.Eval(vars)
 	}
-	return []string{e.Text}
+	return []string{escapePattern.ReplaceAllStringFunc(e.Text, func(m string) string {
+		if m == `\;` {
+			return m
+		}
+		return replaceEscapes(m)
+	})}
 }
 
 // Eval returns a slice of argument values after resolving variable references from vars.
@@ -0,0 +1,269 @@
+/*
+ * Copyright 2019 The Kythe Authors. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generate
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"bitbucket.org/creachadair/stringset"
+	"github.com/kythe/llvmbzlgen/cmakelib/ast"
+	"github.com/kythe/llvmbzlgen/writer"
+)
+
+// conditionPredicates maps the unary predicates of CMake conditions to the ctx helper which evaluates them.
+var conditionPredicates = map[string]string{
+	"COMMAND": "command",
+	"DEFINED": "defined",
+	"EXISTS":  "exists",
+	"POLICY":  "policy",
+	"TARGET":  "target",
+}
+
+// conditionComparisons maps the binary comparison operators of CMake conditions to the ctx helper
+// which evaluates them. As each operand may be a variable or a string, and numbers, strings and
+// versions are compared differently, none are translated to Starlark operators.
+var conditionComparisons = map[string]string{
+	"LESS":                  "less",
+	"GREATER":               "greater",
+	"EQUAL":                 "equal",
+	"LESS_EQUAL":            "less_equal",
+	"GREATER_EQUAL":         "greater_equal",
+	"STRLESS":               "str_less",
+	"STRGREATER":            "str_greater",
+	"STREQUAL":              "str_equal",
+	"STRLESS_EQUAL":         "str_less_equal",
+	"STRGREATER_EQUAL":      "str_greater_equal",
+	"VERSION_LESS":          "version_less",
+	"VERSION_GREATER":       "version_greater",
+	"VERSION_EQUAL":         "version_equal",
+	"VERSION_LESS_EQUAL":    "version_less_equal",
+	"VERSION_GREATER_EQUAL": "version_greater_equal",
+	"PATH_EQUAL":            "path_equal",
+	"MATCHES":               "matches",
+	"IN_LIST":               "in_list",
+	"IS_NEWER_THAN":         "is_newer_than",
+}
+
+// TranslateCondition translates the evaluated arguments of a CMake if() or elseif()
+// command into an equivalent Starlark expression, following the precedence rules of
+// https://cmake.org/cmake/help/latest/command/if.html#condition-syntax
+// Constants are translated to True or False, while predicates and variables are
+// evaluated using ctx helpers, e.g. DEFINED FOO becomes ctx.defined(ctx, "FOO")
+// and A VERSION_LESS 3.1 becomes ctx.version_less(ctx, "A", "3.1").
+func TranslateCondition(args []string) (writer.Expr, error) {
+	return translateCondition(args, nil, defaultContextName)
+}
+
+// translateCondition is like TranslateCondition, but translates references to the
+// variables declared by option() as ctx.option(ctx, "NAME"), and calls the helpers
+// of the context named ctx.
+func translateCondition(args []string, options stringset.Set, ctx string) (writer.Expr, error) {
+	p := &conditionParser{args: args, options: options, ctx: ctx}
+	x, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, fmt.Errorf("unexpected argument in condition: %s", p.peek())
+	}
+	return x, nil
+}
+
+// conditionParser is a recursive descent parser for the arguments of a CMake condition.
+type conditionParser struct {
+	args    []string
+	pos     int
+	options stringset.Set // Variables declared by option().
+	ctx     string        // The name of the context variable.
+}
+
+func (p *conditionParser) done() bool {
+	return p.pos >= len(p.args)
+}
+
+// peek returns the next argument without consuming it, or "" if there are none.
+func (p *conditionParser) peek() string {
+	if p.done() {
+		return ""
+	}
+	return p.args[p.pos]
+}
+
+func (p *conditionParser) next() string {
+	arg := p.peek()
+	p.pos++
+	return arg
+}
+
+func (p *conditionParser) parseOr() (writer.Expr, error) {
+	x, err := p.parseAnd()
+	for err == nil && !p.done() && p.peek() == "OR" {
+		p.next()
+		var y writer.Expr
+		if y, err = p.parseAnd(); err == nil {
+			x = writer.BinOp{Op: "or", X: x, Y: y}
+		}
+	}
+	return x, err
+}
+
+func (p *conditionParser) parseAnd() (writer.Expr, error) {
+	x, err := p.parseNot()
+	for err == nil && !p.done() && p.peek() == "AND" {
+		p.next()
+		var y writer.Expr
+		if y, err = p.parseNot(); err == nil {
+			x = writer.BinOp{Op: "and", X: x, Y: y}
+		}
+	}
+	return x, err
+}
+
+func (p *conditionParser) parseNot() (writer.Expr, error) {
+	if !p.done() && p.peek() == "NOT" {
+		p.next()
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return writer.UnaryOp{Op: "not", X: x}, nil
+	}
+	return p.parseUnary()
+}
+
+func (p *conditionParser) parseUnary() (writer.Expr, error) {
+	if p.done() {
+		return nil, errors.New("missing operand in condition")
+	}
+	arg := p.next()
+	if arg == "(" {
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, errors.New("unbalanced parentheses in condition")
+		}
+		return x, nil
+	}
+	if helper, ok := conditionPredicates[arg]; ok {
+		if p.done() {
+			return nil, fmt.Errorf("missing operand to %s in condition", arg)
+		}
+		return ctxCall(p.ctx, helper, p.next()), nil
+	}
+	if helper, ok := conditionComparisons[p.peek()]; ok {
+		op := p.next()
+		if p.done() {
+			return nil, fmt.Errorf("missing operand to %s in condition", op)
+		}
+		return ctxCall(p.ctx, helper, arg, p.next()), nil
+	}
+	if isKeyword(arg) && !p.done() && !conditionTerminator(p.peek()) {
+		return nil, fmt.Errorf("unknown predicate in condition: %s", arg)
+	}
+	if isConstant(arg) {
+		return isTrue(arg), nil
+	}
+	if p.options.Contains(arg) {
+		return ctxCall(p.ctx, "option", arg), nil
+	}
+	return ctxCall(p.ctx, "is_true", arg), nil
+}
+
+// conditional translates the if block begun at cmds[i], including any elseif and else
+// branches, returning the index of the matching endif.
+// See https://cmake.org/cmake/help/latest/command/if.html
+func (g *generator) conditional(d *directory, cmds []ast.CommandInvocation, i int) (int, error) {
+	end := skipBlock(cmds, i, "if")
+	if end == len(cmds) {
+		return end, fmt.Errorf("%s: %s: if without matching endif", d.inputPath(), cmds[i].Pos)
+	}
+	d.conditionals++
+	defer func() { d.conditionals-- }()
+	start, depth := i, 0
+	for j := i + 1; j <= end; j++ {
+		switch name := strings.ToLower(cmds[j].Name); {
+		case j == end:
+		case name == "if":
+			depth++
+			continue
+		case name == "endif":
+			depth--
+			continue
+		case depth > 0 || (name != "elseif" && name != "else"):
+			continue
+		}
+		if err := g.beginBranch(d, &cmds[start]); err != nil {
+			return end, err
+		}
+		if err := g.translate(d, cmds[start+1:j]); err != nil {
+			return end, err
+		}
+		start = j
+	}
+	return end, d.w.EndIf()
+}
+
+// beginBranch begins the branch of an if block introduced by cmd, one of if, elseif or else.
+func (g *generator) beginBranch(d *directory, cmd *ast.CommandInvocation) error {
+	name := strings.ToLower(cmd.Name)
+	if name == "else" {
+		return d.w.Else()
+	}
+	cond, err := translateCondition(cmd.Arguments.Eval(g.v), g.options, g.contextName())
+	if err != nil {
+		return fmt.Errorf("%s: %s: %v", d.inputPath(), cmd.Pos, err)
+	}
+	if name == "if" {
+		return d.w.BeginIf(cond)
+	}
+	return d.w.ElseIf(cond)
+}
+
+// conditionTerminator reports whether arg ends an operand of a condition.
+func conditionTerminator(arg string) bool {
+	return arg == "AND" || arg == "OR" || arg == ")"
+}
+
+// isKeyword reports whether arg has the form of a CMake keyword: upper case letters and underscores.
+func isKeyword(arg string) bool {
+	return arg != "" && strings.Trim(arg, "ABCDEFGHIJKLMNOPQRSTUVWXYZ_") == ""
+}
+
+// isConstant reports whether value is a CMake constant, rather than a variable or string, following
+// https://cmake.org/cmake/help/latest/command/if.html#basic-expressions
+func isConstant(value string) bool {
+	upper := strings.ToUpper(value)
+	if trueConstants.Contains(upper) || falseConstants.Contains(upper) || strings.HasSuffix(upper, "-NOTFOUND") {
+		return true
+	}
+	_, err := strconv.ParseFloat(value, 64)
+	return err == nil
+}
+
+// ctxCall returns a call to the named helper of the context variable ctx with the given
+// arguments, following the context itself.
+func ctxCall(ctx, name string, args ...writer.Expr) writer.Call {
+	return writer.Call{
+		Func: writer.Attr{X: writer.Var(ctx), Name: name},
+		Args: append([]writer.Expr{writer.Var(ctx)}, args...),
+	}
+}
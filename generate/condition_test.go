@@ -0,0 +1,79 @@
+/*
+ * Copyright 2019 The Kythe Authors. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generate
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kythe/llvmbzlgen/writer"
+)
+
+func TestTranslateCondition(t *testing.T) {
+	tests := []struct {
+		args     string
+		expected string
+	}{
+		{"ON", "True"},
+		{"0", "False"},
+		{"FOO-NOTFOUND", "False"},
+		{"FOO", `ctx.is_true(ctx, "FOO")`},
+		{"DEFINED FOO", `ctx.defined(ctx, "FOO")`},
+		{"NOT EXISTS path/to/file", `not ctx.exists(ctx, "path/to/file")`},
+		{"TARGET lib AND COMMAND llvm_add_library", `ctx.target(ctx, "lib") and ctx.command(ctx, "llvm_add_library")`},
+		{"POLICY CMP0077 OR NOT DEFINED FOO", `ctx.policy(ctx, "CMP0077") or (not ctx.defined(ctx, "FOO"))`},
+		{"NOT ( A OR B ) AND C", `(not (ctx.is_true(ctx, "A") or ctx.is_true(ctx, "B"))) and ctx.is_true(ctx, "C")`},
+		{"A OR B AND C", `ctx.is_true(ctx, "A") or (ctx.is_true(ctx, "B") and ctx.is_true(ctx, "C"))`},
+		{"3.0 VERSION_LESS 3.1", `ctx.version_less(ctx, "3.0", "3.1")`},
+		{"a STREQUAL b", `ctx.str_equal(ctx, "a", "b")`},
+		{"FOO LESS_EQUAL 2", `ctx.less_equal(ctx, "FOO", "2")`},
+		{"NOT CMAKE_SYSTEM_NAME MATCHES Linux.* AND lib IN_LIST LIBS", `(not ctx.matches(ctx, "CMAKE_SYSTEM_NAME", "Linux.*")) and ctx.in_list(ctx, "lib", "LIBS")`},
+		{"DEFINED FOO AND FOO VERSION_GREATER_EQUAL 1.2", `ctx.defined(ctx, "FOO") and ctx.version_greater_equal(ctx, "FOO", "1.2")`},
+	}
+	for _, test := range tests {
+		x, err := TranslateCondition(strings.Fields(test.args))
+		if err != nil {
+			t.Errorf("Unexpected error translating %q: %v", test.args, err)
+			continue
+		}
+		actual, err := writer.Marshal(x)
+		if err != nil {
+			t.Errorf("Unexpected error marshaling %q: %v", test.args, err)
+		} else if string(actual) != test.expected {
+			t.Errorf("TranslateCondition(%q): expected %#v but got %#v", test.args, test.expected, string(actual))
+		}
+	}
+}
+
+func TestTranslateConditionInvalid(t *testing.T) {
+	tests := map[string]string{
+		"":                "missing operand in condition",
+		"DEFINED":         "missing operand to DEFINED in condition",
+		"IS_FROB foo":     "unknown predicate in condition: IS_FROB",
+		"NOT":             "missing operand in condition",
+		"( A OR B":        "unbalanced parentheses in condition",
+		"a b":             "unexpected argument in condition: b",
+		"DEFINED FOO BAR": "unexpected argument in condition: BAR",
+		"a STREQUAL":      "missing operand to STREQUAL in condition",
+		"STREQUAL b":      "unknown predicate in condition: STREQUAL",
+	}
+	for args, expected := range tests {
+		if _, err := TranslateCondition(strings.Fields(args)); err == nil || err.Error() != expected {
+			t.Errorf("TranslateCondition(%q): expected error %q but got %v", args, expected, err)
+		}
+	}
+}
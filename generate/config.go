@@ -0,0 +1,87 @@
+/*
+ * Copyright 2019 The Kythe Authors. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generate
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"bitbucket.org/creachadair/stringset"
+	"github.com/kythe/llvmbzlgen/writer"
+)
+
+var (
+	trueConstants  = stringset.New("1", "ON", "YES", "TRUE", "Y")
+	falseConstants = stringset.New("0", "OFF", "NO", "FALSE", "N", "IGNORE", "NOTFOUND", "")
+)
+
+// option declares a boolean cache variable, following the rules of
+// https://cmake.org/cmake/help/latest/command/option.html
+// Options are recorded so that conditions on them may be translated as ctx.option,
+// and optionally declare a config_setting of the same name.
+func (g *generator) option(d *directory, args []string) error {
+	value := "OFF"
+	switch len(args) {
+	case 2:
+	case 3:
+		value = args[2]
+	default:
+		return fmt.Errorf("invalid arguments to option: %v", args)
+	}
+	if err := g.setCache(d, args[0], value, "BOOL"); err != nil {
+		return err
+	}
+	if g.options == nil {
+		g.options = stringset.New()
+	}
+	g.options.Add(args[0])
+	if !g.opts.OptionConfigSettings {
+		return nil
+	}
+	return d.w.WriteCommandKw("config_setting", map[string]interface{}{
+		"name":          args[0],
+		"define_values": map[string]string{args[0]: "ON"},
+	})
+}
+
+// setCache sets the value of a cache variable and writes a lookup of its configured value,
+// using the value as the default. The default is written as a bool for BOOL variables
+// and as a string for all other types.
+func (g *generator) setCache(d *directory, key, value, kind string) error {
+	g.v.SetCache(key, value)
+	var def interface{} = value
+	if kind == "BOOL" {
+		def = isTrue(value)
+	}
+	return d.w.WriteAssignment(writer.SanitizeIdent(key), ctxCall(g.contextName(), "config", key, def))
+}
+
+// isTrue reports whether value is a true constant, following the rules of
+// https://cmake.org/cmake/help/latest/command/if.html#basic-expressions
+// Values which are not constants are considered false.
+func isTrue(value string) bool {
+	upper := strings.ToUpper(value)
+	switch {
+	case trueConstants.Contains(upper):
+		return true
+	case falseConstants.Contains(upper) || strings.HasSuffix(upper, "-NOTFOUND"):
+		return false
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	return err == nil && n != 0
+}
@@ -0,0 +1,112 @@
+/*
+ * Copyright 2019 The Kythe Authors. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generate
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCacheVariables(t *testing.T) {
+	actual := generateRoot(t, "set(FOO ON CACHE BOOL \"Enable foo\")\n"+
+		"set(DISABLED 0 CACHE BOOL \"\" FORCE)\n"+
+		"set(TRIPLE x86_64 linux CACHE STRING \"Target triple\")\n"+
+		"option(BAR \"Enable bar\" OFF)\n"+
+		"option(BAZ \"Enable baz\")\n"+
+		"set(PLAIN a b)\n"+
+		"add_library(lib ${TRIPLE} ${PLAIN})\n")
+	expected := "def generated_cmake_targets(ctx):\n" +
+		"    FOO = ctx.config(ctx, \"FOO\", True)\n" +
+		"    DISABLED = ctx.config(ctx, \"DISABLED\", False)\n" +
+		"    TRIPLE = ctx.config(ctx, \"TRIPLE\", \"x86_64;linux\")\n" +
+		"    BAR = ctx.config(ctx, \"BAR\", False)\n" +
+		"    BAZ = ctx.config(ctx, \"BAZ\", False)\n" +
+		"    ctx.cc_library(ctx, name = \"lib\", srcs = [\"x86_64\", \"linux\", \"a\", \"b\"])\n" +
+		"    return ctx\n"
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Error("Unexpected output:\n", diff)
+	}
+}
+
+func TestIsTrue(t *testing.T) {
+	for value, expected := range map[string]bool{
+		"ON": true, "yes": true, "1": true, "2.5": true, "True": true,
+		"OFF": false, "no": false, "0": false, "": false, "FOO-NOTFOUND": false, "bar": false,
+	} {
+		if actual := isTrue(value); actual != expected {
+			t.Errorf("isTrue(%q) = %v, expected %v", value, actual, expected)
+		}
+	}
+}
+
+func TestOptionConditions(t *testing.T) {
+	in := fixture(map[string]string{
+		"CMakeLists.txt": "option(ENABLE_X \"Enable x\" ON)\n" +
+			"if(ENABLE_X AND NOT OTHER)\n" +
+			"  run(x)\n" +
+			"elseif(NOT ENABLE_X)\n" +
+			"  if(ENABLE_X)\n" +
+			"  endif()\n" +
+			"  add_library(lib lib.cc)\n" +
+			"else()\n" +
+			"  run(other)\n" +
+			"endif()\n",
+	})
+	out := memFS{}
+	if _, err := Generate(in, out, Options{OptionConditions: true, OptionConfigSettings: true}); err != nil {
+		t.Fatal("Unexpected error generating files: ", err)
+	}
+	expected := "def generated_cmake_targets(ctx):\n" +
+		"    ENABLE_X = ctx.config(ctx, \"ENABLE_X\", True)\n" +
+		"    ctx.config_setting(ctx, define_values = {\"ENABLE_X\": \"ON\"}, name = \"ENABLE_X\")\n" +
+		"    if ctx.option(ctx, \"ENABLE_X\") and (not ctx.is_true(ctx, \"OTHER\")):\n" +
+		"        ctx.run(ctx, \"x\")\n" +
+		"    elif not ctx.option(ctx, \"ENABLE_X\"):\n" +
+		"        if ctx.option(ctx, \"ENABLE_X\"):\n" +
+		"            pass\n" +
+		"        ctx.add_library(ctx, \"lib\", \"lib.cc\")\n" +
+		"    else:\n" +
+		"        ctx.run(ctx, \"other\")\n" +
+		"    return ctx\n"
+	if diff := cmp.Diff(expected, out["CMakeLists.bzl"]); diff != "" {
+		t.Error("Unexpected output:\n", diff)
+	}
+}
+
+func TestContextName(t *testing.T) {
+	in := fixture(map[string]string{
+		"CMakeLists.txt": "set(FOO ON CACHE BOOL \"Enable foo\")\n" +
+			"option(ENABLE_X \"Enable x\" ON)\n" +
+			"if(ENABLE_X AND ARCH STREQUAL x86)\n" +
+			"  run(x)\n" +
+			"endif()\n",
+	})
+	out := memFS{}
+	if _, err := Generate(in, out, Options{OptionConditions: true, ContextName: "cfg"}); err != nil {
+		t.Fatal("Unexpected error generating files: ", err)
+	}
+	expected := "def generated_cmake_targets(cfg):\n" +
+		"    FOO = cfg.config(cfg, \"FOO\", True)\n" +
+		"    ENABLE_X = cfg.config(cfg, \"ENABLE_X\", True)\n" +
+		"    if cfg.option(cfg, \"ENABLE_X\") and cfg.str_equal(cfg, \"ARCH\", \"x86\"):\n" +
+		"        cfg.run(cfg, \"x\")\n" +
+		"    return cfg\n"
+	if diff := cmp.Diff(expected, out["CMakeLists.bzl"]); diff != "" {
+		t.Error("Unexpected output:\n", diff)
+	}
+}
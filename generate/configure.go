@@ -0,0 +1,71 @@
+/*
+ * Copyright 2019 The Kythe Authors. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generate
+
+import (
+	"fmt"
+
+	"bitbucket.org/creachadair/stringset"
+)
+
+// configureFlags maps the flags of configure_file to the keyword argument enabling them.
+var configureFlags = map[string]string{
+	"@ONLY":         "only",
+	"COPYONLY":      "copy_only",
+	"ESCAPE_QUOTES": "escape_quotes",
+}
+
+// configurePermissions are the options of configure_file which affect only the file permissions, which are ignored.
+var configurePermissions = stringset.New("NO_SOURCE_PERMISSIONS", "USE_SOURCE_PERMISSIONS", "FILE_PERMISSIONS")
+
+// configureFile translates configure_file into a call to ctx.configure_file, leaving
+// the substitution of variables in the input to the implementation of ctx.
+// See https://cmake.org/cmake/help/latest/command/configure_file.html
+func (g *generator) configureFile(d *directory, args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("missing required input and output arguments to configure_file")
+	}
+	kwargs := make(map[string]interface{})
+	for i := 2; i < len(args); i++ {
+		switch arg := args[i]; {
+		case configureFlags[arg] != "":
+			kwargs[configureFlags[arg]] = true
+		case arg == "NEWLINE_STYLE":
+			if i+1 == len(args) {
+				return fmt.Errorf("missing required argument to configure_file NEWLINE_STYLE")
+			}
+			i++
+			kwargs["newline_style"] = args[i]
+		case configurePermissions.Contains(arg):
+			// FILE_PERMISSIONS is followed by a list of permissions, which are similarly ignored.
+			for arg == "FILE_PERMISSIONS" && i+1 < len(args) && !isConfigureOption(args[i+1]) {
+				i++
+			}
+		default:
+			return fmt.Errorf("unexpected argument to configure_file: %s", arg)
+		}
+	}
+	if kwargs["only"] != nil && kwargs["copy_only"] != nil {
+		return fmt.Errorf("configure_file @ONLY and COPYONLY are mutually exclusive")
+	}
+	return d.w.WriteCommandKw("configure_file", kwargs, args[0], args[1])
+}
+
+// isConfigureOption reports whether arg is one of the options of configure_file.
+func isConfigureOption(arg string) bool {
+	return configureFlags[arg] != "" || arg == "NEWLINE_STYLE" || configurePermissions.Contains(arg)
+}
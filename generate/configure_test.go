@@ -0,0 +1,52 @@
+/*
+ * Copyright 2019 The Kythe Authors. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generate
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestConfigureFile(t *testing.T) {
+	actual := generateRoot(t, "configure_file(config.h.cmake config.h @ONLY)\n"+
+		"configure_file(data.in data COPYONLY)\n"+
+		"configure_file(plain.in plain)\n"+
+		"configure_file(script.in script ESCAPE_QUOTES NEWLINE_STYLE UNIX FILE_PERMISSIONS OWNER_READ OWNER_EXECUTE @ONLY)\n")
+	expected := "def generated_cmake_targets(ctx):\n" +
+		"    ctx.configure_file(ctx, \"config.h.cmake\", \"config.h\", only = True)\n" +
+		"    ctx.configure_file(ctx, \"data.in\", \"data\", copy_only = True)\n" +
+		"    ctx.configure_file(ctx, \"plain.in\", \"plain\")\n" +
+		"    ctx.configure_file(ctx, \"script.in\", \"script\", escape_quotes = True, newline_style = \"UNIX\", only = True)\n" +
+		"    return ctx\n"
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Error("Unexpected output:\n", diff)
+	}
+}
+
+func TestInvalidConfigureFile(t *testing.T) {
+	for _, input := range []string{
+		"configure_file(in)\n",
+		"configure_file(in out UNKNOWN)\n",
+		"configure_file(in out NEWLINE_STYLE)\n",
+		"configure_file(in out @ONLY COPYONLY)\n",
+	} {
+		if _, err := Generate(fixture(map[string]string{"CMakeLists.txt": input}), memFS{}, Options{}); err == nil {
+			t.Errorf("Invalid configure_file accepted: %s", input)
+		}
+	}
+}
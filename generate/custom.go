@@ -0,0 +1,155 @@
+/*
+ * Copyright 2019 The Kythe Authors. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generate
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"bitbucket.org/creachadair/stringset"
+)
+
+// customKeywords are the keywords of add_custom_command and add_custom_target,
+// each of which begins a new group of arguments.
+var customKeywords = stringset.New(
+	"OUTPUT", "COMMAND", "ARGS", "MAIN_DEPENDENCY", "DEPENDS", "BYPRODUCTS", "IMPLICIT_DEPENDS",
+	"WORKING_DIRECTORY", "COMMENT", "DEPFILE", "JOB_POOL", "JOB_SERVER_AWARE", "VERBATIM", "APPEND",
+	"USES_TERMINAL", "COMMAND_EXPAND_LISTS", "DEPENDS_EXPLICIT_ONLY", "CODEGEN", "ALL", "SOURCES",
+	"TARGET", "PRE_BUILD", "PRE_LINK", "POST_BUILD",
+)
+
+// shellSafePattern matches words which need not be quoted in a shell command.
+var shellSafePattern = regexp.MustCompile(`^[a-zA-Z0-9_@%+=:,./-]+$`)
+
+// customArgs are the parsed arguments to add_custom_command or add_custom_target.
+type customArgs struct {
+	outputs  []string
+	commands []string // Each COMMAND, with its words joined into a shell command.
+	depends  []string
+	workDir  string
+}
+
+// kwargs returns the keyword arguments with which to write the genrule, omitting empty attributes.
+func (ca *customArgs) kwargs() map[string]interface{} {
+	kwargs := make(map[string]interface{})
+	if len(ca.outputs) > 0 {
+		kwargs["outs"] = ca.outputs
+	}
+	if len(ca.commands) > 0 {
+		kwargs["cmd"] = strings.Join(ca.commands, " && ")
+	}
+	if len(ca.depends) > 0 {
+		kwargs["srcs"] = ca.depends
+	}
+	if ca.workDir != "" {
+		kwargs["working_directory"] = ca.workDir
+	}
+	return kwargs
+}
+
+// parseCustomArgs parses the keyword groups of add_custom_command or add_custom_target,
+// returning false if any group is not translated. VERBATIM is accepted, as the words
+// of each command are always quoted as necessary, while ALL is accepted only for targets.
+func parseCustomArgs(args []string, target bool) (*customArgs, bool) {
+	ca := &customArgs{}
+	var group string
+	var words []string
+	endCommand := func() {
+		if len(words) > 0 {
+			ca.commands = append(ca.commands, shellJoin(words))
+		}
+		words = nil
+	}
+	for _, arg := range args {
+		if customKeywords.Contains(arg) {
+			endCommand()
+			switch arg {
+			case "OUTPUT", "COMMAND", "DEPENDS", "WORKING_DIRECTORY":
+				group = arg
+			case "VERBATIM":
+				group = ""
+			case "ALL":
+				if !target {
+					return nil, false
+				}
+				group = ""
+			default:
+				return nil, false
+			}
+			continue
+		}
+		switch group {
+		case "OUTPUT":
+			ca.outputs = append(ca.outputs, arg)
+		case "COMMAND":
+			words = append(words, arg)
+		case "DEPENDS":
+			ca.depends = append(ca.depends, arg)
+		case "WORKING_DIRECTORY":
+			if ca.workDir != "" {
+				return nil, false
+			}
+			ca.workDir = arg
+		default:
+			return nil, false
+		}
+	}
+	endCommand()
+	return ca, target || (len(ca.outputs) > 0 && len(ca.commands) > 0)
+}
+
+// shellJoin joins words into a shell command, quoting those containing special characters.
+func shellJoin(words []string) string {
+	quoted := make([]string, len(words))
+	for i, w := range words {
+		if shellSafePattern.MatchString(w) {
+			quoted[i] = w
+		} else {
+			quoted[i] = "'" + strings.Replace(w, "'", `'\''`, -1) + "'"
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+// addCustomCommand translates the OUTPUT signature of add_custom_command into a call to ctx.genrule.
+// Other signatures, and those using keywords without a translation, are passed to the unmapped command path.
+// See https://cmake.org/cmake/help/latest/command/add_custom_command.html
+func (g *generator) addCustomCommand(d *directory, args []string) error {
+	ca, ok := parseCustomArgs(args, false)
+	if !ok {
+		return g.unmapped(d, "add_custom_command", args)
+	}
+	d.generated.Add(ca.outputs...)
+	return d.w.WriteCommandKw("genrule", ca.kwargs())
+}
+
+// addCustomTarget translates add_custom_target into a call to ctx.genrule named for the target.
+// Targets using keywords without a translation are passed to the unmapped command path.
+// See https://cmake.org/cmake/help/latest/command/add_custom_target.html
+func (g *generator) addCustomTarget(d *directory, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing required target name argument to add_custom_target")
+	}
+	ca, ok := parseCustomArgs(args[1:], true)
+	if !ok {
+		return g.unmapped(d, "add_custom_target", args)
+	}
+	kwargs := ca.kwargs()
+	kwargs["name"] = args[0]
+	return d.w.WriteCommandKw("genrule", kwargs)
+}
@@ -0,0 +1,68 @@
+/*
+ * Copyright 2019 The Kythe Authors. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generate
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAddCustomCommand(t *testing.T) {
+	actual := generateRoot(t, "set(TBLGEN llvm-tblgen)\n"+
+		"add_custom_command(OUTPUT Attrs.inc Attrs.h\n"+
+		"  COMMAND ${TBLGEN} -gen-attrs Attrs.td -o \"out dir/Attrs.inc\"\n"+
+		"  COMMAND touch Attrs.h\n"+
+		"  DEPENDS Attrs.td ${TBLGEN}\n"+
+		"  WORKING_DIRECTORY gen\n"+
+		"  VERBATIM)\n"+
+		"add_custom_target(attrs ALL DEPENDS Attrs.inc)\n"+
+		"add_custom_command(OUTPUT a COMMAND b COMMENT \"Generating a\")\n"+
+		"add_custom_command(TARGET attrs POST_BUILD COMMAND b)\n")
+	expected := "def generated_cmake_targets(ctx):\n" +
+		"    ctx.genrule(ctx, cmd = \"llvm-tblgen -gen-attrs Attrs.td -o 'out dir/Attrs.inc' && touch Attrs.h\", " +
+		"outs = [\"Attrs.inc\", \"Attrs.h\"], srcs = [\"Attrs.td\", \"llvm-tblgen\"], working_directory = \"gen\")\n" +
+		"    ctx.genrule(ctx, name = \"attrs\", srcs = [\"Attrs.inc\"])\n" +
+		"    ctx.add_custom_command(ctx, \"OUTPUT\", \"a\", \"COMMAND\", \"b\", \"COMMENT\", \"Generating a\")\n" +
+		"    ctx.add_custom_command(ctx, \"TARGET\", \"attrs\", \"POST_BUILD\", \"COMMAND\", \"b\")\n" +
+		"    return ctx\n"
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Error("Unexpected output:\n", diff)
+	}
+}
+
+func TestShellJoin(t *testing.T) {
+	tests := []struct {
+		words    []string
+		expected string
+	}{
+		{[]string{"echo", "a"}, "echo a"},
+		{[]string{"echo", "a b", ""}, "echo 'a b' ''"},
+		{[]string{"echo", "it's", "$HOME"}, `echo 'it'\''s' '$HOME'`},
+	}
+	for _, test := range tests {
+		if actual := shellJoin(test.words); actual != test.expected {
+			t.Errorf("Expected %#v but got %#v", test.expected, actual)
+		}
+	}
+}
+
+func TestInvalidAddCustomTarget(t *testing.T) {
+	if _, err := Generate(fixture(map[string]string{"CMakeLists.txt": "add_custom_target()\n"}), memFS{}, Options{}); err == nil {
+		t.Error("add_custom_target without a name accepted")
+	}
+}
@@ -0,0 +1,70 @@
+/*
+ * Copyright 2019 The Kythe Authors. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generate
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"bitbucket.org/creachadair/stringset"
+	"github.com/kythe/llvmbzlgen/writer"
+)
+
+// globFlags are the options of file(GLOB) and file(GLOB_RECURSE) which do not affect the
+// files matched, and are ignored.
+var globFlags = stringset.New("CONFIGURE_DEPENDS", "FOLLOW_SYMLINKS")
+
+// fileCommand translates the GLOB and GLOB_RECURSE subcommands of file() into an assignment
+// of a glob to the output variable, passing any others to the unmapped command path.
+// See https://cmake.org/cmake/help/latest/command/file.html#glob
+func (g *generator) fileCommand(d *directory, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing required subcommand argument to file")
+	}
+	mode := args[0]
+	if mode != "GLOB" && mode != "GLOB_RECURSE" {
+		return g.unmapped(d, "file", args)
+	}
+	if len(args) < 2 {
+		return fmt.Errorf("missing required output variable argument to file(%s)", mode)
+	}
+	out := args[1]
+	var patterns []string
+	for i := 2; i < len(args); i++ {
+		switch arg := args[i]; {
+		case globFlags.Contains(arg):
+		case arg == "LIST_DIRECTORIES":
+			i++
+		case arg == "RELATIVE" || path.IsAbs(arg) || strings.HasPrefix(arg, "../"):
+			// Globs outside of the package, or relative to another directory, have no translation.
+			return g.unmapped(d, "file", args)
+		case mode == "GLOB_RECURSE":
+			dir, base := path.Split(arg)
+			patterns = append(patterns, dir+"**/"+base)
+		default:
+			patterns = append(patterns, arg)
+		}
+	}
+	// The files matched are known only when the glob is evaluated, so later references
+	// must refer to the Starlark variable.
+	ident := writer.SanitizeIdent(out)
+	g.v.Set(out, listVarValue(ident))
+	d.lists.Add(out)
+	// CMake globs which match no files produce an empty list, rather than failing.
+	return d.w.WriteAssignment(ident, writer.Glob{Include: patterns, AllowEmpty: true})
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright 2019 The Kythe Authors. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generate
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFileGlob(t *testing.T) {
+	actual := generateRoot(t, "file(GLOB SRCS *.cc lib/*.c)\n"+
+		"file(GLOB_RECURSE HDRS CONFIGURE_DEPENDS LIST_DIRECTORIES false *.h include/*.inc)\n"+
+		"list(APPEND SRCS extra.cc)\n"+
+		"run(${HDRS})\n")
+	expected := "def generated_cmake_targets(ctx):\n" +
+		"    SRCS = glob([\"*.cc\", \"lib/*.c\"], allow_empty = True)\n" +
+		"    HDRS = glob([\"**/*.h\", \"include/**/*.inc\"], allow_empty = True)\n" +
+		"    SRCS = SRCS + [\"extra.cc\"]\n" +
+		"    ctx.run(ctx, HDRS)\n" +
+		"    return ctx\n"
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Error("Unexpected output:\n", diff)
+	}
+}
+
+func TestFileUnmapped(t *testing.T) {
+	actual := generateRoot(t, "file(READ VERSION.txt CONTENTS)\n"+
+		"file(GLOB SRCS RELATIVE /src *.cc)\n"+
+		"file(GLOB SRCS ../*.cc)\n")
+	expected := "def generated_cmake_targets(ctx):\n" +
+		"    ctx.file(ctx, \"READ\", \"VERSION.txt\", \"CONTENTS\")\n" +
+		"    ctx.file(ctx, \"GLOB\", \"SRCS\", \"RELATIVE\", \"/src\", \"*.cc\")\n" +
+		"    ctx.file(ctx, \"GLOB\", \"SRCS\", \"../*.cc\")\n" +
+		"    return ctx\n"
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Error("Unexpected output:\n", diff)
+	}
+	if _, err := Generate(fixture(map[string]string{"CMakeLists.txt": "file(GLOB)\n"}), memFS{}, Options{}); err == nil {
+		t.Error("file(GLOB) without an output variable accepted")
+	}
+}
+
+func TestFileGlobTargets(t *testing.T) {
+	actual := generateRoot(t, "file(GLOB SRCS *.cc)\n"+
+		"file(GLOB HDRS *.h)\n"+
+		"add_library(root ${SRCS})\n"+
+		"add_library(mixed main.cc ${SRCS} extra.cc)\n"+
+		"list(APPEND HDRS config.h)\n"+
+		"add_executable(tool tool.cc ${HDRS})\n"+
+		"list(LENGTH SRCS COUNT)\n"+
+		"list(GET SRCS 5 FIRST)\n"+
+		"run(${COUNT} ${FIRST} prefix-${SRCS})\n")
+	expected := "def generated_cmake_targets(ctx):\n" +
+		"    SRCS = glob([\"*.cc\"], allow_empty = True)\n" +
+		"    HDRS = glob([\"*.h\"], allow_empty = True)\n" +
+		"    HDRS = HDRS + [\"config.h\"]\n" +
+		"    COUNT = len(SRCS)\n" +
+		"    FIRST = SRCS[5]\n" +
+		"    ctx.run(ctx, COUNT, FIRST, (\"prefix-\" + \";\".join(SRCS)))\n" +
+		"    ctx.cc_library(ctx, name = \"root\", srcs = SRCS)\n" +
+		"    ctx.cc_library(ctx, name = \"mixed\", srcs = ([\"main.cc\"] + SRCS) + [\"extra.cc\"])\n" +
+		"    ctx.cc_binary(ctx, name = \"tool\", srcs = [\"tool.cc\"] + HDRS)\n" +
+		"    return ctx\n"
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Error("Unexpected output:\n", diff)
+	}
+}
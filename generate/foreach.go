@@ -0,0 +1,228 @@
+/*
+ * Copyright 2019 The Kythe Authors. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generate
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"bitbucket.org/creachadair/stringset"
+	"github.com/kythe/llvmbzlgen/cmakelib/ast"
+	"github.com/kythe/llvmbzlgen/writer"
+)
+
+// loopCommands are the commands which are translated normally within the body of a loop,
+// or of a translated if block. Other commands are passed to the unmapped command path,
+// as their translations do not support references to the loop variable, and accumulate
+// targets which are written unconditionally.
+var loopCommands = stringset.New("list", "set", "string", "unset")
+
+// loopVarPattern matches the placeholder values bound to variables whose value is known only
+// when the generated Starlark is evaluated, such as foreach loop variables while translating
+// the loop body. Each refers to the Starlark variable of the given name, which is a list
+// for list placeholders and a string otherwise.
+var loopVarPattern = regexp.MustCompile("\x00(loop|list):([^\x00]*)\x00")
+
+// loopVarValue returns the placeholder value for the named loop variable.
+func loopVarValue(name string) string {
+	return "\x00loop:" + name + "\x00"
+}
+
+// listVarValue returns the placeholder value for the named Starlark list variable,
+// such as the result of a glob.
+func listVarValue(name string) string {
+	return "\x00list:" + name + "\x00"
+}
+
+// listRef returns the name of the Starlark list variable to which arg refers, if it consists
+// only of a list placeholder.
+func listRef(arg string) (string, bool) {
+	m := loopVarPattern.FindStringSubmatch(arg)
+	if m == nil || m[0] != arg || m[1] != "list" {
+		return "", false
+	}
+	return m[2], true
+}
+
+// isDeferred reports whether any of values refers to a variable known only when evaluated.
+func isDeferred(values ...string) bool {
+	for _, value := range values {
+		if loopVarPattern.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// foreach translates the foreach block beginning at cmds[i] into a Starlark for loop,
+// returning the index of the matching endforeach.
+// See https://cmake.org/cmake/help/latest/command/foreach.html
+func (g *generator) foreach(d *directory, cmds []ast.CommandInvocation, i int) (int, error) {
+	end := skipBlock(cmds, i, "foreach")
+	if end == len(cmds) {
+		return end, fmt.Errorf("%s: %s: foreach without matching endforeach", d.inputPath(), cmds[i].Pos)
+	}
+	name, iterable, err := parseForeachArgs(g.v, cmds[i].Arguments.Eval(g.v))
+	if err != nil {
+		return end, fmt.Errorf("%s: %s: %v", d.inputPath(), cmds[i].Pos, err)
+	}
+	ident := writer.SanitizeIdent(name)
+	if err := d.w.BeginFor(ident, iterable); err != nil {
+		return end, err
+	}
+	// Within the body, references to the loop variable refer to the Starlark variable.
+	saved := g.v.Get(name)
+	g.v.Set(name, loopVarValue(ident))
+	d.loops++
+	err = g.translate(d, cmds[i+1:end])
+	d.loops--
+	g.v.Set(name, saved)
+	if err != nil {
+		return end, err
+	}
+	return end, d.w.EndFor()
+}
+
+// parseForeachArgs returns the loop variable and Starlark iterable for the arguments to foreach,
+// which take one of the forms:
+// foreach(var items...),
+// foreach(var RANGE stop),
+// foreach(var RANGE start stop [step]) or
+// foreach(var IN [LISTS lists...] [ITEMS items...]).
+// Lists are dereferenced when translated, while ranges are inclusive of stop, as in CMake.
+func parseForeachArgs(v ast.Bindings, args []string) (string, writer.Expr, error) {
+	if len(args) == 0 {
+		return "", nil, fmt.Errorf("missing required loop variable argument to foreach")
+	}
+	name, args := args[0], args[1:]
+	if len(args) == 0 {
+		return name, []interface{}{}, nil
+	}
+	switch args[0] {
+	case "RANGE":
+		bounds := make([]int, len(args)-1)
+		for i, arg := range args[1:] {
+			n, err := strconv.Atoi(arg)
+			if err != nil {
+				return "", nil, fmt.Errorf("invalid foreach range bound: %s", arg)
+			}
+			bounds[i] = n
+		}
+		switch len(bounds) {
+		case 1:
+			return name, writer.Call{Func: writer.Var("range"), Args: []writer.Expr{bounds[0] + 1}}, nil
+		case 2:
+			return name, writer.Call{Func: writer.Var("range"), Args: []writer.Expr{bounds[0], bounds[1] + 1}}, nil
+		case 3:
+			return name, writer.Call{Func: writer.Var("range"), Args: []writer.Expr{bounds[0], bounds[1] + 1, bounds[2]}}, nil
+		default:
+			return "", nil, fmt.Errorf("invalid foreach range: %v", args[1:])
+		}
+	case "IN":
+		items := []string{}
+		mode := ""
+		for _, arg := range args[1:] {
+			switch {
+			case arg == "LISTS" || arg == "ITEMS":
+				mode = arg
+			case mode == "LISTS":
+				if value := v.Get(arg); value != "" {
+					items = append(items, strings.Split(value, ";")...)
+				}
+			case mode == "ITEMS":
+				items = append(items, arg)
+			default:
+				return "", nil, fmt.Errorf("unexpected argument to foreach: %s", arg)
+			}
+		}
+		return name, listExpr(items), nil
+	default:
+		return name, listExpr(args), nil
+	}
+}
+
+// argumentValues returns the values with which to write the evaluated arguments of a command,
+// replacing references to any enclosing loop variables with the Starlark variable.
+func argumentValues(args []string) []interface{} {
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = argumentValue(arg)
+	}
+	return values
+}
+
+// argumentValue returns arg as a string, or as a concatenation if it refers to loop variables.
+// An argument consisting only of a reference to a list variable is the list itself, while
+// lists referenced within a larger argument are joined with semicolons, as in CMake.
+func argumentValue(arg string) interface{} {
+	matches := loopVarPattern.FindAllStringSubmatchIndex(arg, -1)
+	if matches == nil {
+		return arg
+	}
+	var terms writer.Concat
+	last := 0
+	for _, m := range matches {
+		if m[0] > last {
+			terms = append(terms, arg[last:m[0]])
+		}
+		name := writer.Var(arg[m[4]:m[5]])
+		if arg[m[2]:m[3]] == "list" && (m[0] > 0 || m[1] < len(arg)) {
+			terms = append(terms, writer.Call{Func: writer.Attr{X: ";", Name: "join"}, Args: []writer.Expr{name}})
+		} else {
+			terms = append(terms, name)
+		}
+		last = m[1]
+	}
+	if last < len(arg) {
+		terms = append(terms, arg[last:])
+	}
+	if len(terms) == 1 {
+		return terms[0]
+	}
+	return terms
+}
+
+// listExpr returns the Starlark expression for the list of evaluated items, in which references to
+// list variables are concatenated with the lists of the surrounding items, e.g. ["a.cc"] + SRCS.
+func listExpr(items []string) writer.Expr {
+	var terms []writer.Expr
+	var elems []interface{}
+	for _, item := range items {
+		if name, ok := listRef(item); ok {
+			if elems != nil {
+				terms = append(terms, elems)
+				elems = nil
+			}
+			terms = append(terms, writer.Var(name))
+			continue
+		}
+		elems = append(elems, argumentValue(item))
+	}
+	if elems != nil || len(terms) == 0 {
+		if elems == nil {
+			elems = []interface{}{}
+		}
+		terms = append(terms, elems)
+	}
+	x := terms[0]
+	for _, y := range terms[1:] {
+		x = writer.BinOp{Op: "+", X: x, Y: y}
+	}
+	return x
+}
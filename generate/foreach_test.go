@@ -0,0 +1,111 @@
+/*
+ * Copyright 2019 The Kythe Authors. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generate
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestForeach(t *testing.T) {
+	tests := []struct {
+		loop     string
+		iterable string
+	}{
+		{"foreach(x a b c)", `["a", "b", "c"]`},
+		{"foreach(x)", `[]`},
+		{"foreach(x RANGE 3)", `range(4)`},
+		{"foreach(x RANGE 1 5)", `range(1, 6)`},
+		{"foreach(x RANGE 0 10 2)", `range(0, 11, 2)`},
+		{"foreach(x IN LISTS A B)", `["a1", "a2", "b1"]`},
+		{"foreach(x IN LISTS A EMPTY ITEMS c)", `["a1", "a2", "c"]`},
+		{"foreach(x IN ITEMS a b)", `["a", "b"]`},
+	}
+	for _, test := range tests {
+		actual := generateRoot(t, "set(A a1 a2)\n"+
+			"set(B b1)\n"+
+			test.loop+"\n"+
+			"  run(${x} lib/${x}.cc)\n"+
+			"endforeach()\n"+
+			"run(${x})\n")
+		expected := "def generated_cmake_targets(ctx):\n" +
+			"    for x in " + test.iterable + ":\n" +
+			"        ctx.run(ctx, x, (\"lib/\" + x + \".cc\"))\n" +
+			"    ctx.run(ctx, \"\")\n" +
+			"    return ctx\n"
+		if diff := cmp.Diff(expected, actual); diff != "" {
+			t.Errorf("Unexpected output for %s:\n%s", test.loop, diff)
+		}
+	}
+}
+
+func TestNestedForeach(t *testing.T) {
+	actual := generateRoot(t, "foreach(x a b)\n"+
+		"  foreach(y IN ITEMS ${x}1 c)\n"+
+		"    add_library(${x}_${y} ${y}.cc)\n"+
+		"  endforeach()\n"+
+		"endforeach()\n")
+	expected := "def generated_cmake_targets(ctx):\n" +
+		"    for x in [\"a\", \"b\"]:\n" +
+		"        for y in [(x + \"1\"), \"c\"]:\n" +
+		"            ctx.add_library(ctx, (x + \"_\" + y), (y + \".cc\"))\n" +
+		"    return ctx\n"
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Error("Unexpected output:\n", diff)
+	}
+}
+
+func TestInvalidForeach(t *testing.T) {
+	for _, input := range []string{
+		"foreach(x a b)\n",
+		"foreach(x RANGE a)\nendforeach()\n",
+		"foreach(x RANGE 1 2 3 4)\nendforeach()\n",
+		"foreach(x IN a)\nendforeach()\n",
+	} {
+		if _, err := Generate(fixture(map[string]string{"CMakeLists.txt": input}), memFS{}, Options{}); err == nil {
+			t.Errorf("Invalid foreach accepted: %q", input)
+		}
+	}
+}
+
+func TestForeachAssignment(t *testing.T) {
+	actual := generateRoot(t, "foreach(x a b)\n"+
+		"  set(SRC lib/${x}.cc)\n"+
+		"  set(SRCS ${x}.cc ${x}.h)\n"+
+		"  run(${SRC})\n"+
+		"endforeach()\n"+
+		"run(${SRC} ${SRCS})\n"+
+		"list(APPEND SRCS extra.cc)\n"+
+		"add_library(lib ${SRCS})\n")
+	expected := "def generated_cmake_targets(ctx):\n" +
+		"    for x in [\"a\", \"b\"]:\n" +
+		"        SRC = (\"lib/\" + x + \".cc\")\n" +
+		"        SRCS = [(x + \".cc\"), (x + \".h\")]\n" +
+		"        ctx.run(ctx, SRC)\n" +
+		"    ctx.run(ctx, SRC, SRCS)\n" +
+		"    SRCS = SRCS + [\"extra.cc\"]\n" +
+		"    ctx.cc_library(ctx, name = \"lib\", srcs = SRCS)\n" +
+		"    return ctx\n"
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Error("Unexpected output:\n", diff)
+	}
+	if strings.Contains(actual, "\x00") {
+		t.Errorf("Loop placeholder leaked into output:\n%s", actual)
+	}
+}
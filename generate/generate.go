@@ -0,0 +1,494 @@
+/*
+ * Copyright 2019 The Kythe Authors. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package generate implements a driver for translating a tree of CMakeLists.txt
+// files into Starlark macros, one .bzl file per directory.
+package generate
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"bitbucket.org/creachadair/stringset"
+	"github.com/kythe/llvmbzlgen/cmakelib/ast"
+	"github.com/kythe/llvmbzlgen/cmakelib/bindings"
+	"github.com/kythe/llvmbzlgen/writer"
+)
+
+const (
+	inputName  = "CMakeLists.txt"
+	outputName = "CMakeLists.bzl"
+	macroName  = "generated_cmake_targets"
+
+	// defaultContextName is the name of the context parameter of each macro, unless configured.
+	defaultContextName = "ctx"
+
+	// bytesPerCommand is the approximate size of the output for a single command,
+	// used to size the output buffer.
+	bytesPerCommand = 80
+)
+
+// OutputFS is the interface implemented by destinations for generated files.
+type OutputFS interface {
+	// ReadFile returns the contents of the named file or an error
+	// for which errors.Is(err, fs.ErrNotExist) is true if it does not exist.
+	ReadFile(name string) ([]byte, error)
+	// WriteFile replaces the contents of the named file, creating it
+	// and any missing parent directories as necessary.
+	WriteFile(name string, data []byte) error
+}
+
+// DirFS returns an OutputFS writing files beneath the directory dir.
+func DirFS(dir string) OutputFS {
+	return dirFS(dir)
+}
+
+type dirFS string
+
+// ReadFile implements OutputFS.
+func (d dirFS) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(string(d), filepath.FromSlash(name)))
+}
+
+// WriteFile implements OutputFS.
+func (d dirFS) WriteFile(name string, data []byte) error {
+	name = filepath.Join(string(d), filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(name), 0777); err != nil {
+		return err
+	}
+	return os.WriteFile(name, data, 0666)
+}
+
+// NewlineStyle selects the line terminator used in generated files.
+type NewlineStyle int
+
+// Constants defining the supported line terminators.
+const (
+	LF   NewlineStyle = iota // Unix-style "\n" line endings.
+	CRLF                     // Windows-style "\r\n" line endings.
+)
+
+// Options configures a generation run.
+type Options struct {
+	Prefix        string       // Directory within the output FS beneath which files are written.
+	Strict        bool         // If true, commands without a translation are an error rather than being emitted verbatim.
+	Newline       NewlineStyle // Line terminator to use in generated files.
+	SkipUnchanged bool         // If true, files whose contents would not change are not rewritten.
+	SkipMissing   bool         // If true, subdirectories absent from the input FS are skipped rather than an error.
+	Markers       bool         // If true, only the region between generated marker comments in existing files is replaced.
+
+	// If true, if() blocks are translated rather than skipped, and conditions on variables
+	// declared by option() are written as ctx.option(ctx, "NAME").
+	OptionConditions bool
+	// If true, option() also writes a config_setting for the option, enabled by --define NAME=ON.
+	OptionConfigSettings bool
+	// The name of the context parameter of each generated macro, through which helpers
+	// such as ctx.config are called. If empty, "ctx" is used.
+	ContextName string
+}
+
+// Manifest describes the files produced by a generation run.
+type Manifest struct {
+	Files   []File   // Generated files, in traversal order.
+	Skipped []string // Missing subdirectories which were skipped, in traversal order.
+}
+
+// File describes a single generated file.
+type File struct {
+	Path      string // Path of the file within the output FS.
+	Directory string // Input directory from which the file was generated.
+	Unchanged bool   // True if the file already held the generated contents and was not rewritten.
+
+	ExcludeFromAll bool // True if the directory was added with EXCLUDE_FROM_ALL.
+}
+
+// Generate walks the CMake tree rooted at the top of in, writing one .bzl file per
+// visited directory to out and returning a manifest of the files written.
+func Generate(in fs.FS, out OutputFS, opts Options) (*Manifest, error) {
+	g := &generator{
+		in:   in,
+		out:  out,
+		opts: opts,
+		p:    ast.NewParser(),
+		v:    bindings.New(),
+		m:    &Manifest{},
+
+		active: make(map[string]bool),
+	}
+	if err := g.generateDir(".", false); err != nil {
+		return nil, err
+	}
+	return g.m, nil
+}
+
+type generator struct {
+	in   fs.FS
+	out  OutputFS
+	opts Options
+
+	p *ast.Parser
+	v *bindings.Mapping
+	m *Manifest
+
+	active  map[string]bool // Directories currently being traversed, to detect cycles.
+	options stringset.Set   // Variables declared by option(), which are visible in all directories.
+}
+
+// contextName returns the name of the context parameter of the generated macros.
+func (g *generator) contextName() string {
+	if g.opts.ContextName == "" {
+		return defaultContextName
+	}
+	return g.opts.ContextName
+}
+
+// directory holds the state for the directory currently being translated.
+type directory struct {
+	path    string
+	w       *writer.StarlarkWriter
+	targets targetSet
+	loops   int // The number of enclosing foreach loops.
+
+	conditionals int // The number of enclosing if blocks, if translated.
+
+	// lists holds the names of variables whose value is also held in a Starlark list
+	// variable, as assigned by list().
+	lists stringset.Set
+
+	// generated holds the source files which are generated, rather than checked in,
+	// as marked by set_source_files_properties or produced by add_custom_command.
+	generated stringset.Set
+}
+
+// inputPath returns the path of the CMakeLists.txt being translated.
+func (d *directory) inputPath() string {
+	return path.Join(d.path, inputName)
+}
+
+// commandHandler translates a single CMake command, given its evaluated arguments.
+type commandHandler func(g *generator, d *directory, args []string) error
+
+// commandHandlers maps lower-cased CMake command names to their translation.
+// It is populated in init to break the initialization cycle through addSubdirectory,
+// and extended by RegisterTranslator.
+var commandHandlers map[string]commandHandler
+
+func init() {
+	commandHandlers = map[string]commandHandler{
+		"add_custom_command":          (*generator).addCustomCommand,
+		"add_custom_target":           (*generator).addCustomTarget,
+		"add_executable":              (*generator).addExecutable,
+		"add_library":                 (*generator).addLibrary,
+		"add_subdirectory":            (*generator).addSubdirectory,
+		"configure_file":              (*generator).configureFile,
+		"file":                        (*generator).fileCommand,
+		"install":                     (*generator).install,
+		"list":                        (*generator).listCommand,
+		"math":                        (*generator).mathCommand,
+		"option":                      (*generator).option,
+		"set":                         (*generator).setVariable,
+		"set_source_files_properties": (*generator).setSourceFilesProperties,
+		"set_target_properties":       (*generator).setTargetProperties,
+		"string":                      (*generator).stringCommand,
+		"target_compile_definitions":  (*generator).targetCompileDefinitions,
+		"target_include_directories":  (*generator).targetIncludeDirectories,
+		"target_link_libraries":       (*generator).targetLinkLibraries,
+		"unset":                       (*generator).unsetVariable,
+	}
+}
+
+// Translator translates a single CMake command, given its evaluated arguments,
+// by writing to the macro for the directory being translated.
+type Translator func(args []string, w *writer.StarlarkWriter) error
+
+// RegisterTranslator registers fn as the translation for the CMake command name,
+// which is matched case-insensitively. Commands without a built-in or registered
+// translation are written verbatim, or rejected in strict mode.
+// RegisterTranslator is not safe to call concurrently with Generate, and is intended
+// to be called from an init function. It panics if the command already has a translation.
+func RegisterTranslator(name string, fn Translator) {
+	name = strings.ToLower(name)
+	if _, ok := commandHandlers[name]; ok {
+		panic("generate: RegisterTranslator called twice for command " + name)
+	}
+	commandHandlers[name] = func(g *generator, d *directory, args []string) error {
+		return fn(args, d.w)
+	}
+}
+
+// generateDir translates the CMakeLists.txt in dir and writes the resulting .bzl file,
+// recursing into any subdirectories added along the way.
+func (g *generator) generateDir(dir string, excludeFromAll bool) error {
+	if g.active[dir] {
+		return fmt.Errorf("cyclic add_subdirectory: %s is already being traversed", dir)
+	}
+	g.active[dir] = true
+	defer delete(g.active, dir)
+
+	input, err := fs.ReadFile(g.in, path.Join(dir, inputName))
+	if err != nil {
+		return err
+	}
+	file, err := g.p.ParseBytes(input)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path.Join(dir, inputName), err)
+	}
+
+	var buf bytes.Buffer
+	size := len(file.Commands) * bytesPerCommand
+	buf.Grow(size)
+	d := &directory{path: dir, w: writer.NewStarlarkWriterSize(&buf, size, writer.ContextName(g.contextName()))}
+	if err := d.w.BeginMacro(macroName); err != nil {
+		return err
+	}
+	if dir != "." {
+		if err := d.w.PushDirectory(dir); err != nil {
+			return err
+		}
+	}
+	if err := g.translate(d, file.Commands); err != nil {
+		return err
+	}
+	if err := g.writeTargets(d); err != nil {
+		return err
+	}
+	if dir != "." {
+		if _, err := d.w.PopDirectory(); err != nil {
+			return err
+		}
+	}
+	if err := d.w.EndMacro(); err != nil {
+		return err
+	}
+	if err := d.w.Flush(); err != nil {
+		return err
+	}
+	return g.writeFile(File{Directory: dir, ExcludeFromAll: excludeFromAll}, buf.Bytes())
+}
+
+// translate dispatches each of cmds in turn.
+func (g *generator) translate(d *directory, cmds []ast.CommandInvocation) error {
+	for i := 0; i < len(cmds); i++ {
+		name := strings.ToLower(cmds[i].Name)
+		switch name {
+		case "foreach":
+			var err error
+			if i, err = g.foreach(d, cmds, i); err != nil {
+				return err
+			}
+			continue
+		case "if":
+			if g.opts.OptionConditions {
+				var err error
+				if i, err = g.conditional(d, cmds, i); err != nil {
+					return err
+				}
+				continue
+			}
+			i = skipBlock(cmds, i, name)
+			continue
+		// Other control flow is not yet translated, so skip the block entirely.
+		case "function", "macro", "while":
+			i = skipBlock(cmds, i, name)
+			continue
+		}
+		if err := g.dispatch(d, name, &cmds[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dispatch translates a single command using the registered handler, if any,
+// falling back to the unmapped command path.
+func (g *generator) dispatch(d *directory, name string, cmd *ast.CommandInvocation) error {
+	args := cmd.Arguments.Eval(g.v)
+	handler, ok := commandHandlers[name]
+	if !ok || ((d.loops > 0 || d.conditionals > 0) && !loopCommands.Contains(name)) {
+		handler = func(g *generator, d *directory, args []string) error {
+			return g.unmapped(d, name, args)
+		}
+	}
+	if err := handler(g, d, args); err != nil {
+		return fmt.Errorf("%s: %s: %v", d.inputPath(), cmd.Pos, err)
+	}
+	return nil
+}
+
+// unmapped handles a command without a translation, which is an error in strict
+// mode and otherwise written verbatim.
+func (g *generator) unmapped(d *directory, name string, args []string) error {
+	if g.opts.Strict {
+		return fmt.Errorf("no translation for command %s", name)
+	}
+	return d.w.WriteCommand(name, argumentValues(args)...)
+}
+
+// skipBlock returns the index of the command ending the block begun at cmds[i].
+func skipBlock(cmds []ast.CommandInvocation, i int, begin string) int {
+	depth := 0
+	for ; i < len(cmds); i++ {
+		switch strings.ToLower(cmds[i].Name) {
+		case begin:
+			depth++
+		case "end" + begin:
+			depth--
+		}
+		if depth == 0 {
+			break
+		}
+	}
+	return i
+}
+
+// writeFile writes the generated contents for entry.Directory to the output FS and records it in the manifest.
+func (g *generator) writeFile(entry File, data []byte) error {
+	if g.opts.Newline == CRLF {
+		data = bytes.Replace(data, []byte("\n"), []byte("\r\n"), -1)
+	}
+	name := path.Join(g.opts.Prefix, entry.Directory, outputName)
+	entry.Path = name
+	if g.opts.SkipUnchanged || g.opts.Markers {
+		existing, err := g.out.ReadFile(name)
+		if err != nil && g.opts.Markers && !errors.Is(err, fs.ErrNotExist) {
+			// Hand-written contents which cannot be read must not be replaced.
+			return err
+		}
+		if g.opts.Markers {
+			newline := "\n"
+			if g.opts.Newline == CRLF {
+				newline = "\r\n"
+			}
+			var serr error
+			if data, serr = spliceGenerated(existing, data, newline); serr != nil {
+				return fmt.Errorf("%s: %v", name, serr)
+			}
+		}
+		entry.Unchanged = g.opts.SkipUnchanged && err == nil && bytes.Equal(existing, data)
+	}
+	if !entry.Unchanged {
+		if err := g.out.WriteFile(name, data); err != nil {
+			return err
+		}
+	}
+	g.m.Files = append(g.m.Files, entry)
+	return nil
+}
+
+// subdirectoryArgs are the parsed arguments to add_subdirectory.
+type subdirectoryArgs struct {
+	source         string
+	binary         string
+	excludeFromAll bool
+}
+
+// parseSubdirectoryArgs parses the arguments to add_subdirectory, which take the form
+// add_subdirectory(source_dir [binary_dir] [EXCLUDE_FROM_ALL] [SYSTEM]).
+func parseSubdirectoryArgs(args []string) (*subdirectoryArgs, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("missing required source directory argument to add_subdirectory")
+	}
+	sa := &subdirectoryArgs{source: args[0]}
+	for _, arg := range args[1:] {
+		switch {
+		case arg == "EXCLUDE_FROM_ALL":
+			sa.excludeFromAll = true
+		case arg == "SYSTEM":
+			// Only affects include directories of the build, which we ignore.
+		case sa.binary == "":
+			sa.binary = arg
+		default:
+			return nil, fmt.Errorf("unexpected argument to add_subdirectory: %s", arg)
+		}
+	}
+	return sa, nil
+}
+
+// addSubdirectory recurses into the source directory named by the first argument.
+// The binary directory is irrelevant to the generated targets and is ignored.
+// See https://cmake.org/cmake/help/latest/command/add_subdirectory.html
+func (g *generator) addSubdirectory(d *directory, args []string) error {
+	sa, err := parseSubdirectoryArgs(args)
+	if err != nil {
+		return err
+	}
+	dir := path.Join(d.path, sa.source)
+	if !fs.ValidPath(dir) {
+		return fmt.Errorf("subdirectory outside of source tree: %s", sa.source)
+	}
+	if g.opts.SkipMissing {
+		if info, err := fs.Stat(g.in, dir); errors.Is(err, fs.ErrNotExist) || (err == nil && !info.IsDir()) {
+			g.m.Skipped = append(g.m.Skipped, dir)
+			return nil
+		}
+	}
+	g.v.Push()
+	defer g.v.Pop()
+	return g.generateDir(dir, sa.excludeFromAll)
+}
+
+// setVariable sets the value of the variable designated by the first argument, following the rules of
+// https://cmake.org/cmake/help/latest/command/set.html#command:set
+func (g *generator) setVariable(d *directory, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("cannot set a variable without a name")
+	}
+	key, args := args[0], args[1:]
+	d.lists.Discard(key)
+	switch {
+	case len(args) > 0 && args[len(args)-1] == "PARENT_SCOPE":
+		g.v.SetParent(key, strings.Join(args[:len(args)-1], ";"))
+	case len(args) >= 3 && args[len(args)-3] == "CACHE":
+		return g.setCache(d, key, strings.Join(args[:len(args)-3], ";"), args[len(args)-2])
+	case len(args) >= 4 && args[len(args)-4] == "CACHE" && args[len(args)-1] == "FORCE":
+		return g.setCache(d, key, strings.Join(args[:len(args)-4], ";"), args[len(args)-3])
+	case isDeferred(args...):
+		// The value is known only when evaluated, as within a loop, so it is assigned to a Starlark
+		// variable to which later references refer, including those following the loop.
+		if _, ok := listRef(args[0]); len(args) == 1 && !ok {
+			return g.assignValue(d, key, args[0], argumentValue(args[0]))
+		}
+		return g.assignList(d, key, args, listExpr(args))
+	default:
+		g.v.Set(key, strings.Join(args, ";"))
+	}
+	return nil
+}
+
+// unsetVariable unsets the value of the variable designated by the first argument, following the rules of
+// https://cmake.org/cmake/help/latest/command/unset.html
+func (g *generator) unsetVariable(d *directory, args []string) error {
+	if len(args) > 0 {
+		d.lists.Discard(args[0])
+	}
+	switch {
+	case len(args) == 1:
+		g.v.Set(args[0], "")
+	case len(args) == 2 && args[1] == "PARENT_SCOPE":
+		g.v.SetParent(args[0], "")
+	case len(args) == 2 && args[1] == "CACHE":
+		g.v.SetCache(args[0], "")
+	default:
+		return fmt.Errorf("invalid arguments to unset: %v", args)
+	}
+	return nil
+}
@@ -0,0 +1,257 @@
+/*
+ * Copyright 2019 The Kythe Authors. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generate
+
+import (
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kythe/llvmbzlgen/writer"
+)
+
+// memFS is a simple in-memory OutputFS.
+type memFS map[string]string
+
+func (m memFS) ReadFile(name string) ([]byte, error) {
+	data, ok := m[name]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	return []byte(data), nil
+}
+
+func (m memFS) WriteFile(name string, data []byte) error {
+	m[name] = string(data)
+	return nil
+}
+
+func fixture(files map[string]string) fstest.MapFS {
+	fsys := make(fstest.MapFS)
+	for name, data := range files {
+		fsys[name] = &fstest.MapFile{Data: []byte(data)}
+	}
+	return fsys
+}
+
+func TestGenerate(t *testing.T) {
+	in := fixture(map[string]string{
+		"CMakeLists.txt": "set(SRCS a.cc b.cc)\n" +
+			"add_library(root ${SRCS})\n" +
+			"add_subdirectory(lib)\n",
+		"lib/CMakeLists.txt": "if(FOO)\n" +
+			"  add_library(skipped skipped.cc)\n" +
+			"endif()\n" +
+			"add_library(lib lib.cc)\n",
+	})
+	out := memFS{}
+	m, err := Generate(in, out, Options{Prefix: "gen"})
+	if err != nil {
+		t.Fatal("Unexpected error generating files: ", err)
+	}
+	expectedFiles := []File{
+		{Path: "gen/lib/CMakeLists.bzl", Directory: "lib"},
+		{Path: "gen/CMakeLists.bzl", Directory: "."},
+	}
+	if diff := cmp.Diff(expectedFiles, m.Files); diff != "" {
+		t.Error("Unexpected manifest:\n", diff)
+	}
+	expectedOutput := memFS{
+		"gen/CMakeLists.bzl": "def generated_cmake_targets(ctx):\n" +
+			"    ctx.cc_library(ctx, name = \"root\", srcs = [\"a.cc\", \"b.cc\"])\n" +
+			"    return ctx\n",
+		"gen/lib/CMakeLists.bzl": "def generated_cmake_targets(ctx):\n" +
+			"    ctx = ctx.push_directory(ctx, \"lib\")\n" +
+			"    ctx.cc_library(ctx, name = \"lib\", srcs = [\"lib.cc\"])\n" +
+			"    ctx = ctx.pop_directory(ctx)\n" +
+			"    return ctx\n",
+	}
+	if diff := cmp.Diff(expectedOutput, out); diff != "" {
+		t.Error("Unexpected output:\n", diff)
+	}
+}
+
+func TestGenerateStrict(t *testing.T) {
+	in := fixture(map[string]string{
+		"CMakeLists.txt": "llvm_add_library(root a.cc)\n",
+	})
+	if _, err := Generate(in, memFS{}, Options{Strict: true}); err == nil {
+		t.Error("Untranslated command accepted in strict mode")
+	}
+}
+
+func TestGenerateNewline(t *testing.T) {
+	in := fixture(map[string]string{
+		"CMakeLists.txt": "llvm_add_library(root a.cc)\n",
+	})
+	out := memFS{}
+	if _, err := Generate(in, out, Options{Newline: CRLF}); err != nil {
+		t.Fatal("Unexpected error generating files: ", err)
+	}
+	expected := "def generated_cmake_targets(ctx):\r\n" +
+		"    ctx.llvm_add_library(ctx, \"root\", \"a.cc\")\r\n" +
+		"    return ctx\r\n"
+	if diff := cmp.Diff(expected, out["CMakeLists.bzl"]); diff != "" {
+		t.Error("Unexpected output:\n", diff)
+	}
+}
+
+func TestGenerateSkipUnchanged(t *testing.T) {
+	in := fixture(map[string]string{
+		"CMakeLists.txt":     "add_subdirectory(lib)\n",
+		"lib/CMakeLists.txt": "add_library(lib lib.cc)\n",
+	})
+	out := memFS{}
+	if _, err := Generate(in, out, Options{}); err != nil {
+		t.Fatal("Unexpected error generating files: ", err)
+	}
+	out["CMakeLists.bzl"] = "stale"
+	m, err := Generate(in, out, Options{SkipUnchanged: true})
+	if err != nil {
+		t.Fatal("Unexpected error generating files: ", err)
+	}
+	expected := []File{
+		{Path: "lib/CMakeLists.bzl", Directory: "lib", Unchanged: true},
+		{Path: "CMakeLists.bzl", Directory: "."},
+	}
+	if diff := cmp.Diff(expected, m.Files); diff != "" {
+		t.Error("Unexpected manifest:\n", diff)
+	}
+}
+
+func TestAddSubdirectoryForms(t *testing.T) {
+	tests := []struct {
+		args     string
+		expected []File
+	}{
+		{"lib", []File{{Path: "lib/CMakeLists.bzl", Directory: "lib"}}},
+		{"lib ${CMAKE_BINARY_DIR}/out", []File{{Path: "lib/CMakeLists.bzl", Directory: "lib"}}},
+		{"lib EXCLUDE_FROM_ALL", []File{{Path: "lib/CMakeLists.bzl", Directory: "lib", ExcludeFromAll: true}}},
+		{"lib out EXCLUDE_FROM_ALL", []File{{Path: "lib/CMakeLists.bzl", Directory: "lib", ExcludeFromAll: true}}},
+	}
+	for _, test := range tests {
+		in := fixture(map[string]string{
+			"CMakeLists.txt":     "add_subdirectory(" + test.args + ")\n",
+			"lib/CMakeLists.txt": "add_library(lib lib.cc)\n",
+		})
+		out := memFS{}
+		m, err := Generate(in, out, Options{})
+		if err != nil {
+			t.Errorf("Unexpected error generating add_subdirectory(%s): %v", test.args, err)
+			continue
+		}
+		expected := append(test.expected, File{Path: "CMakeLists.bzl", Directory: "."})
+		if diff := cmp.Diff(expected, m.Files); diff != "" {
+			t.Errorf("Unexpected manifest for add_subdirectory(%s):\n%s", test.args, diff)
+		}
+		if _, ok := out["out/CMakeLists.bzl"]; ok {
+			t.Errorf("Binary directory used as source for add_subdirectory(%s)", test.args)
+		}
+	}
+}
+
+func TestAddSubdirectoryInvalid(t *testing.T) {
+	for _, args := range []string{"", "lib out other", "../outside"} {
+		in := fixture(map[string]string{
+			"CMakeLists.txt":     "add_subdirectory(" + args + ")\n",
+			"lib/CMakeLists.txt": "",
+		})
+		if _, err := Generate(in, memFS{}, Options{}); err == nil {
+			t.Errorf("Invalid add_subdirectory(%s) accepted", args)
+		}
+	}
+}
+
+func TestSkipMissing(t *testing.T) {
+	in := fixture(map[string]string{
+		"CMakeLists.txt": "add_subdirectory(lib)\n" +
+			"add_subdirectory(optional)\n",
+		"lib/CMakeLists.txt": "add_library(lib lib.cc)\n",
+	})
+	if _, err := Generate(in, memFS{}, Options{}); err == nil {
+		t.Error("Missing subdirectory accepted without SkipMissing")
+	}
+
+	out := memFS{}
+	m, err := Generate(in, out, Options{SkipMissing: true})
+	if err != nil {
+		t.Fatal("Unexpected error generating files: ", err)
+	}
+	expected := &Manifest{
+		Files: []File{
+			{Path: "lib/CMakeLists.bzl", Directory: "lib"},
+			{Path: "CMakeLists.bzl", Directory: "."},
+		},
+		Skipped: []string{"optional"},
+	}
+	if diff := cmp.Diff(expected, m); diff != "" {
+		t.Error("Unexpected manifest:\n", diff)
+	}
+	for name, data := range out {
+		if strings.Contains(data, "optional") {
+			t.Errorf("Unexpected reference to skipped directory in %s:\n%s", name, data)
+		}
+	}
+}
+
+func TestAddSubdirectoryCycle(t *testing.T) {
+	in := fixture(map[string]string{
+		"CMakeLists.txt":           "add_subdirectory(lib)\n",
+		"lib/CMakeLists.txt":       "add_subdirectory(inner)\n",
+		"lib/inner/CMakeLists.txt": "add_subdirectory(../../lib)\n",
+	})
+	_, err := Generate(in, memFS{}, Options{})
+	if err == nil {
+		t.Fatal("Cyclic add_subdirectory accepted")
+	}
+	if expected := "cyclic add_subdirectory: lib is already being traversed"; !strings.Contains(err.Error(), expected) {
+		t.Errorf("Expected error containing %q but got %q", expected, err)
+	}
+}
+
+func TestAddSubdirectoryRepeated(t *testing.T) {
+	in := fixture(map[string]string{
+		"CMakeLists.txt":     "add_subdirectory(lib)\nadd_subdirectory(lib)\n",
+		"lib/CMakeLists.txt": "",
+	})
+	// Visiting the same directory twice is not a cycle.
+	if _, err := Generate(in, memFS{}, Options{}); err != nil {
+		t.Error("Unexpected error generating files: ", err)
+	}
+}
+
+func TestRegisterTranslator(t *testing.T) {
+	RegisterTranslator("my_command", func(args []string, w *writer.StarlarkWriter) error {
+		return w.WriteCommandKw("my_rule", map[string]interface{}{"name": args[0], "srcs": args[1:]})
+	})
+	actual := generateRoot(t, "set(SRC b.cc)\nMY_COMMAND(a a.cc ${SRC})\n")
+	expected := "def generated_cmake_targets(ctx):\n" +
+		"    ctx.my_rule(ctx, name = \"a\", srcs = [\"a.cc\", \"b.cc\"])\n" +
+		"    return ctx\n"
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Error("Unexpected output:\n", diff)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Duplicate translator registration accepted")
+		}
+	}()
+	RegisterTranslator("add_library", func([]string, *writer.StarlarkWriter) error { return nil })
+}
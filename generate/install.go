@@ -0,0 +1,82 @@
+/*
+ * Copyright 2019 The Kythe Authors. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generate
+
+import (
+	"strings"
+
+	"bitbucket.org/creachadair/stringset"
+)
+
+// installKeywords are the keywords of install signatures which are not translated.
+var installKeywords = stringset.New(
+	"ARCHIVE", "LIBRARY", "RUNTIME", "OBJECTS", "FRAMEWORK", "BUNDLE",
+	"PRIVATE_HEADER", "PUBLIC_HEADER", "RESOURCE", "FILE_SET", "INCLUDES", "EXPORT",
+	"TYPE", "PERMISSIONS", "CONFIGURATIONS", "OPTIONAL", "EXCLUDE_FROM_ALL", "RENAME",
+	"NAMELINK_ONLY", "NAMELINK_SKIP", "NAMELINK_COMPONENT",
+)
+
+// installKinds maps the recognized install signatures to the keyword argument holding their items.
+var installKinds = map[string]string{
+	"TARGETS": "targets",
+	"FILES":   "files",
+}
+
+// install translates the common install(TARGETS targets... DESTINATION dir) and
+// install(FILES files... DESTINATION dir) signatures, with an optional COMPONENT,
+// into a call to ctx.install. Other signatures are passed to the unmapped command path.
+// See https://cmake.org/cmake/help/latest/command/install.html
+func (g *generator) install(d *directory, args []string) error {
+	kwargs, ok := parseInstallArgs(args)
+	if !ok {
+		return g.unmapped(d, "install", args)
+	}
+	return d.w.WriteCommandKw("install", kwargs)
+}
+
+// parseInstallArgs returns the keyword arguments for a recognized install signature.
+func parseInstallArgs(args []string) (map[string]interface{}, bool) {
+	if len(args) == 0 {
+		return nil, false
+	}
+	attr, ok := installKinds[args[0]]
+	if !ok {
+		return nil, false
+	}
+	var items []string
+	kwargs := make(map[string]interface{})
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "DESTINATION", "COMPONENT":
+			if i+1 == len(args) {
+				return nil, false
+			}
+			kwargs[strings.ToLower(args[i])] = args[i+1]
+			i++
+		default:
+			if len(kwargs) > 0 || installKeywords.Contains(args[i]) {
+				return nil, false
+			}
+			items = append(items, args[i])
+		}
+	}
+	if len(items) == 0 || kwargs["destination"] == nil {
+		return nil, false
+	}
+	kwargs[attr] = items
+	return kwargs, true
+}
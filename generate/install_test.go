@@ -0,0 +1,41 @@
+/*
+ * Copyright 2019 The Kythe Authors. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generate
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestInstall(t *testing.T) {
+	actual := generateRoot(t, "install(TARGETS foo bar DESTINATION lib)\n"+
+		"install(FILES a.h b.h DESTINATION include COMPONENT headers)\n"+
+		"install(TARGETS foo ARCHIVE DESTINATION lib)\n"+
+		"install(DIRECTORY include/ DESTINATION include)\n"+
+		"install(FILES a.h)\n")
+	expected := "def generated_cmake_targets(ctx):\n" +
+		"    ctx.install(ctx, destination = \"lib\", targets = [\"foo\", \"bar\"])\n" +
+		"    ctx.install(ctx, component = \"headers\", destination = \"include\", files = [\"a.h\", \"b.h\"])\n" +
+		"    ctx.install(ctx, \"TARGETS\", \"foo\", \"ARCHIVE\", \"DESTINATION\", \"lib\")\n" +
+		"    ctx.install(ctx, \"DIRECTORY\", \"include/\", \"DESTINATION\", \"include\")\n" +
+		"    ctx.install(ctx, \"FILES\", \"a.h\")\n" +
+		"    return ctx\n"
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Error("Unexpected output:\n", diff)
+	}
+}
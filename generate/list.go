@@ -0,0 +1,142 @@
+/*
+ * Copyright 2019 The Kythe Authors. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generate
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/kythe/llvmbzlgen/writer"
+)
+
+// listCommand translates the subcommands of list() with a direct Starlark equivalent into an
+// assignment of the output variable, passing any others to the unmapped command path.
+// See https://cmake.org/cmake/help/latest/command/list.html
+func (g *generator) listCommand(d *directory, args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("invalid arguments to list: %v", args)
+	}
+	mode, name := args[0], args[1]
+	items := splitList(g.v.Get(name))
+	list := d.listValue(name, items)
+	switch mode {
+	case "APPEND":
+		items = append(items, args[2:]...)
+		return g.assignList(d, name, items, writer.BinOp{Op: "+", X: list, Y: listExpr(args[2:])})
+	case "REMOVE_ITEM":
+		removed := make(map[string]bool)
+		for _, arg := range args[2:] {
+			removed[arg] = true
+		}
+		var kept []string
+		for _, item := range items {
+			if !removed[item] {
+				kept = append(kept, item)
+			}
+		}
+		return g.assignList(d, name, kept, writer.Comprehension{
+			Body: writer.Var("item"),
+			Var:  "item",
+			In:   list,
+			If:   writer.BinOp{Op: "not in", X: writer.Var("item"), Y: argumentValues(args[2:])},
+		})
+	case "LENGTH":
+		if len(args) != 3 {
+			return fmt.Errorf("invalid arguments to list(LENGTH): %v", args[1:])
+		}
+		length := strconv.Itoa(len(items))
+		if isDeferred(items...) {
+			length = loopVarValue(writer.SanitizeIdent(args[2]))
+		}
+		return g.assignValue(d, args[2], length, writer.Call{Func: writer.Var("len"), Args: []writer.Expr{list}})
+	case "GET":
+		// list(GET <list> <index> [<index> ...] <out>), where multiple indices produce a list.
+		if len(args) < 4 {
+			return fmt.Errorf("invalid arguments to list(GET): %v", args[1:])
+		}
+		out := args[len(args)-1]
+		// The elements of a list known only when evaluated are likewise unknown, as is its length.
+		deferred := isDeferred(items...)
+		var values []string
+		var exprs []interface{}
+		for _, arg := range args[2 : len(args)-1] {
+			i, err := strconv.Atoi(arg)
+			if err != nil {
+				return fmt.Errorf("invalid list index: %s", arg)
+			}
+			if deferred {
+				values = append(values, loopVarValue(writer.SanitizeIdent(out)))
+				exprs = append(exprs, writer.Index{X: list, I: i})
+				continue
+			}
+			if i < -len(items) || i >= len(items) {
+				return fmt.Errorf("list index %d out of range for %s of length %d", i, name, len(items))
+			}
+			if i < 0 {
+				i += len(items)
+			}
+			values = append(values, items[i])
+			exprs = append(exprs, writer.Index{X: list, I: i})
+		}
+		if len(exprs) == 1 {
+			return g.assignValue(d, out, values[0], exprs[0])
+		}
+		return g.assignList(d, out, values, exprs)
+	default:
+		return g.unmapped(d, "list", args)
+	}
+}
+
+// assignValue binds name to the evaluated value and writes its assignment to the Starlark expression.
+// If the value is known only when evaluated, later references refer to the Starlark variable.
+func (g *generator) assignValue(d *directory, name, value string, expr writer.Expr) error {
+	if isDeferred(value) {
+		value = loopVarValue(writer.SanitizeIdent(name))
+	}
+	g.v.Set(name, value)
+	d.lists.Discard(name)
+	return d.w.WriteAssignment(writer.SanitizeIdent(name), expr)
+}
+
+// assignList is like assignValue, but for list values. Subsequent list operations on
+// name refer to the Starlark variable.
+func (g *generator) assignList(d *directory, name string, items []string, expr writer.Expr) error {
+	if isDeferred(items...) {
+		g.v.Set(name, listVarValue(writer.SanitizeIdent(name)))
+	} else {
+		g.v.Set(name, strings.Join(items, ";"))
+	}
+	d.lists.Add(name)
+	return d.w.WriteAssignment(writer.SanitizeIdent(name), expr)
+}
+
+// listValue returns the Starlark expression for the current value of the named list variable.
+func (d *directory) listValue(name string, items []string) writer.Expr {
+	if d.lists.Contains(name) {
+		return writer.Var(writer.SanitizeIdent(name))
+	}
+	return listExpr(items)
+}
+
+// splitList returns the elements of a CMake list.
+func splitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ";")
+}
@@ -0,0 +1,77 @@
+/*
+ * Copyright 2019 The Kythe Authors. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generate
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestListCommand(t *testing.T) {
+	actual := generateRoot(t, "set(SRCS a.cc b.cc)\n"+
+		"list(APPEND SRCS c.cc d.cc)\n"+
+		"list(REMOVE_ITEM SRCS b.cc)\n"+
+		"list(LENGTH SRCS COUNT)\n"+
+		"list(GET SRCS 0 -1 ENDS)\n"+
+		"list(GET SRCS 1 SECOND)\n"+
+		"list(APPEND EMPTY x)\n"+
+		"run(${COUNT} ${SECOND})\n"+
+		"add_library(lib ${SRCS})\n"+
+		"list(SORT SRCS)\n")
+	expected := "def generated_cmake_targets(ctx):\n" +
+		"    SRCS = [\"a.cc\", \"b.cc\"] + [\"c.cc\", \"d.cc\"]\n" +
+		"    SRCS = [item for item in SRCS if item not in [\"b.cc\"]]\n" +
+		"    COUNT = len(SRCS)\n" +
+		"    ENDS = [SRCS[0], SRCS[2]]\n" +
+		"    SECOND = SRCS[1]\n" +
+		"    EMPTY = [] + [\"x\"]\n" +
+		"    ctx.run(ctx, \"3\", \"c.cc\")\n" +
+		"    ctx.list(ctx, \"SORT\", \"SRCS\")\n" +
+		"    ctx.cc_library(ctx, name = \"lib\", srcs = [\"a.cc\", \"c.cc\", \"d.cc\"])\n" +
+		"    return ctx\n"
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Error("Unexpected output:\n", diff)
+	}
+}
+
+func TestListCommandAfterSet(t *testing.T) {
+	actual := generateRoot(t, "list(APPEND L a)\n"+
+		"set(L b)\n"+
+		"list(APPEND L c)\n")
+	expected := "def generated_cmake_targets(ctx):\n" +
+		"    L = [] + [\"a\"]\n" +
+		"    L = [\"b\"] + [\"c\"]\n" +
+		"    return ctx\n"
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Error("Unexpected output:\n", diff)
+	}
+}
+
+func TestInvalidListCommand(t *testing.T) {
+	for _, input := range []string{
+		"list(APPEND)\n",
+		"list(LENGTH L)\n",
+		"list(GET L 0)\n",
+		"set(L a)\nlist(GET L 1 OUT)\n",
+		"set(L a)\nlist(GET L x OUT)\n",
+	} {
+		if _, err := Generate(fixture(map[string]string{"CMakeLists.txt": input}), memFS{}, Options{}); err == nil {
+			t.Errorf("Invalid list command accepted: %s", input)
+		}
+	}
+}
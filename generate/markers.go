@@ -0,0 +1,72 @@
+/*
+ * Copyright 2019 The Kythe Authors. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generate
+
+import (
+	"bytes"
+	"errors"
+)
+
+// Marker comments delimiting the generated region of a file written with Options.Markers.
+const (
+	beginMarker = "# GENERATED BEGIN"
+	endMarker   = "# GENERATED END"
+)
+
+// spliceGenerated returns the contents of existing with the region between the generated
+// markers replaced by data, preserving the lines outside of it. If existing has no markers,
+// they are appended along with data. The markers are terminated by newline.
+func spliceGenerated(existing, data []byte, newline string) ([]byte, error) {
+	begin, end := -1, -1 // The offsets of the lines following the begin marker and starting the end marker.
+	for start := 0; start < len(existing); {
+		next := len(existing)
+		if i := bytes.IndexByte(existing[start:], '\n'); i >= 0 {
+			next = start + i + 1
+		}
+		switch string(bytes.TrimRight(existing[start:next], "\r\n")) {
+		case beginMarker:
+			if begin >= 0 {
+				return nil, errors.New("duplicate " + beginMarker + " marker")
+			}
+			begin = next
+		case endMarker:
+			if begin < 0 || end >= 0 {
+				return nil, errors.New(endMarker + " marker without matching " + beginMarker)
+			}
+			end = start
+		}
+		start = next
+	}
+	var buf bytes.Buffer
+	switch {
+	case begin >= 0 && end < 0:
+		return nil, errors.New(beginMarker + " marker without matching " + endMarker)
+	case begin >= 0:
+		buf.Write(existing[:begin])
+		buf.Write(data)
+		buf.Write(existing[end:])
+	default:
+		buf.Write(existing)
+		if len(existing) > 0 && existing[len(existing)-1] != '\n' {
+			buf.WriteString(newline)
+		}
+		buf.WriteString(beginMarker + newline)
+		buf.Write(data)
+		buf.WriteString(endMarker + newline)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,102 @@
+/*
+ * Copyright 2019 The Kythe Authors. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generate
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSpliceGenerated(t *testing.T) {
+	tests := []struct {
+		existing, expected string
+	}{
+		{"", "# GENERATED BEGIN\nnew\n# GENERATED END\n"},
+		{"load(\"//:a.bzl\", \"a\")\n", "load(\"//:a.bzl\", \"a\")\n# GENERATED BEGIN\nnew\n# GENERATED END\n"},
+		{"# Hand-written", "# Hand-written\n# GENERATED BEGIN\nnew\n# GENERATED END\n"},
+		{"before\n# GENERATED BEGIN\nold\nlines\n# GENERATED END\nafter\n", "before\n# GENERATED BEGIN\nnew\n# GENERATED END\nafter\n"},
+		{"# GENERATED BEGIN\n# GENERATED END", "# GENERATED BEGIN\nnew\n# GENERATED END"},
+		{"a\r\n# GENERATED BEGIN\r\nold\r\n# GENERATED END\r\nb\r\n", "a\r\n# GENERATED BEGIN\r\nnew\n# GENERATED END\r\nb\r\n"},
+	}
+	for _, test := range tests {
+		actual, err := spliceGenerated([]byte(test.existing), []byte("new\n"), "\n")
+		if err != nil {
+			t.Errorf("Unexpected error splicing into %q: %v", test.existing, err)
+		} else if diff := cmp.Diff(test.expected, string(actual)); diff != "" {
+			t.Errorf("Unexpected output splicing into %q:\n%s", test.existing, diff)
+		}
+	}
+	for _, existing := range []string{
+		"# GENERATED BEGIN\n",
+		"# GENERATED END\n# GENERATED BEGIN\n",
+		"# GENERATED BEGIN\n# GENERATED BEGIN\n# GENERATED END\n",
+		"# GENERATED BEGIN\n# GENERATED END\n# GENERATED END\n",
+	} {
+		if _, err := spliceGenerated([]byte(existing), []byte("new\n"), "\n"); err == nil {
+			t.Errorf("Unbalanced markers in %q accepted", existing)
+		}
+	}
+}
+
+func TestGenerateMarkers(t *testing.T) {
+	in := fixture(map[string]string{
+		"CMakeLists.txt":     "add_subdirectory(lib)\nadd_library(root root.cc)\n",
+		"lib/CMakeLists.txt": "add_library(lib lib.cc)\n",
+	})
+	out := memFS{
+		"CMakeLists.bzl": "# Hand-written header.\n" +
+			"# GENERATED BEGIN\n" +
+			"stale\n" +
+			"# GENERATED END\n" +
+			"def hand_written(ctx):\n" +
+			"    return generated_cmake_targets(ctx)\n",
+	}
+	if _, err := Generate(in, out, Options{Markers: true}); err != nil {
+		t.Fatal("Unexpected error generating files: ", err)
+	}
+	expected := memFS{
+		"CMakeLists.bzl": "# Hand-written header.\n" +
+			"# GENERATED BEGIN\n" +
+			"def generated_cmake_targets(ctx):\n" +
+			"    ctx.cc_library(ctx, name = \"root\", srcs = [\"root.cc\"])\n" +
+			"    return ctx\n" +
+			"# GENERATED END\n" +
+			"def hand_written(ctx):\n" +
+			"    return generated_cmake_targets(ctx)\n",
+		"lib/CMakeLists.bzl": "# GENERATED BEGIN\n" +
+			"def generated_cmake_targets(ctx):\n" +
+			"    ctx = ctx.push_directory(ctx, \"lib\")\n" +
+			"    ctx.cc_library(ctx, name = \"lib\", srcs = [\"lib.cc\"])\n" +
+			"    ctx = ctx.pop_directory(ctx)\n" +
+			"    return ctx\n" +
+			"# GENERATED END\n",
+	}
+	if diff := cmp.Diff(expected, out); diff != "" {
+		t.Error("Unexpected output:\n", diff)
+	}
+
+	m, err := Generate(in, out, Options{Markers: true, SkipUnchanged: true})
+	if err != nil {
+		t.Fatal("Unexpected error regenerating files: ", err)
+	}
+	for _, f := range m.Files {
+		if !f.Unchanged {
+			t.Errorf("Regenerated file %s was rewritten", f.Path)
+		}
+	}
+}
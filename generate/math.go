@@ -0,0 +1,246 @@
+/*
+ * Copyright 2019 The Kythe Authors. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generate
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/kythe/llvmbzlgen/writer"
+)
+
+// mathCommand evaluates the expression of math(EXPR) and assigns the result to the output variable.
+// The expression is evaluated during translation, as its operands are known, so the assignment
+// is of the resulting value: an int in the default decimal format or a string in hexadecimal.
+// See https://cmake.org/cmake/help/latest/command/math.html
+func (g *generator) mathCommand(d *directory, args []string) error {
+	if len(args) == 0 || args[0] != "EXPR" {
+		return g.unmapped(d, "math", args)
+	}
+	if len(args) != 3 && (len(args) != 5 || args[3] != "OUTPUT_FORMAT") {
+		return fmt.Errorf("invalid arguments to math(EXPR): %v", args[1:])
+	}
+	out := args[1]
+	result, err := evalMathExpr(args[2])
+	if err != nil {
+		return err
+	}
+	var value interface{} = result
+	text := strconv.FormatInt(result, 10)
+	if len(args) == 5 {
+		switch format := args[4]; format {
+		case "DECIMAL":
+		case "HEXADECIMAL":
+			text = fmt.Sprintf("%#x", result)
+			value = text
+		default:
+			return fmt.Errorf("unknown output format for math(EXPR): %s", format)
+		}
+	}
+	g.v.Set(out, text)
+	d.lists.Discard(out)
+	return d.w.WriteAssignment(writer.SanitizeIdent(out), value)
+}
+
+// mathPrecedence maps the binary operators of math(EXPR) to their precedence, which is that of C.
+var mathPrecedence = map[string]int{
+	"|":  1,
+	"^":  2,
+	"&":  3,
+	"<<": 4, ">>": 4,
+	"+": 5, "-": 5,
+	"*": 6, "/": 6, "%": 6,
+}
+
+// evalMathExpr returns the value of a CMake integer expression, which uses the same
+// operators and precedence as C, other than ~ for bitwise complement.
+func evalMathExpr(expr string) (int64, error) {
+	p := &mathParser{expr: expr}
+	if err := p.scan(); err != nil {
+		return 0, err
+	}
+	x, err := p.parseBinary(1)
+	if err != nil {
+		return 0, err
+	}
+	if p.pos < len(p.tokens) {
+		return 0, fmt.Errorf("invalid math expression %q: unexpected %q", expr, p.tokens[p.pos])
+	}
+	return x.Int64(), nil
+}
+
+// mathParser is a precedence climbing parser and evaluator for the expressions of math(EXPR).
+// Each intermediate result must fit in 64 bits, as in CMake.
+type mathParser struct {
+	expr   string
+	tokens []string
+	pos    int
+}
+
+// scan splits the expression into integer literals and operators.
+func (p *mathParser) scan() error {
+	for i := 0; i < len(p.expr); {
+		c := p.expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c >= '0' && c <= '9':
+			// As in CMake, literals are decimal unless prefixed by 0x, even with a leading zero.
+			j, digits := i+1, "0123456789"
+			if c == '0' && j < len(p.expr) && (p.expr[j] == 'x' || p.expr[j] == 'X') {
+				j, digits = j+1, "0123456789abcdefABCDEF"
+			}
+			for j < len(p.expr) && strings.IndexByte(digits, p.expr[j]) >= 0 {
+				j++
+			}
+			if j < len(p.expr) && isAlnum(p.expr[j]) {
+				return fmt.Errorf("invalid math expression %q: invalid integer %q", p.expr, p.expr[i:j+1])
+			}
+			p.tokens = append(p.tokens, p.expr[i:j])
+			i = j
+		case strings.HasPrefix(p.expr[i:], "<<") || strings.HasPrefix(p.expr[i:], ">>"):
+			p.tokens = append(p.tokens, p.expr[i:i+2])
+			i += 2
+		case strings.IndexByte("+-*/%|&^~()", c) >= 0:
+			p.tokens = append(p.tokens, p.expr[i:i+1])
+			i++
+		default:
+			return fmt.Errorf("invalid math expression: %q", p.expr)
+		}
+	}
+	return nil
+}
+
+// isAlnum reports whether c is an ASCII letter, digit or underscore.
+func isAlnum(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// parseBinary parses a sequence of unary expressions separated by binary operators
+// of at least the given precedence.
+func (p *mathParser) parseBinary(prec int) (*big.Int, error) {
+	x, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.pos < len(p.tokens) {
+		op := p.tokens[p.pos]
+		opPrec, ok := mathPrecedence[op]
+		if !ok || opPrec < prec {
+			break
+		}
+		p.pos++
+		y, err := p.parseBinary(opPrec + 1)
+		if err != nil {
+			return nil, err
+		}
+		if x, err = p.apply(op, x, y); err != nil {
+			return nil, err
+		}
+	}
+	return x, nil
+}
+
+func (p *mathParser) parseUnary() (*big.Int, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, fmt.Errorf("invalid math expression %q: missing operand", p.expr)
+	}
+	tok := p.tokens[p.pos]
+	p.pos++
+	switch tok {
+	case "+", "-", "~":
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		switch tok {
+		case "-":
+			x.Neg(x)
+		case "~":
+			x.Not(x)
+		}
+		return p.check(x)
+	case "(":
+		x, err := p.parseBinary(1)
+		if err != nil {
+			return nil, err
+		}
+		if p.pos >= len(p.tokens) || p.tokens[p.pos] != ")" {
+			return nil, fmt.Errorf("invalid math expression %q: unbalanced parentheses", p.expr)
+		}
+		p.pos++
+		return x, nil
+	}
+	digits, base := tok, 10
+	if strings.HasPrefix(tok, "0x") || strings.HasPrefix(tok, "0X") {
+		digits, base = tok[2:], 16
+	}
+	n, err := strconv.ParseInt(digits, base, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid math expression %q: invalid integer %q", p.expr, tok)
+	}
+	return big.NewInt(n), nil
+}
+
+// apply returns the result of the binary operator op applied to x and y.
+func (p *mathParser) apply(op string, x, y *big.Int) (*big.Int, error) {
+	z := new(big.Int)
+	switch op {
+	case "|":
+		z.Or(x, y)
+	case "^":
+		z.Xor(x, y)
+	case "&":
+		z.And(x, y)
+	case "<<", ">>":
+		if y.Sign() < 0 || y.Cmp(big.NewInt(63)) > 0 {
+			return nil, fmt.Errorf("invalid shift count in math expression %q: %v", p.expr, y)
+		}
+		if op == "<<" {
+			z.Lsh(x, uint(y.Uint64()))
+		} else {
+			z.Rsh(x, uint(y.Uint64()))
+		}
+	case "+":
+		z.Add(x, y)
+	case "-":
+		z.Sub(x, y)
+	case "*":
+		z.Mul(x, y)
+	case "/", "%":
+		if y.Sign() == 0 {
+			return nil, fmt.Errorf("division by zero in math expression %q", p.expr)
+		}
+		// Quo and Rem truncate toward zero, as in C.
+		if op == "/" {
+			z.Quo(x, y)
+		} else {
+			z.Rem(x, y)
+		}
+	}
+	return p.check(z)
+}
+
+// check returns an error if x does not fit in 64 bits.
+func (p *mathParser) check(x *big.Int) (*big.Int, error) {
+	if !x.IsInt64() {
+		return nil, fmt.Errorf("math expression overflows a 64-bit integer: %q", p.expr)
+	}
+	return x, nil
+}
@@ -0,0 +1,92 @@
+/*
+ * Copyright 2019 The Kythe Authors. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generate
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMathCommand(t *testing.T) {
+	actual := generateRoot(t, "set(BASE 0x10)\n"+
+		"math(EXPR SUM \"1 + 2\")\n"+
+		"math(EXPR MASK \"(${BASE} | 3) & ~1\" OUTPUT_FORMAT HEXADECIMAL)\n"+
+		"math(EXPR QUOTIENT \"(${SUM} - 10) / 2\" OUTPUT_FORMAT DECIMAL)\n"+
+		"run(${SUM} ${MASK} ${QUOTIENT})\n")
+	expected := "def generated_cmake_targets(ctx):\n" +
+		"    SUM = 3\n" +
+		"    MASK = \"0x12\"\n" +
+		"    QUOTIENT = -3\n" +
+		"    ctx.run(ctx, \"3\", \"0x12\", \"-3\")\n" +
+		"    return ctx\n"
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Error("Unexpected output:\n", diff)
+	}
+}
+
+func TestInvalidMathCommand(t *testing.T) {
+	for _, input := range []string{
+		"math(EXPR)\n",
+		"math(EXPR out)\n",
+		"math(EXPR out \"1 +\")\n",
+		"math(EXPR out \"1 / 0\")\n",
+		"math(EXPR out \"1 < 2\")\n",
+		"math(EXPR out \"x + 1\")\n",
+		"math(EXPR out \"0b1\")\n",
+		"math(EXPR out \"0x\")\n",
+		"math(EXPR out \"12ab\")\n",
+		"math(EXPR out \"0x7fffffffffffffff + 1\")\n",
+		"math(EXPR out 1 OUTPUT_FORMAT OCTAL)\n",
+		"math(EXPR out 1 FORMAT DECIMAL)\n",
+	} {
+		if _, err := Generate(fixture(map[string]string{"CMakeLists.txt": input}), memFS{}, Options{}); err == nil {
+			t.Errorf("Invalid math command accepted: %s", input)
+		}
+	}
+}
+
+func TestMathPrecedence(t *testing.T) {
+	tests := []struct {
+		expr     string
+		expected int64
+	}{
+		{"1 << 2 + 1", 8},
+		{"1 + 2 << 3", 24},
+		{"1 | 2 ^ 3 & 4", 3},
+		{"6 & 3 << 1", 6},
+		{"2 + 3 * 4", 14},
+		{"-7 / 2", -3},
+		{"-7 % 2", -1},
+		{"~0 >> 60", -1},
+		{"- -1", 1},
+		{"(1 + 2) * 3", 9},
+		{"10 - 4 - 3", 3},
+		{"0x10 >> 2 | 1", 5},
+		{"0XfF", 255},
+		{"010 + 1", 11},
+		{"08", 8},
+	}
+	for _, test := range tests {
+		actual, err := evalMathExpr(test.expr)
+		if err != nil {
+			t.Errorf("Unexpected error evaluating %q: %v", test.expr, err)
+		} else if actual != test.expected {
+			t.Errorf("evalMathExpr(%q): expected %d but got %d", test.expr, test.expected, actual)
+		}
+	}
+}
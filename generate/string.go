@@ -0,0 +1,78 @@
+/*
+ * Copyright 2019 The Kythe Authors. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kythe/llvmbzlgen/writer"
+)
+
+// stringCommand translates the subcommands of string() with a direct Starlark equivalent into an
+// assignment of the output variable, passing any others to the unmapped command path.
+// See https://cmake.org/cmake/help/latest/command/string.html
+func (g *generator) stringCommand(d *directory, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing required subcommand argument to string")
+	}
+	var out, value string
+	var expr writer.Expr
+	switch mode := args[0]; mode {
+	case "TOLOWER", "TOUPPER":
+		if len(args) != 3 {
+			return fmt.Errorf("invalid arguments to string(%s): %v", mode, args[1:])
+		}
+		out = args[2]
+		if mode == "TOLOWER" {
+			value, expr = strings.ToLower(args[1]), stringMethod(args[1], "lower")
+		} else {
+			value, expr = strings.ToUpper(args[1]), stringMethod(args[1], "upper")
+		}
+	case "REPLACE":
+		// string(REPLACE <match> <replace> <out> <input>...), where the inputs are concatenated.
+		if len(args) < 4 {
+			return fmt.Errorf("invalid arguments to string(REPLACE): %v", args[1:])
+		}
+		out = args[3]
+		input := strings.Join(args[4:], "")
+		value = strings.Replace(input, args[1], args[2], -1)
+		expr = stringMethod(input, "replace", argumentValue(args[1]), argumentValue(args[2]))
+	case "CONCAT":
+		if len(args) < 2 {
+			return fmt.Errorf("missing required output variable argument to string(CONCAT)")
+		}
+		out = args[1]
+		value = strings.Join(args[2:], "")
+		expr = argumentValue(value)
+	default:
+		return g.unmapped(d, "string", args)
+	}
+	ident := writer.SanitizeIdent(out)
+	if loopVarPattern.MatchString(strings.Join(args, "")) {
+		// The result depends on a loop variable, so later references must refer to the Starlark variable.
+		value = loopVarValue(ident)
+	}
+	g.v.Set(out, value)
+	d.lists.Discard(out)
+	return d.w.WriteAssignment(ident, expr)
+}
+
+// stringMethod returns a call of the named string method on the evaluated argument arg.
+func stringMethod(arg, name string, args ...writer.Expr) writer.Call {
+	return writer.Call{Func: writer.Attr{X: argumentValue(arg), Name: name}, Args: args}
+}
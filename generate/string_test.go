@@ -0,0 +1,74 @@
+/*
+ * Copyright 2019 The Kythe Authors. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generate
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStringCommand(t *testing.T) {
+	actual := generateRoot(t, "set(NAME LLVMSupport)\n"+
+		"string(TOLOWER ${NAME} LOWER)\n"+
+		"string(TOUPPER ${NAME} UPPER)\n"+
+		"string(REPLACE Support Core REPLACED ${NAME} .a)\n"+
+		"string(CONCAT JOINED ${LOWER} - ${REPLACED})\n"+
+		"run(${JOINED})\n"+
+		"string(REGEX MATCH \"[a-z]+\" MATCHED ${NAME})\n")
+	expected := "def generated_cmake_targets(ctx):\n" +
+		"    LOWER = \"LLVMSupport\".lower()\n" +
+		"    UPPER = \"LLVMSupport\".upper()\n" +
+		"    REPLACED = \"LLVMSupport.a\".replace(\"Support\", \"Core\")\n" +
+		"    JOINED = \"llvmsupport-LLVMCore.a\"\n" +
+		"    ctx.run(ctx, \"llvmsupport-LLVMCore.a\")\n" +
+		"    ctx.string(ctx, \"REGEX\", \"MATCH\", \"[a-z]+\", \"MATCHED\", \"LLVMSupport\")\n" +
+		"    return ctx\n"
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Error("Unexpected output:\n", diff)
+	}
+}
+
+func TestStringCommandInLoop(t *testing.T) {
+	actual := generateRoot(t, "foreach(x a b)\n"+
+		"  string(TOUPPER ${x} upper)\n"+
+		"  string(CONCAT name lib ${upper})\n"+
+		"  run(${name})\n"+
+		"endforeach()\n")
+	expected := "def generated_cmake_targets(ctx):\n" +
+		"    for x in [\"a\", \"b\"]:\n" +
+		"        upper = x.upper()\n" +
+		"        name = (\"lib\" + upper)\n" +
+		"        ctx.run(ctx, name)\n" +
+		"    return ctx\n"
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Error("Unexpected output:\n", diff)
+	}
+}
+
+func TestInvalidStringCommand(t *testing.T) {
+	for _, input := range []string{
+		"string()\n",
+		"string(TOLOWER a)\n",
+		"string(REPLACE a b)\n",
+		"string(CONCAT)\n",
+	} {
+		if _, err := Generate(fixture(map[string]string{"CMakeLists.txt": input}), memFS{}, Options{}); err == nil {
+			t.Errorf("Invalid string command accepted: %s", input)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+/*
+ * Copyright 2019 The Kythe Authors. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generate
+
+import (
+	"fmt"
+	"strings"
+
+	"bitbucket.org/creachadair/stringset"
+)
+
+var (
+	libraryKeywords    = stringset.New("STATIC", "SHARED", "MODULE", "OBJECT", "INTERFACE", "EXCLUDE_FROM_ALL")
+	executableKeywords = stringset.New("WIN32", "MACOSX_BUNDLE", "EXCLUDE_FROM_ALL")
+	linkKeywords       = stringset.New(
+		"PUBLIC", "PRIVATE", "INTERFACE",
+		"LINK_PUBLIC", "LINK_PRIVATE", "LINK_INTERFACE_LIBRARIES",
+		"debug", "optimized", "general",
+	)
+	includeKeywords = stringset.New("SYSTEM", "AFTER", "BEFORE")
+	scopeKeywords   = stringset.New("PUBLIC", "PRIVATE", "INTERFACE")
+)
+
+// target accumulates the attributes of a single CMake target across the
+// commands which affect it, so that it can be written as a single rule.
+type target struct {
+	name    string
+	rule    string
+	attrs   map[string][]string
+	scalars map[string]string // Single-valued attributes.
+}
+
+// appendAttr appends values to the named attribute.
+func (t *target) appendAttr(attr string, values ...string) {
+	t.attrs[attr] = append(t.attrs[attr], values...)
+}
+
+// kwargs returns the keyword arguments with which to write the target's rule.
+// Sources which are generated are moved from srcs to generated_srcs, and empty attributes are omitted.
+// References to variables known only when evaluated are written as expressions, e.g. srcs = SRCS.
+func (t *target) kwargs(generated stringset.Set) map[string]interface{} {
+	kwargs := map[string]interface{}{"name": t.name}
+	for attr, value := range t.scalars {
+		kwargs[attr] = value
+	}
+	for attr, values := range t.attrs {
+		if attr == "srcs" && !generated.Empty() {
+			var srcs, gen []string
+			for _, src := range values {
+				if generated.Contains(src) {
+					gen = append(gen, src)
+				} else {
+					srcs = append(srcs, src)
+				}
+			}
+			if len(gen) > 0 {
+				kwargs["generated_srcs"] = gen
+			}
+			values = srcs
+		}
+		if isDeferred(values...) {
+			// Values known only when evaluated, such as globs, refer to their Starlark variable.
+			kwargs[attr] = listExpr(values)
+		} else if len(values) > 0 {
+			kwargs[attr] = values
+		}
+	}
+	return kwargs
+}
+
+// targetSet is the set of targets defined within a directory, in declaration order.
+type targetSet struct {
+	order  []*target
+	byName map[string]*target
+}
+
+// add declares a new target of the given rule kind.
+func (ts *targetSet) add(name, rule string) (*target, error) {
+	if _, ok := ts.byName[name]; ok {
+		return nil, fmt.Errorf("duplicate target: %s", name)
+	}
+	if ts.byName == nil {
+		ts.byName = make(map[string]*target)
+	}
+	t := &target{name: name, rule: rule, attrs: make(map[string][]string), scalars: make(map[string]string)}
+	ts.byName[name] = t
+	ts.order = append(ts.order, t)
+	return t, nil
+}
+
+// lookup returns the previously declared target with the given name.
+func (ts *targetSet) lookup(name string) (*target, error) {
+	t, ok := ts.byName[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown target: %s", name)
+	}
+	return t, nil
+}
+
+// writeTargets writes a single rule invocation for each of the targets declared in d.
+func (g *generator) writeTargets(d *directory) error {
+	for _, t := range d.targets.order {
+		if err := d.w.WriteCommandKw(t.rule, t.kwargs(d.generated)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addLibrary declares a new library target.
+// See https://cmake.org/cmake/help/latest/command/add_library.html
+func (g *generator) addLibrary(d *directory, args []string) error {
+	return g.addTarget(d, "add_library", "cc_library", libraryKeywords, args)
+}
+
+// addExecutable declares a new executable target.
+// See https://cmake.org/cmake/help/latest/command/add_executable.html
+func (g *generator) addExecutable(d *directory, args []string) error {
+	return g.addTarget(d, "add_executable", "cc_binary", executableKeywords, args)
+}
+
+// addTarget declares a new target of the given rule kind, using any non-keyword
+// arguments following the name as its sources.
+// Imported and alias targets are not accumulated, but passed to the unmapped command path.
+func (g *generator) addTarget(d *directory, cmd, rule string, keywords stringset.Set, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing required target name argument to %s", cmd)
+	}
+	if len(args) > 1 && (args[1] == "ALIAS" || args[1] == "IMPORTED") {
+		return g.unmapped(d, cmd, args)
+	}
+	t, err := d.targets.add(args[0], rule)
+	if err != nil {
+		return err
+	}
+	for _, arg := range args[1:] {
+		if !keywords.Contains(arg) {
+			t.appendAttr("srcs", arg)
+		}
+	}
+	return nil
+}
+
+// targetLinkLibraries adds the named libraries to the dependencies of a target.
+// See https://cmake.org/cmake/help/latest/command/target_link_libraries.html
+func (g *generator) targetLinkLibraries(d *directory, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing required target name argument to target_link_libraries")
+	}
+	t, err := d.targets.lookup(args[0])
+	if err != nil {
+		return err
+	}
+	for _, arg := range args[1:] {
+		if !linkKeywords.Contains(arg) {
+			t.appendAttr("deps", arg)
+		}
+	}
+	return nil
+}
+
+// targetIncludeDirectories adds include directories to a target.
+// Directories with PUBLIC or INTERFACE scope are propagated to dependents via
+// includes, while PRIVATE directories are passed only to the target via copts.
+// See https://cmake.org/cmake/help/latest/command/target_include_directories.html
+func (g *generator) targetIncludeDirectories(d *directory, args []string) error {
+	return g.appendScoped(d, "target_include_directories", includeKeywords, args, func(t *target, scope, dir string) {
+		if scope == "PRIVATE" {
+			t.appendAttr("copts", "-I"+dir)
+		} else {
+			t.appendAttr("includes", dir)
+		}
+	})
+}
+
+// targetCompileDefinitions adds preprocessor definitions to a target.
+// Definitions with PUBLIC or INTERFACE scope are propagated to dependents via
+// defines, while PRIVATE definitions are passed only to the target via local_defines.
+// See https://cmake.org/cmake/help/latest/command/target_compile_definitions.html
+func (g *generator) targetCompileDefinitions(d *directory, args []string) error {
+	return g.appendScoped(d, "target_compile_definitions", nil, args, func(t *target, scope, def string) {
+		// CMake removes any leading -D flag from definitions.
+		if def = strings.TrimPrefix(def, "-D"); def == "" {
+			return
+		}
+		if scope == "PRIVATE" {
+			t.appendAttr("local_defines", def)
+		} else {
+			t.appendAttr("defines", def)
+		}
+	})
+}
+
+// appendScoped calls add for each value following a scope keyword in the arguments to cmd,
+// which take the form: target [flags...] <PUBLIC|PRIVATE|INTERFACE> values... [...].
+func (g *generator) appendScoped(d *directory, cmd string, flags stringset.Set, args []string, add func(t *target, scope, value string)) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing required target name argument to %s", cmd)
+	}
+	t, err := d.targets.lookup(args[0])
+	if err != nil {
+		return err
+	}
+	var scope string
+	for _, arg := range args[1:] {
+		switch {
+		case scopeKeywords.Contains(arg):
+			scope = arg
+		case scope == "" && flags.Contains(arg):
+		case scope == "":
+			return fmt.Errorf("unknown scope for %s: %s", cmd, arg)
+		default:
+			add(t, scope, arg)
+		}
+	}
+	return nil
+}
+
+// targetProperties maps the target properties with a translation to a function applying them to a target.
+var targetProperties = map[string]func(t *target, value string){
+	"OUTPUT_NAME":   func(t *target, value string) { t.scalars["output_name"] = value },
+	"COMPILE_FLAGS": func(t *target, value string) { t.appendAttr("copts", strings.Fields(value)...) },
+	"LINK_FLAGS":    func(t *target, value string) { t.appendAttr("linkopts", strings.Fields(value)...) },
+}
+
+// setTargetProperties applies the properties to each of the named targets, which take the form:
+// targets... PROPERTIES key value [key value ...]. Properties without a translation are passed,
+// along with the targets, to the unmapped command path.
+// See https://cmake.org/cmake/help/latest/command/set_target_properties.html
+func (g *generator) setTargetProperties(d *directory, args []string) error {
+	i := 0
+	for i < len(args) && args[i] != "PROPERTIES" {
+		i++
+	}
+	if i == 0 || i == len(args) || (len(args)-i-1)%2 != 0 {
+		return fmt.Errorf("invalid arguments to set_target_properties: %v", args)
+	}
+	names, props := args[:i], args[i+1:]
+	targets := make([]*target, len(names))
+	for i, name := range names {
+		t, err := d.targets.lookup(name)
+		if err != nil {
+			return err
+		}
+		targets[i] = t
+	}
+	var unknown []string
+	for i := 0; i < len(props); i += 2 {
+		apply, ok := targetProperties[props[i]]
+		if !ok {
+			unknown = append(unknown, props[i], props[i+1])
+			continue
+		}
+		for _, t := range targets {
+			apply(t, props[i+1])
+		}
+	}
+	if len(unknown) > 0 {
+		return g.unmapped(d, "set_target_properties", append(append(names[:len(names):len(names)], "PROPERTIES"), unknown...))
+	}
+	return nil
+}
+
+// setSourceFilesProperties records the source files marked as GENERATED, which take the form:
+// files... PROPERTIES key value [key value ...]. Other properties, and properties set in other
+// directories, are passed, along with the files, to the unmapped command path.
+// See https://cmake.org/cmake/help/latest/command/set_source_files_properties.html
+func (g *generator) setSourceFilesProperties(d *directory, args []string) error {
+	i := 0
+	for i < len(args) && args[i] != "PROPERTIES" {
+		if args[i] == "DIRECTORY" || args[i] == "TARGET_DIRECTORY" {
+			return g.unmapped(d, "set_source_files_properties", args)
+		}
+		i++
+	}
+	if i == 0 || i == len(args) || (len(args)-i-1)%2 != 0 {
+		return fmt.Errorf("invalid arguments to set_source_files_properties: %v", args)
+	}
+	files, props := args[:i], args[i+1:]
+	var unknown []string
+	for i := 0; i < len(props); i += 2 {
+		if props[i] != "GENERATED" {
+			unknown = append(unknown, props[i], props[i+1])
+		} else if isTrue(props[i+1]) {
+			d.generated.Add(files...)
+		} else {
+			d.generated.Discard(files...)
+		}
+	}
+	if len(unknown) > 0 {
+		return g.unmapped(d, "set_source_files_properties", append(append(files[:len(files):len(files)], "PROPERTIES"), unknown...))
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+/*
+ * Copyright 2019 The Kythe Authors. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package generate
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// generateRoot generates a single top-level CMakeLists.txt with the given contents
+// and returns the resulting output.
+func generateRoot(t *testing.T, input string) string {
+	t.Helper()
+	out := memFS{}
+	if _, err := Generate(fixture(map[string]string{"CMakeLists.txt": input}), out, Options{}); err != nil {
+		t.Fatal("Unexpected error generating files: ", err)
+	}
+	return out["CMakeLists.bzl"]
+}
+
+func TestTargetLinkLibraries(t *testing.T) {
+	actual := generateRoot(t, "add_library(foo STATIC foo.cc)\n"+
+		"add_executable(tool tool.cc)\n"+
+		"target_link_libraries(foo PUBLIC bar baz)\n"+
+		"target_link_libraries(foo PRIVATE qux)\n"+
+		"target_link_libraries(tool foo)\n")
+	expected := "def generated_cmake_targets(ctx):\n" +
+		"    ctx.cc_library(ctx, deps = [\"bar\", \"baz\", \"qux\"], name = \"foo\", srcs = [\"foo.cc\"])\n" +
+		"    ctx.cc_binary(ctx, deps = [\"foo\"], name = \"tool\", srcs = [\"tool.cc\"])\n" +
+		"    return ctx\n"
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Error("Unexpected output:\n", diff)
+	}
+}
+
+func TestAliasTarget(t *testing.T) {
+	actual := generateRoot(t, "add_library(foo foo.cc)\n"+
+		"add_library(llvm::foo ALIAS foo)\n")
+	expected := "def generated_cmake_targets(ctx):\n" +
+		"    ctx.add_library(ctx, \"llvm::foo\", \"ALIAS\", \"foo\")\n" +
+		"    ctx.cc_library(ctx, name = \"foo\", srcs = [\"foo.cc\"])\n" +
+		"    return ctx\n"
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Error("Unexpected output:\n", diff)
+	}
+}
+
+func TestInvalidTargets(t *testing.T) {
+	for _, input := range []string{
+		"target_link_libraries(missing bar)\n",
+		"add_library(foo a.cc)\nadd_library(foo b.cc)\n",
+		"add_library()\n",
+	} {
+		if _, err := Generate(fixture(map[string]string{"CMakeLists.txt": input}), memFS{}, Options{}); err == nil {
+			t.Errorf("Invalid input accepted:\n%s", input)
+		}
+	}
+}
+
+func TestTargetIncludeDirectories(t *testing.T) {
+	actual := generateRoot(t, "add_library(foo foo.cc)\n"+
+		"target_include_directories(foo SYSTEM PUBLIC include PRIVATE lib INTERFACE api)\n"+
+		"target_include_directories(foo BEFORE PRIVATE internal)\n")
+	expected := "def generated_cmake_targets(ctx):\n" +
+		"    ctx.cc_library(ctx, copts = [\"-Ilib\", \"-Iinternal\"], includes = [\"include\", \"api\"], name = \"foo\", srcs = [\"foo.cc\"])\n" +
+		"    return ctx\n"
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Error("Unexpected output:\n", diff)
+	}
+}
+
+func TestTargetCompileDefinitions(t *testing.T) {
+	actual := generateRoot(t, "add_library(foo foo.cc)\n"+
+		"target_compile_definitions(foo PUBLIC X=1 INTERFACE -DY PRIVATE Z)\n"+
+		"target_compile_definitions(foo PRIVATE W=2)\n")
+	expected := "def generated_cmake_targets(ctx):\n" +
+		"    ctx.cc_library(ctx, defines = [\"X=1\", \"Y\"], local_defines = [\"Z\", \"W=2\"], name = \"foo\", srcs = [\"foo.cc\"])\n" +
+		"    return ctx\n"
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Error("Unexpected output:\n", diff)
+	}
+}
+
+func TestUnknownScope(t *testing.T) {
+	for _, input := range []string{
+		"add_library(foo foo.cc)\ntarget_compile_definitions(foo X=1)\n",
+		"add_library(foo foo.cc)\ntarget_include_directories(foo PROTECTED include)\n",
+		"target_include_directories(missing PUBLIC include)\n",
+	} {
+		if _, err := Generate(fixture(map[string]string{"CMakeLists.txt": input}), memFS{}, Options{}); err == nil {
+			t.Errorf("Invalid input accepted:\n%s", input)
+		}
+	}
+}
+
+func TestSetTargetProperties(t *testing.T) {
+	actual := generateRoot(t, "add_library(foo foo.cc)\n"+
+		"add_executable(tool tool.cc)\n"+
+		"set_target_properties(foo tool PROPERTIES COMPILE_FLAGS \"-Wall -Werror\" FOLDER Tools)\n"+
+		"set_target_properties(tool PROPERTIES OUTPUT_NAME llvm-tool LINK_FLAGS -static)\n")
+	expected := "def generated_cmake_targets(ctx):\n" +
+		"    ctx.set_target_properties(ctx, \"foo\", \"tool\", \"PROPERTIES\", \"FOLDER\", \"Tools\")\n" +
+		"    ctx.cc_library(ctx, copts = [\"-Wall\", \"-Werror\"], name = \"foo\", srcs = [\"foo.cc\"])\n" +
+		"    ctx.cc_binary(ctx, copts = [\"-Wall\", \"-Werror\"], linkopts = [\"-static\"], name = \"tool\", output_name = \"llvm-tool\", srcs = [\"tool.cc\"])\n" +
+		"    return ctx\n"
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Error("Unexpected output:\n", diff)
+	}
+}
+
+func TestInvalidSetTargetProperties(t *testing.T) {
+	for _, input := range []string{
+		"set_target_properties(PROPERTIES OUTPUT_NAME x)\n",
+		"add_library(foo foo.cc)\nset_target_properties(foo OUTPUT_NAME x)\n",
+		"add_library(foo foo.cc)\nset_target_properties(foo PROPERTIES OUTPUT_NAME)\n",
+		"set_target_properties(missing PROPERTIES OUTPUT_NAME x)\n",
+	} {
+		if _, err := Generate(fixture(map[string]string{"CMakeLists.txt": input}), memFS{}, Options{}); err == nil {
+			t.Errorf("Invalid set_target_properties accepted: %s", input)
+		}
+	}
+}
+
+func TestSetSourceFilesProperties(t *testing.T) {
+	actual := generateRoot(t, "add_library(foo foo.cc config.cc tables.inc other.cc)\n"+
+		"set_source_files_properties(config.cc other.cc PROPERTIES GENERATED TRUE COMPILE_FLAGS -O0)\n"+
+		"set_source_files_properties(other.cc PROPERTIES GENERATED OFF)\n"+
+		"add_custom_command(OUTPUT tables.inc COMMAND gen -o tables.inc)\n")
+	expected := "def generated_cmake_targets(ctx):\n" +
+		"    ctx.set_source_files_properties(ctx, \"config.cc\", \"other.cc\", \"PROPERTIES\", \"COMPILE_FLAGS\", \"-O0\")\n" +
+		"    ctx.genrule(ctx, cmd = \"gen -o tables.inc\", outs = [\"tables.inc\"])\n" +
+		"    ctx.cc_library(ctx, generated_srcs = [\"config.cc\", \"tables.inc\"], name = \"foo\", srcs = [\"foo.cc\", \"other.cc\"])\n" +
+		"    return ctx\n"
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Error("Unexpected output:\n", diff)
+	}
+}
+
+func TestInvalidSetSourceFilesProperties(t *testing.T) {
+	for _, input := range []string{
+		"set_source_files_properties(PROPERTIES GENERATED TRUE)\n",
+		"set_source_files_properties(a.cc GENERATED TRUE)\n",
+		"set_source_files_properties(a.cc PROPERTIES GENERATED)\n",
+	} {
+		if _, err := Generate(fixture(map[string]string{"CMakeLists.txt": input}), memFS{}, Options{}); err == nil {
+			t.Errorf("Invalid set_source_files_properties accepted: %s", input)
+		}
+	}
+}
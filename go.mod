@@ -1,10 +1,12 @@
 module github.com/kythe/llvmbzlgen
 
-go 1.12
+go 1.16
 
 require (
 	bitbucket.org/creachadair/stringset v0.0.9
 	github.com/alecthomas/participle v0.6.0
 	github.com/creachadair/ini v0.0.1
-	github.com/google/go-cmp v0.3.0
+	github.com/golang/protobuf v1.4.1
+	github.com/google/go-cmp v0.5.0
+	google.golang.org/protobuf v1.25.0
 )
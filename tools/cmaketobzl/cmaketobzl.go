@@ -77,6 +77,7 @@ type eval struct {
 }
 
 type options struct {
+	writerOpts  []writer.Option
 	macroName   string
 	shouldPrint func(string) bool
 	shouldAdd   func(string) bool
@@ -103,6 +104,11 @@ func ExcludePaths(p func(string) bool) Option {
 	return func(e *eval) { e.o.excludePath = p }
 }
 
+// WriterOptions configures the evaluator to create its StarlarkWriter with the given options.
+func WriterOptions(opts ...writer.Option) Option {
+	return func(e *eval) { e.o.writerOpts = append(e.o.writerOpts, opts...) }
+}
+
 // DefineVars configures the evaluator to predefine the specified variables.
 func DefineVars(vars map[string]string) Option {
 	return func(e *eval) {
@@ -121,7 +127,6 @@ func Matching(pat string) func(string) bool {
 func NewEvaluator(w io.Writer, opts ...Option) *eval {
 	e := &eval{
 		p: ast.NewParser(),
-		w: writer.NewStarlarkWriter(w),
 		v: bindings.New(),
 		o: options{
 			macroName: "generated_cmake_targets",
@@ -131,6 +136,7 @@ func NewEvaluator(w io.Writer, opts ...Option) *eval {
 	for _, o := range opts {
 		o(e)
 	}
+	e.w = writer.NewStarlarkWriter(w, e.o.writerOpts...)
 	e.v.Set("CMAKE_BINARY_DIR", e.ProjectRoot())
 	e.v.Set("CMAKE_SOURCE_DIR", e.ProjectRoot())
 	return e
@@ -163,7 +169,10 @@ func (e *eval) walk(paths []bzlpath.Path) error {
 			return err
 		}
 	}
-	return e.w.EndMacro()
+	if err := e.w.EndMacro(); err != nil {
+		return err
+	}
+	return e.w.Flush()
 }
 
 // dispatchFunc is a function which handles the current command, updates the
@@ -461,9 +470,12 @@ func (e *eval) PrintCommand(command *ast.CommandInvocation) error {
 	return e.w.WriteCommand(strings.ToLower(string(command.Name)), writer.ArgumentLiterals(command.Arguments.Eval(e.v)))
 }
 
+var failFast = flag.Bool("fail-fast", true, "Stop at the first invalid command, rather than reporting all of them")
+
 func main() {
 	flag.Parse()
 	eval := NewEvaluator(os.Stdout,
+		WriterOptions(writer.CollectErrors(!*failFast)),
 		ExcludePaths(Matching(`(^|/)(unittests|examples|cmake)($|/)`)),
 		RecurseCommands(Matching(`add(_\w+)?_subdirectory`)),
 		PrintCommands(Matching("^("+strings.Join([]string{
@@ -474,4 +486,10 @@ func main() {
 	if err := eval.walk(bzlpath.ToPaths(flag.Args())); err != nil {
 		log.Fatal(err)
 	}
+	if errs := eval.w.Errors(); len(errs) > 0 {
+		for _, err := range errs {
+			log.Print(err)
+		}
+		log.Fatalf("%d errors writing macro", len(errs))
+	}
 }
@@ -0,0 +1,74 @@
+/*
+ * Copyright 2019 The Kythe Authors. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package writer
+
+import "sort"
+
+// attributePriority is buildifier's table of rule attribute priorities, which determines the
+// canonical order of attributes: lower priorities are written first, and attributes with the
+// same priority are written in alphabetical order. Attributes not listed have unknownPriority,
+// so that they follow every listed attribute, in alphabetical order.
+// See NamePriority in https://github.com/bazelbuild/buildtools/blob/master/tables/tables.go
+var attributePriority = map[string]int{
+	"name":              -99,
+	"gwt_name":          -98,
+	"package_name":      -97,
+	"visible_node_name": -96,
+	"size":              -95,
+	"timeout":           -94,
+	"testonly":          -93,
+	"src":               -92,
+	"srcdir":            -91,
+	"srcs":              -90,
+	"out":               -89,
+	"outs":              -88,
+	"hdrs":              -87,
+	"has_services":      -86,
+	"include":           -85,
+	"of":                -84,
+	"baseline":          -83,
+	"destdir":           1,
+	"exports":           2,
+	"runtime_deps":      3,
+	"deps":              4,
+	"implementation":    5,
+	"implements":        6,
+	"alwayslink":        7,
+}
+
+// unknownPriority is the priority of attributes not listed in attributePriority,
+// which is greater than that of any listed attribute.
+const unknownPriority = 100
+
+// priority returns the priority of the named attribute.
+func priority(name string) int {
+	if p, ok := attributePriority[name]; ok {
+		return p
+	}
+	return unknownPriority
+}
+
+// sortAttributes sorts names into buildifier's canonical attribute order.
+func sortAttributes(names []string) {
+	sort.Slice(names, func(i, j int) bool {
+		pi, pj := priority(names[i]), priority(names[j])
+		if pi != pj {
+			return pi < pj
+		}
+		return names[i] < names[j]
+	})
+}
@@ -0,0 +1,150 @@
+/*
+ * Copyright 2019 The Kythe Authors. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package writer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path"
+)
+
+// buildFileName is the name of the file written to each directory by a BuildWriter.
+const buildFileName = "BUILD.bazel"
+
+// FileSystem is the interface implemented by destinations for files written by a BuildWriter.
+type FileSystem interface {
+	// WriteFile replaces the contents of the named file, creating it as necessary.
+	WriteFile(name string, data []byte) error
+}
+
+// BuildWriter writes commands as native rule invocations in one BUILD.bazel file
+// per directory, rather than as a macro to be replayed.
+// Each PushDirectory begins a new file for that directory, which is written
+// upon the matching PopDirectory.
+type BuildWriter struct {
+	fs       FileSystem
+	dirStack []string
+	files    []*buildFile // Pending contents, one per open directory, with the root first.
+}
+
+// buildFile holds the pending contents of a single BUILD.bazel file.
+type buildFile struct {
+	pkg  []byte // The package() call, if any, which precedes all rules.
+	body bytes.Buffer
+}
+
+// Len returns the length of the file contents.
+func (bf *buildFile) Len() int {
+	return len(bf.pkg) + bf.body.Len()
+}
+
+// Bytes returns the file contents.
+func (bf *buildFile) Bytes() []byte {
+	if bf.pkg == nil {
+		return bf.body.Bytes()
+	}
+	data := append([]byte(nil), bf.pkg...)
+	data = append(data, '\n')
+	if bf.body.Len() > 0 {
+		data = append(data, '\n')
+		data = append(data, bf.body.Bytes()...)
+	}
+	return data
+}
+
+// NewBuildWriter creates a new BuildWriter writing files to fs.
+func NewBuildWriter(fs FileSystem) *BuildWriter {
+	return &BuildWriter{fs: fs, files: []*buildFile{{}}}
+}
+
+// PushDirectory begins a new BUILD.bazel file in the given path, relative to the current directory.
+func (bw *BuildWriter) PushDirectory(path string) error {
+	bw.dirStack = append(bw.dirStack, path)
+	bw.files = append(bw.files, &buildFile{})
+	return nil
+}
+
+// PopDirectory writes the BUILD.bazel file for the current directory and restores the previous one.
+func (bw *BuildWriter) PopDirectory() (string, error) {
+	if len(bw.dirStack) == 0 {
+		return "", errors.New("no current directory")
+	}
+	name := bw.fileName()
+	data := bw.files[len(bw.files)-1].Bytes()
+	bw.files = bw.files[:len(bw.files)-1]
+	return pop(&bw.dirStack), bw.fs.WriteFile(name, data)
+}
+
+// WriteCommand writes an invocation of the provided rule or macro and arguments.
+func (bw *BuildWriter) WriteCommand(cmd string, args ...interface{}) error {
+	return bw.WriteCommandKw(cmd, nil, args...)
+}
+
+// WriteCommandKw writes an invocation of the provided rule or macro with the positional arguments
+// followed by the keyword arguments, sorted by name.
+func (bw *BuildWriter) WriteCommandKw(cmd string, kwargs map[string]interface{}, args ...interface{}) error {
+	ident, err := identName(cmd)
+	if err != nil {
+		return err
+	}
+	text, err := Marshal(Call{Func: Raw(ident), Args: args, Kwargs: kwargs})
+	if err != nil {
+		return err
+	}
+	buf := &bw.files[len(bw.files)-1].body
+	if buf.Len() > 0 {
+		buf.WriteString("\n")
+	}
+	buf.Write(text)
+	buf.WriteString("\n")
+	return nil
+}
+
+// WritePackageDefaults writes a package() call with the given keyword arguments, sorted by name,
+// such as default_visibility. The call is written before any rule in the current file,
+// and may be written at most once per file.
+func (bw *BuildWriter) WritePackageDefaults(kwargs map[string]interface{}) error {
+	bf := bw.files[len(bw.files)-1]
+	if bf.pkg != nil {
+		return fmt.Errorf("package defaults already written for %s", bw.fileName())
+	}
+	text, err := Marshal(Call{Func: Raw("package"), Kwargs: kwargs})
+	if err != nil {
+		return err
+	}
+	bf.pkg = text
+	return nil
+}
+
+// Flush verifies that every directory has been closed and writes the root BUILD.bazel file,
+// if any commands were written outside of a directory.
+func (bw *BuildWriter) Flush() error {
+	if len(bw.dirStack) > 0 {
+		return fmt.Errorf("unclosed directory %q", bw.dirStack[len(bw.dirStack)-1])
+	}
+	if bw.files[0].Len() == 0 {
+		return nil
+	}
+	defer func() { bw.files[0] = &buildFile{} }()
+	return bw.fs.WriteFile(bw.fileName(), bw.files[0].Bytes())
+}
+
+// fileName returns the path of the BUILD.bazel file for the current directory.
+func (bw *BuildWriter) fileName() string {
+	return path.Join(append(bw.dirStack, buildFileName)...)
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright 2019 The Kythe Authors. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package writer
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type memFS map[string]string
+
+func (m memFS) WriteFile(name string, data []byte) error {
+	m[name] = string(data)
+	return nil
+}
+
+func TestBuildWriter(t *testing.T) {
+	fs := memFS{}
+	writer := NewBuildWriter(fs)
+	if err := writer.PushDirectory("lib"); err != nil {
+		t.Fatal("Unexpected error entering directory: ", err)
+	}
+	if err := writer.WriteCommandKw("cc_library", map[string]interface{}{"name": "lib", "srcs": []string{"lib.cc"}}); err != nil {
+		t.Fatal("Unexpected error writing command: ", err)
+	}
+	if err := writer.PushDirectory("sub"); err != nil {
+		t.Fatal("Unexpected error entering directory: ", err)
+	}
+	if err := writer.WriteCommandKw("cc_library", map[string]interface{}{"name": "sub"}); err != nil {
+		t.Fatal("Unexpected error writing command: ", err)
+	}
+	if err := writer.WriteCommand("exports_files", []string{"sub.h"}); err != nil {
+		t.Fatal("Unexpected error writing command: ", err)
+	}
+	if p, err := writer.PopDirectory(); err != nil {
+		t.Fatal("Unexpected error exiting directory: ", err)
+	} else if p != "sub" {
+		t.Errorf("Unexpected directory path: %s", p)
+	}
+	if _, err := writer.PopDirectory(); err != nil {
+		t.Fatal("Unexpected error exiting directory: ", err)
+	}
+	if err := writer.Flush(); err != nil {
+		t.Fatal("Unexpected error flushing writer: ", err)
+	}
+	expected := memFS{
+		"lib/BUILD.bazel": "cc_library(name = \"lib\", srcs = [\"lib.cc\"])\n",
+		"lib/sub/BUILD.bazel": "cc_library(name = \"sub\")\n" +
+			"\n" +
+			"exports_files([\"sub.h\"])\n",
+	}
+	if diff := cmp.Diff(expected, fs); diff != "" {
+		t.Error("Unexpected files:\n", diff)
+	}
+}
+
+func TestBuildWriterUnclosed(t *testing.T) {
+	writer := NewBuildWriter(memFS{})
+	if _, err := writer.PopDirectory(); err == nil {
+		t.Error("Unexpected success exiting unopened directory")
+	}
+	if err := writer.PushDirectory("lib"); err != nil {
+		t.Fatal("Unexpected error entering directory: ", err)
+	}
+	if err := writer.Flush(); err == nil {
+		t.Error("Unexpected success flushing with open directory")
+	}
+}
+
+func TestPackageDefaults(t *testing.T) {
+	fs := memFS{}
+	writer := NewBuildWriter(fs)
+	if err := writer.PushDirectory("lib"); err != nil {
+		t.Fatal("Unexpected error entering directory: ", err)
+	}
+	if err := writer.WriteCommandKw("cc_library", map[string]interface{}{"name": "lib"}); err != nil {
+		t.Fatal("Unexpected error writing command: ", err)
+	}
+	if err := writer.WritePackageDefaults(map[string]interface{}{"default_visibility": []string{"//visibility:public"}}); err != nil {
+		t.Fatal("Unexpected error writing package defaults: ", err)
+	}
+	if err := writer.WritePackageDefaults(map[string]interface{}{"default_visibility": []string{}}); err == nil {
+		t.Error("Unexpected success writing package defaults twice")
+	}
+	if err := writer.WritePackageDefaults(map[string]interface{}{"not valid": 1}); err == nil {
+		t.Error("Unexpected success writing invalid package defaults")
+	}
+	if _, err := writer.PopDirectory(); err != nil {
+		t.Fatal("Unexpected error exiting directory: ", err)
+	}
+	if err := writer.Flush(); err != nil {
+		t.Fatal("Unexpected error flushing writer: ", err)
+	}
+	expected := memFS{
+		"lib/BUILD.bazel": "package(default_visibility = [\"//visibility:public\"])\n" +
+			"\n" +
+			"cc_library(name = \"lib\")\n",
+	}
+	if diff := cmp.Diff(expected, fs); diff != "" {
+		t.Error("Unexpected files:\n", diff)
+	}
+}
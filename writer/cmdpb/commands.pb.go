@@ -0,0 +1,1110 @@
+//
+// Copyright 2019 The Kythe Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.25.0
+// 	protoc        (unknown)
+// source: writer/cmdpb/commands.proto
+
+package cmdpb
+
+import (
+	proto "github.com/golang/protobuf/proto"
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// This is a compile-time assertion that a sufficiently up-to-date version
+// of the legacy proto package is being used.
+const _ = proto.ProtoPackageIsVersion4
+
+type Block_Kind int32
+
+const (
+	Block_UNKNOWN Block_Kind = 0
+	Block_IF      Block_Kind = 1
+	Block_ELIF    Block_Kind = 2
+	Block_ELSE    Block_Kind = 3
+	Block_FOR     Block_Kind = 4
+)
+
+// Enum value maps for Block_Kind.
+var (
+	Block_Kind_name = map[int32]string{
+		0: "UNKNOWN",
+		1: "IF",
+		2: "ELIF",
+		3: "ELSE",
+		4: "FOR",
+	}
+	Block_Kind_value = map[string]int32{
+		"UNKNOWN": 0,
+		"IF":      1,
+		"ELIF":    2,
+		"ELSE":    3,
+		"FOR":     4,
+	}
+)
+
+func (x Block_Kind) Enum() *Block_Kind {
+	p := new(Block_Kind)
+	*p = x
+	return p
+}
+
+func (x Block_Kind) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Block_Kind) Descriptor() protoreflect.EnumDescriptor {
+	return file_writer_cmdpb_commands_proto_enumTypes[0].Descriptor()
+}
+
+func (Block_Kind) Type() protoreflect.EnumType {
+	return &file_writer_cmdpb_commands_proto_enumTypes[0]
+}
+
+func (x Block_Kind) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Block_Kind.Descriptor instead.
+func (Block_Kind) EnumDescriptor() ([]byte, []int) {
+	return file_writer_cmdpb_commands_proto_rawDescGZIP(), []int{9, 0}
+}
+
+// CommandStream is the sequence of events written to a MacroWriter.
+type CommandStream struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Events []*Event `protobuf:"bytes,1,rep,name=events,proto3" json:"events,omitempty"`
+}
+
+func (x *CommandStream) Reset() {
+	*x = CommandStream{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_writer_cmdpb_commands_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *CommandStream) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CommandStream) ProtoMessage() {}
+
+func (x *CommandStream) ProtoReflect() protoreflect.Message {
+	mi := &file_writer_cmdpb_commands_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CommandStream.ProtoReflect.Descriptor instead.
+func (*CommandStream) Descriptor() ([]byte, []int) {
+	return file_writer_cmdpb_commands_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *CommandStream) GetEvents() []*Event {
+	if x != nil {
+		return x.Events
+	}
+	return nil
+}
+
+// Event is a single call to a MacroWriter.
+type Event struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Types that are assignable to Kind:
+	//	*Event_Load
+	//	*Event_BeginMacro
+	//	*Event_EndMacro
+	//	*Event_Command
+	//	*Event_PushDirectory
+	//	*Event_PopDirectory
+	//	*Event_BeginBlock
+	//	*Event_EndBlock
+	//	*Event_Assignment
+	Kind isEvent_Kind `protobuf_oneof:"kind"`
+}
+
+func (x *Event) Reset() {
+	*x = Event{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_writer_cmdpb_commands_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Event) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Event) ProtoMessage() {}
+
+func (x *Event) ProtoReflect() protoreflect.Message {
+	mi := &file_writer_cmdpb_commands_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Event.ProtoReflect.Descriptor instead.
+func (*Event) Descriptor() ([]byte, []int) {
+	return file_writer_cmdpb_commands_proto_rawDescGZIP(), []int{1}
+}
+
+func (m *Event) GetKind() isEvent_Kind {
+	if m != nil {
+		return m.Kind
+	}
+	return nil
+}
+
+func (x *Event) GetLoad() *Load {
+	if x, ok := x.GetKind().(*Event_Load); ok {
+		return x.Load
+	}
+	return nil
+}
+
+func (x *Event) GetBeginMacro() *Macro {
+	if x, ok := x.GetKind().(*Event_BeginMacro); ok {
+		return x.BeginMacro
+	}
+	return nil
+}
+
+func (x *Event) GetEndMacro() *EndMacro {
+	if x, ok := x.GetKind().(*Event_EndMacro); ok {
+		return x.EndMacro
+	}
+	return nil
+}
+
+func (x *Event) GetCommand() *Command {
+	if x, ok := x.GetKind().(*Event_Command); ok {
+		return x.Command
+	}
+	return nil
+}
+
+func (x *Event) GetPushDirectory() *PushDirectory {
+	if x, ok := x.GetKind().(*Event_PushDirectory); ok {
+		return x.PushDirectory
+	}
+	return nil
+}
+
+func (x *Event) GetPopDirectory() *PopDirectory {
+	if x, ok := x.GetKind().(*Event_PopDirectory); ok {
+		return x.PopDirectory
+	}
+	return nil
+}
+
+func (x *Event) GetBeginBlock() *Block {
+	if x, ok := x.GetKind().(*Event_BeginBlock); ok {
+		return x.BeginBlock
+	}
+	return nil
+}
+
+func (x *Event) GetEndBlock() *EndBlock {
+	if x, ok := x.GetKind().(*Event_EndBlock); ok {
+		return x.EndBlock
+	}
+	return nil
+}
+
+func (x *Event) GetAssignment() *Assignment {
+	if x, ok := x.GetKind().(*Event_Assignment); ok {
+		return x.Assignment
+	}
+	return nil
+}
+
+type isEvent_Kind interface {
+	isEvent_Kind()
+}
+
+type Event_Load struct {
+	Load *Load `protobuf:"bytes,1,opt,name=load,proto3,oneof"`
+}
+
+type Event_BeginMacro struct {
+	BeginMacro *Macro `protobuf:"bytes,2,opt,name=begin_macro,json=beginMacro,proto3,oneof"`
+}
+
+type Event_EndMacro struct {
+	EndMacro *EndMacro `protobuf:"bytes,3,opt,name=end_macro,json=endMacro,proto3,oneof"`
+}
+
+type Event_Command struct {
+	Command *Command `protobuf:"bytes,4,opt,name=command,proto3,oneof"`
+}
+
+type Event_PushDirectory struct {
+	PushDirectory *PushDirectory `protobuf:"bytes,5,opt,name=push_directory,json=pushDirectory,proto3,oneof"`
+}
+
+type Event_PopDirectory struct {
+	PopDirectory *PopDirectory `protobuf:"bytes,6,opt,name=pop_directory,json=popDirectory,proto3,oneof"`
+}
+
+type Event_BeginBlock struct {
+	BeginBlock *Block `protobuf:"bytes,7,opt,name=begin_block,json=beginBlock,proto3,oneof"`
+}
+
+type Event_EndBlock struct {
+	EndBlock *EndBlock `protobuf:"bytes,8,opt,name=end_block,json=endBlock,proto3,oneof"`
+}
+
+type Event_Assignment struct {
+	Assignment *Assignment `protobuf:"bytes,9,opt,name=assignment,proto3,oneof"`
+}
+
+func (*Event_Load) isEvent_Kind() {}
+
+func (*Event_BeginMacro) isEvent_Kind() {}
+
+func (*Event_EndMacro) isEvent_Kind() {}
+
+func (*Event_Command) isEvent_Kind() {}
+
+func (*Event_PushDirectory) isEvent_Kind() {}
+
+func (*Event_PopDirectory) isEvent_Kind() {}
+
+func (*Event_BeginBlock) isEvent_Kind() {}
+
+func (*Event_EndBlock) isEvent_Kind() {}
+
+func (*Event_Assignment) isEvent_Kind() {}
+
+// Load imports symbols from a .bzl file.
+type Load struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	File    string   `protobuf:"bytes,1,opt,name=file,proto3" json:"file,omitempty"`
+	Symbols []string `protobuf:"bytes,2,rep,name=symbols,proto3" json:"symbols,omitempty"`
+}
+
+func (x *Load) Reset() {
+	*x = Load{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_writer_cmdpb_commands_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Load) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Load) ProtoMessage() {}
+
+func (x *Load) ProtoReflect() protoreflect.Message {
+	mi := &file_writer_cmdpb_commands_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Load.ProtoReflect.Descriptor instead.
+func (*Load) Descriptor() ([]byte, []int) {
+	return file_writer_cmdpb_commands_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Load) GetFile() string {
+	if x != nil {
+		return x.File
+	}
+	return ""
+}
+
+func (x *Load) GetSymbols() []string {
+	if x != nil {
+		return x.Symbols
+	}
+	return nil
+}
+
+// Macro begins the definition of a macro.
+type Macro struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+}
+
+func (x *Macro) Reset() {
+	*x = Macro{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_writer_cmdpb_commands_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Macro) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Macro) ProtoMessage() {}
+
+func (x *Macro) ProtoReflect() protoreflect.Message {
+	mi := &file_writer_cmdpb_commands_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Macro.ProtoReflect.Descriptor instead.
+func (*Macro) Descriptor() ([]byte, []int) {
+	return file_writer_cmdpb_commands_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Macro) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+// EndMacro ends the definition of the current macro.
+type EndMacro struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *EndMacro) Reset() {
+	*x = EndMacro{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_writer_cmdpb_commands_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *EndMacro) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EndMacro) ProtoMessage() {}
+
+func (x *EndMacro) ProtoReflect() protoreflect.Message {
+	mi := &file_writer_cmdpb_commands_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EndMacro.ProtoReflect.Descriptor instead.
+func (*EndMacro) Descriptor() ([]byte, []int) {
+	return file_writer_cmdpb_commands_proto_rawDescGZIP(), []int{4}
+}
+
+// Command is an invocation of a command.
+// Argument values are recorded in their marshaled Starlark form.
+type Command struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Name   string            `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Args   []string          `protobuf:"bytes,2,rep,name=args,proto3" json:"args,omitempty"`
+	Kwargs map[string]string `protobuf:"bytes,3,rep,name=kwargs,proto3" json:"kwargs,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+}
+
+func (x *Command) Reset() {
+	*x = Command{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_writer_cmdpb_commands_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Command) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Command) ProtoMessage() {}
+
+func (x *Command) ProtoReflect() protoreflect.Message {
+	mi := &file_writer_cmdpb_commands_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Command.ProtoReflect.Descriptor instead.
+func (*Command) Descriptor() ([]byte, []int) {
+	return file_writer_cmdpb_commands_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Command) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Command) GetArgs() []string {
+	if x != nil {
+		return x.Args
+	}
+	return nil
+}
+
+func (x *Command) GetKwargs() map[string]string {
+	if x != nil {
+		return x.Kwargs
+	}
+	return nil
+}
+
+// Assignment assigns a value to a local variable.
+// The value is recorded in its marshaled Starlark form.
+type Assignment struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Name  string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Value string `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+}
+
+func (x *Assignment) Reset() {
+	*x = Assignment{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_writer_cmdpb_commands_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Assignment) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Assignment) ProtoMessage() {}
+
+func (x *Assignment) ProtoReflect() protoreflect.Message {
+	mi := &file_writer_cmdpb_commands_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Assignment.ProtoReflect.Descriptor instead.
+func (*Assignment) Descriptor() ([]byte, []int) {
+	return file_writer_cmdpb_commands_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *Assignment) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Assignment) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
+}
+
+// PushDirectory enters a new directory context.
+type PushDirectory struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Path string `protobuf:"bytes,1,opt,name=path,proto3" json:"path,omitempty"`
+}
+
+func (x *PushDirectory) Reset() {
+	*x = PushDirectory{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_writer_cmdpb_commands_proto_msgTypes[7]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PushDirectory) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PushDirectory) ProtoMessage() {}
+
+func (x *PushDirectory) ProtoReflect() protoreflect.Message {
+	mi := &file_writer_cmdpb_commands_proto_msgTypes[7]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PushDirectory.ProtoReflect.Descriptor instead.
+func (*PushDirectory) Descriptor() ([]byte, []int) {
+	return file_writer_cmdpb_commands_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *PushDirectory) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+// PopDirectory exits the current directory context.
+type PopDirectory struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Path string `protobuf:"bytes,1,opt,name=path,proto3" json:"path,omitempty"`
+}
+
+func (x *PopDirectory) Reset() {
+	*x = PopDirectory{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_writer_cmdpb_commands_proto_msgTypes[8]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PopDirectory) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PopDirectory) ProtoMessage() {}
+
+func (x *PopDirectory) ProtoReflect() protoreflect.Message {
+	mi := &file_writer_cmdpb_commands_proto_msgTypes[8]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PopDirectory.ProtoReflect.Descriptor instead.
+func (*PopDirectory) Descriptor() ([]byte, []int) {
+	return file_writer_cmdpb_commands_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *PopDirectory) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+// Block begins a branch of a compound statement.
+type Block struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Kind Block_Kind `protobuf:"varint,1,opt,name=kind,proto3,enum=llvmbzlgen.writer.Block_Kind" json:"kind,omitempty"`
+	// The loop variable of a FOR block.
+	Name string `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	// The condition of an IF or ELIF block, or the iterable of a FOR block.
+	Expr string `protobuf:"bytes,3,opt,name=expr,proto3" json:"expr,omitempty"`
+}
+
+func (x *Block) Reset() {
+	*x = Block{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_writer_cmdpb_commands_proto_msgTypes[9]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Block) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Block) ProtoMessage() {}
+
+func (x *Block) ProtoReflect() protoreflect.Message {
+	mi := &file_writer_cmdpb_commands_proto_msgTypes[9]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Block.ProtoReflect.Descriptor instead.
+func (*Block) Descriptor() ([]byte, []int) {
+	return file_writer_cmdpb_commands_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *Block) GetKind() Block_Kind {
+	if x != nil {
+		return x.Kind
+	}
+	return Block_UNKNOWN
+}
+
+func (x *Block) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Block) GetExpr() string {
+	if x != nil {
+		return x.Expr
+	}
+	return ""
+}
+
+// EndBlock ends the current compound statement.
+type EndBlock struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Kind Block_Kind `protobuf:"varint,1,opt,name=kind,proto3,enum=llvmbzlgen.writer.Block_Kind" json:"kind,omitempty"`
+}
+
+func (x *EndBlock) Reset() {
+	*x = EndBlock{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_writer_cmdpb_commands_proto_msgTypes[10]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *EndBlock) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EndBlock) ProtoMessage() {}
+
+func (x *EndBlock) ProtoReflect() protoreflect.Message {
+	mi := &file_writer_cmdpb_commands_proto_msgTypes[10]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EndBlock.ProtoReflect.Descriptor instead.
+func (*EndBlock) Descriptor() ([]byte, []int) {
+	return file_writer_cmdpb_commands_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *EndBlock) GetKind() Block_Kind {
+	if x != nil {
+		return x.Kind
+	}
+	return Block_UNKNOWN
+}
+
+var File_writer_cmdpb_commands_proto protoreflect.FileDescriptor
+
+var file_writer_cmdpb_commands_proto_rawDesc = []byte{
+	0x0a, 0x1b, 0x77, 0x72, 0x69, 0x74, 0x65, 0x72, 0x2f, 0x63, 0x6d, 0x64, 0x70, 0x62, 0x2f, 0x63,
+	0x6f, 0x6d, 0x6d, 0x61, 0x6e, 0x64, 0x73, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x11, 0x6c,
+	0x6c, 0x76, 0x6d, 0x62, 0x7a, 0x6c, 0x67, 0x65, 0x6e, 0x2e, 0x77, 0x72, 0x69, 0x74, 0x65, 0x72,
+	0x22, 0x41, 0x0a, 0x0d, 0x43, 0x6f, 0x6d, 0x6d, 0x61, 0x6e, 0x64, 0x53, 0x74, 0x72, 0x65, 0x61,
+	0x6d, 0x12, 0x30, 0x0a, 0x06, 0x65, 0x76, 0x65, 0x6e, 0x74, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28,
+	0x0b, 0x32, 0x18, 0x2e, 0x6c, 0x6c, 0x76, 0x6d, 0x62, 0x7a, 0x6c, 0x67, 0x65, 0x6e, 0x2e, 0x77,
+	0x72, 0x69, 0x74, 0x65, 0x72, 0x2e, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x52, 0x06, 0x65, 0x76, 0x65,
+	0x6e, 0x74, 0x73, 0x22, 0xbc, 0x04, 0x0a, 0x05, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x12, 0x2d, 0x0a,
+	0x04, 0x6c, 0x6f, 0x61, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x17, 0x2e, 0x6c, 0x6c,
+	0x76, 0x6d, 0x62, 0x7a, 0x6c, 0x67, 0x65, 0x6e, 0x2e, 0x77, 0x72, 0x69, 0x74, 0x65, 0x72, 0x2e,
+	0x4c, 0x6f, 0x61, 0x64, 0x48, 0x00, 0x52, 0x04, 0x6c, 0x6f, 0x61, 0x64, 0x12, 0x3b, 0x0a, 0x0b,
+	0x62, 0x65, 0x67, 0x69, 0x6e, 0x5f, 0x6d, 0x61, 0x63, 0x72, 0x6f, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x0b, 0x32, 0x18, 0x2e, 0x6c, 0x6c, 0x76, 0x6d, 0x62, 0x7a, 0x6c, 0x67, 0x65, 0x6e, 0x2e, 0x77,
+	0x72, 0x69, 0x74, 0x65, 0x72, 0x2e, 0x4d, 0x61, 0x63, 0x72, 0x6f, 0x48, 0x00, 0x52, 0x0a, 0x62,
+	0x65, 0x67, 0x69, 0x6e, 0x4d, 0x61, 0x63, 0x72, 0x6f, 0x12, 0x3a, 0x0a, 0x09, 0x65, 0x6e, 0x64,
+	0x5f, 0x6d, 0x61, 0x63, 0x72, 0x6f, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1b, 0x2e, 0x6c,
+	0x6c, 0x76, 0x6d, 0x62, 0x7a, 0x6c, 0x67, 0x65, 0x6e, 0x2e, 0x77, 0x72, 0x69, 0x74, 0x65, 0x72,
+	0x2e, 0x45, 0x6e, 0x64, 0x4d, 0x61, 0x63, 0x72, 0x6f, 0x48, 0x00, 0x52, 0x08, 0x65, 0x6e, 0x64,
+	0x4d, 0x61, 0x63, 0x72, 0x6f, 0x12, 0x36, 0x0a, 0x07, 0x63, 0x6f, 0x6d, 0x6d, 0x61, 0x6e, 0x64,
+	0x18, 0x04, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x6c, 0x6c, 0x76, 0x6d, 0x62, 0x7a, 0x6c,
+	0x67, 0x65, 0x6e, 0x2e, 0x77, 0x72, 0x69, 0x74, 0x65, 0x72, 0x2e, 0x43, 0x6f, 0x6d, 0x6d, 0x61,
+	0x6e, 0x64, 0x48, 0x00, 0x52, 0x07, 0x63, 0x6f, 0x6d, 0x6d, 0x61, 0x6e, 0x64, 0x12, 0x49, 0x0a,
+	0x0e, 0x70, 0x75, 0x73, 0x68, 0x5f, 0x64, 0x69, 0x72, 0x65, 0x63, 0x74, 0x6f, 0x72, 0x79, 0x18,
+	0x05, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x20, 0x2e, 0x6c, 0x6c, 0x76, 0x6d, 0x62, 0x7a, 0x6c, 0x67,
+	0x65, 0x6e, 0x2e, 0x77, 0x72, 0x69, 0x74, 0x65, 0x72, 0x2e, 0x50, 0x75, 0x73, 0x68, 0x44, 0x69,
+	0x72, 0x65, 0x63, 0x74, 0x6f, 0x72, 0x79, 0x48, 0x00, 0x52, 0x0d, 0x70, 0x75, 0x73, 0x68, 0x44,
+	0x69, 0x72, 0x65, 0x63, 0x74, 0x6f, 0x72, 0x79, 0x12, 0x46, 0x0a, 0x0d, 0x70, 0x6f, 0x70, 0x5f,
+	0x64, 0x69, 0x72, 0x65, 0x63, 0x74, 0x6f, 0x72, 0x79, 0x18, 0x06, 0x20, 0x01, 0x28, 0x0b, 0x32,
+	0x1f, 0x2e, 0x6c, 0x6c, 0x76, 0x6d, 0x62, 0x7a, 0x6c, 0x67, 0x65, 0x6e, 0x2e, 0x77, 0x72, 0x69,
+	0x74, 0x65, 0x72, 0x2e, 0x50, 0x6f, 0x70, 0x44, 0x69, 0x72, 0x65, 0x63, 0x74, 0x6f, 0x72, 0x79,
+	0x48, 0x00, 0x52, 0x0c, 0x70, 0x6f, 0x70, 0x44, 0x69, 0x72, 0x65, 0x63, 0x74, 0x6f, 0x72, 0x79,
+	0x12, 0x3b, 0x0a, 0x0b, 0x62, 0x65, 0x67, 0x69, 0x6e, 0x5f, 0x62, 0x6c, 0x6f, 0x63, 0x6b, 0x18,
+	0x07, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x18, 0x2e, 0x6c, 0x6c, 0x76, 0x6d, 0x62, 0x7a, 0x6c, 0x67,
+	0x65, 0x6e, 0x2e, 0x77, 0x72, 0x69, 0x74, 0x65, 0x72, 0x2e, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x48,
+	0x00, 0x52, 0x0a, 0x62, 0x65, 0x67, 0x69, 0x6e, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x12, 0x3a, 0x0a,
+	0x09, 0x65, 0x6e, 0x64, 0x5f, 0x62, 0x6c, 0x6f, 0x63, 0x6b, 0x18, 0x08, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x1b, 0x2e, 0x6c, 0x6c, 0x76, 0x6d, 0x62, 0x7a, 0x6c, 0x67, 0x65, 0x6e, 0x2e, 0x77, 0x72,
+	0x69, 0x74, 0x65, 0x72, 0x2e, 0x45, 0x6e, 0x64, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x48, 0x00, 0x52,
+	0x08, 0x65, 0x6e, 0x64, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x12, 0x3f, 0x0a, 0x0a, 0x61, 0x73, 0x73,
+	0x69, 0x67, 0x6e, 0x6d, 0x65, 0x6e, 0x74, 0x18, 0x09, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1d, 0x2e,
+	0x6c, 0x6c, 0x76, 0x6d, 0x62, 0x7a, 0x6c, 0x67, 0x65, 0x6e, 0x2e, 0x77, 0x72, 0x69, 0x74, 0x65,
+	0x72, 0x2e, 0x41, 0x73, 0x73, 0x69, 0x67, 0x6e, 0x6d, 0x65, 0x6e, 0x74, 0x48, 0x00, 0x52, 0x0a,
+	0x61, 0x73, 0x73, 0x69, 0x67, 0x6e, 0x6d, 0x65, 0x6e, 0x74, 0x42, 0x06, 0x0a, 0x04, 0x6b, 0x69,
+	0x6e, 0x64, 0x22, 0x34, 0x0a, 0x04, 0x4c, 0x6f, 0x61, 0x64, 0x12, 0x12, 0x0a, 0x04, 0x66, 0x69,
+	0x6c, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x66, 0x69, 0x6c, 0x65, 0x12, 0x18,
+	0x0a, 0x07, 0x73, 0x79, 0x6d, 0x62, 0x6f, 0x6c, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x09, 0x52,
+	0x07, 0x73, 0x79, 0x6d, 0x62, 0x6f, 0x6c, 0x73, 0x22, 0x1b, 0x0a, 0x05, 0x4d, 0x61, 0x63, 0x72,
+	0x6f, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x04, 0x6e, 0x61, 0x6d, 0x65, 0x22, 0x0a, 0x0a, 0x08, 0x45, 0x6e, 0x64, 0x4d, 0x61, 0x63, 0x72,
+	0x6f, 0x22, 0xac, 0x01, 0x0a, 0x07, 0x43, 0x6f, 0x6d, 0x6d, 0x61, 0x6e, 0x64, 0x12, 0x12, 0x0a,
+	0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d,
+	0x65, 0x12, 0x12, 0x0a, 0x04, 0x61, 0x72, 0x67, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x09, 0x52,
+	0x04, 0x61, 0x72, 0x67, 0x73, 0x12, 0x3e, 0x0a, 0x06, 0x6b, 0x77, 0x61, 0x72, 0x67, 0x73, 0x18,
+	0x03, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x26, 0x2e, 0x6c, 0x6c, 0x76, 0x6d, 0x62, 0x7a, 0x6c, 0x67,
+	0x65, 0x6e, 0x2e, 0x77, 0x72, 0x69, 0x74, 0x65, 0x72, 0x2e, 0x43, 0x6f, 0x6d, 0x6d, 0x61, 0x6e,
+	0x64, 0x2e, 0x4b, 0x77, 0x61, 0x72, 0x67, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x52, 0x06, 0x6b,
+	0x77, 0x61, 0x72, 0x67, 0x73, 0x1a, 0x39, 0x0a, 0x0b, 0x4b, 0x77, 0x61, 0x72, 0x67, 0x73, 0x45,
+	0x6e, 0x74, 0x72, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01,
+	0x22, 0x36, 0x0a, 0x0a, 0x41, 0x73, 0x73, 0x69, 0x67, 0x6e, 0x6d, 0x65, 0x6e, 0x74, 0x12, 0x12,
+	0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61,
+	0x6d, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x22, 0x23, 0x0a, 0x0d, 0x50, 0x75, 0x73, 0x68,
+	0x44, 0x69, 0x72, 0x65, 0x63, 0x74, 0x6f, 0x72, 0x79, 0x12, 0x12, 0x0a, 0x04, 0x70, 0x61, 0x74,
+	0x68, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x70, 0x61, 0x74, 0x68, 0x22, 0x22, 0x0a,
+	0x0c, 0x50, 0x6f, 0x70, 0x44, 0x69, 0x72, 0x65, 0x63, 0x74, 0x6f, 0x72, 0x79, 0x12, 0x12, 0x0a,
+	0x04, 0x70, 0x61, 0x74, 0x68, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x70, 0x61, 0x74,
+	0x68, 0x22, 0x9c, 0x01, 0x0a, 0x05, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x12, 0x31, 0x0a, 0x04, 0x6b,
+	0x69, 0x6e, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x1d, 0x2e, 0x6c, 0x6c, 0x76, 0x6d,
+	0x62, 0x7a, 0x6c, 0x67, 0x65, 0x6e, 0x2e, 0x77, 0x72, 0x69, 0x74, 0x65, 0x72, 0x2e, 0x42, 0x6c,
+	0x6f, 0x63, 0x6b, 0x2e, 0x4b, 0x69, 0x6e, 0x64, 0x52, 0x04, 0x6b, 0x69, 0x6e, 0x64, 0x12, 0x12,
+	0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61,
+	0x6d, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x65, 0x78, 0x70, 0x72, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x04, 0x65, 0x78, 0x70, 0x72, 0x22, 0x38, 0x0a, 0x04, 0x4b, 0x69, 0x6e, 0x64, 0x12, 0x0b,
+	0x0a, 0x07, 0x55, 0x4e, 0x4b, 0x4e, 0x4f, 0x57, 0x4e, 0x10, 0x00, 0x12, 0x06, 0x0a, 0x02, 0x49,
+	0x46, 0x10, 0x01, 0x12, 0x08, 0x0a, 0x04, 0x45, 0x4c, 0x49, 0x46, 0x10, 0x02, 0x12, 0x08, 0x0a,
+	0x04, 0x45, 0x4c, 0x53, 0x45, 0x10, 0x03, 0x12, 0x07, 0x0a, 0x03, 0x46, 0x4f, 0x52, 0x10, 0x04,
+	0x22, 0x3d, 0x0a, 0x08, 0x45, 0x6e, 0x64, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x12, 0x31, 0x0a, 0x04,
+	0x6b, 0x69, 0x6e, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x1d, 0x2e, 0x6c, 0x6c, 0x76,
+	0x6d, 0x62, 0x7a, 0x6c, 0x67, 0x65, 0x6e, 0x2e, 0x77, 0x72, 0x69, 0x74, 0x65, 0x72, 0x2e, 0x42,
+	0x6c, 0x6f, 0x63, 0x6b, 0x2e, 0x4b, 0x69, 0x6e, 0x64, 0x52, 0x04, 0x6b, 0x69, 0x6e, 0x64, 0x42,
+	0x2a, 0x5a, 0x28, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x6b, 0x79,
+	0x74, 0x68, 0x65, 0x2f, 0x6c, 0x6c, 0x76, 0x6d, 0x62, 0x7a, 0x6c, 0x67, 0x65, 0x6e, 0x2f, 0x77,
+	0x72, 0x69, 0x74, 0x65, 0x72, 0x2f, 0x63, 0x6d, 0x64, 0x70, 0x62, 0x62, 0x06, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x33,
+}
+
+var (
+	file_writer_cmdpb_commands_proto_rawDescOnce sync.Once
+	file_writer_cmdpb_commands_proto_rawDescData = file_writer_cmdpb_commands_proto_rawDesc
+)
+
+func file_writer_cmdpb_commands_proto_rawDescGZIP() []byte {
+	file_writer_cmdpb_commands_proto_rawDescOnce.Do(func() {
+		file_writer_cmdpb_commands_proto_rawDescData = protoimpl.X.CompressGZIP(file_writer_cmdpb_commands_proto_rawDescData)
+	})
+	return file_writer_cmdpb_commands_proto_rawDescData
+}
+
+var file_writer_cmdpb_commands_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_writer_cmdpb_commands_proto_msgTypes = make([]protoimpl.MessageInfo, 12)
+var file_writer_cmdpb_commands_proto_goTypes = []interface{}{
+	(Block_Kind)(0),       // 0: llvmbzlgen.writer.Block.Kind
+	(*CommandStream)(nil), // 1: llvmbzlgen.writer.CommandStream
+	(*Event)(nil),         // 2: llvmbzlgen.writer.Event
+	(*Load)(nil),          // 3: llvmbzlgen.writer.Load
+	(*Macro)(nil),         // 4: llvmbzlgen.writer.Macro
+	(*EndMacro)(nil),      // 5: llvmbzlgen.writer.EndMacro
+	(*Command)(nil),       // 6: llvmbzlgen.writer.Command
+	(*Assignment)(nil),    // 7: llvmbzlgen.writer.Assignment
+	(*PushDirectory)(nil), // 8: llvmbzlgen.writer.PushDirectory
+	(*PopDirectory)(nil),  // 9: llvmbzlgen.writer.PopDirectory
+	(*Block)(nil),         // 10: llvmbzlgen.writer.Block
+	(*EndBlock)(nil),      // 11: llvmbzlgen.writer.EndBlock
+	nil,                   // 12: llvmbzlgen.writer.Command.KwargsEntry
+}
+var file_writer_cmdpb_commands_proto_depIdxs = []int32{
+	2,  // 0: llvmbzlgen.writer.CommandStream.events:type_name -> llvmbzlgen.writer.Event
+	3,  // 1: llvmbzlgen.writer.Event.load:type_name -> llvmbzlgen.writer.Load
+	4,  // 2: llvmbzlgen.writer.Event.begin_macro:type_name -> llvmbzlgen.writer.Macro
+	5,  // 3: llvmbzlgen.writer.Event.end_macro:type_name -> llvmbzlgen.writer.EndMacro
+	6,  // 4: llvmbzlgen.writer.Event.command:type_name -> llvmbzlgen.writer.Command
+	8,  // 5: llvmbzlgen.writer.Event.push_directory:type_name -> llvmbzlgen.writer.PushDirectory
+	9,  // 6: llvmbzlgen.writer.Event.pop_directory:type_name -> llvmbzlgen.writer.PopDirectory
+	10, // 7: llvmbzlgen.writer.Event.begin_block:type_name -> llvmbzlgen.writer.Block
+	11, // 8: llvmbzlgen.writer.Event.end_block:type_name -> llvmbzlgen.writer.EndBlock
+	7,  // 9: llvmbzlgen.writer.Event.assignment:type_name -> llvmbzlgen.writer.Assignment
+	12, // 10: llvmbzlgen.writer.Command.kwargs:type_name -> llvmbzlgen.writer.Command.KwargsEntry
+	0,  // 11: llvmbzlgen.writer.Block.kind:type_name -> llvmbzlgen.writer.Block.Kind
+	0,  // 12: llvmbzlgen.writer.EndBlock.kind:type_name -> llvmbzlgen.writer.Block.Kind
+	13, // [13:13] is the sub-list for method output_type
+	13, // [13:13] is the sub-list for method input_type
+	13, // [13:13] is the sub-list for extension type_name
+	13, // [13:13] is the sub-list for extension extendee
+	0,  // [0:13] is the sub-list for field type_name
+}
+
+func init() { file_writer_cmdpb_commands_proto_init() }
+func file_writer_cmdpb_commands_proto_init() {
+	if File_writer_cmdpb_commands_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_writer_cmdpb_commands_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*CommandStream); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_writer_cmdpb_commands_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Event); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_writer_cmdpb_commands_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Load); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_writer_cmdpb_commands_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Macro); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_writer_cmdpb_commands_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*EndMacro); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_writer_cmdpb_commands_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Command); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_writer_cmdpb_commands_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Assignment); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_writer_cmdpb_commands_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*PushDirectory); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_writer_cmdpb_commands_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*PopDirectory); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_writer_cmdpb_commands_proto_msgTypes[9].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Block); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_writer_cmdpb_commands_proto_msgTypes[10].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*EndBlock); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	file_writer_cmdpb_commands_proto_msgTypes[1].OneofWrappers = []interface{}{
+		(*Event_Load)(nil),
+		(*Event_BeginMacro)(nil),
+		(*Event_EndMacro)(nil),
+		(*Event_Command)(nil),
+		(*Event_PushDirectory)(nil),
+		(*Event_PopDirectory)(nil),
+		(*Event_BeginBlock)(nil),
+		(*Event_EndBlock)(nil),
+		(*Event_Assignment)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_writer_cmdpb_commands_proto_rawDesc,
+			NumEnums:      1,
+			NumMessages:   12,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_writer_cmdpb_commands_proto_goTypes,
+		DependencyIndexes: file_writer_cmdpb_commands_proto_depIdxs,
+		EnumInfos:         file_writer_cmdpb_commands_proto_enumTypes,
+		MessageInfos:      file_writer_cmdpb_commands_proto_msgTypes,
+	}.Build()
+	File_writer_cmdpb_commands_proto = out.File
+	file_writer_cmdpb_commands_proto_rawDesc = nil
+	file_writer_cmdpb_commands_proto_goTypes = nil
+	file_writer_cmdpb_commands_proto_depIdxs = nil
+}
@@ -0,0 +1,169 @@
+/*
+ * Copyright 2019 The Kythe Authors. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package cmdpb defines a protocol buffer representation of the command stream
+// written to a writer.MacroWriter, along with a recorder which produces it.
+package cmdpb
+
+import (
+	"errors"
+	"io"
+
+	"github.com/kythe/llvmbzlgen/writer"
+	"google.golang.org/protobuf/proto"
+)
+
+//go:generate protoc --go_out=paths=source_relative:../.. -I../.. writer/cmdpb/commands.proto
+
+// Recorder is a writer.MacroWriter which records each call as an Event in a CommandStream.
+// The stream is serialized to the underlying output on each Flush.
+type Recorder struct {
+	w        io.Writer
+	stream   *CommandStream
+	dirStack []string
+}
+
+var _ writer.MacroWriter = (*Recorder)(nil)
+
+// NewRecorder creates a new Recorder writing to the provided output.
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{w: w, stream: &CommandStream{}}
+}
+
+// WriteLoad records a load of the given symbols from file.
+func (r *Recorder) WriteLoad(file string, symbols ...string) error {
+	return r.record(&Event{Kind: &Event_Load{&Load{File: file, Symbols: symbols}}})
+}
+
+// BeginMacro records the start of a macro.
+func (r *Recorder) BeginMacro(name string) error {
+	return r.record(&Event{Kind: &Event_BeginMacro{&Macro{Name: name}}})
+}
+
+// EndMacro records the end of the current macro.
+func (r *Recorder) EndMacro() error {
+	return r.record(&Event{Kind: &Event_EndMacro{&EndMacro{}}})
+}
+
+// BeginIf records the start of an if statement.
+func (r *Recorder) BeginIf(cond interface{}) error {
+	return r.beginBlock(Block_IF, "", cond)
+}
+
+// ElseIf records the start of an elif branch.
+func (r *Recorder) ElseIf(cond interface{}) error {
+	return r.beginBlock(Block_ELIF, "", cond)
+}
+
+// Else records the start of an else branch.
+func (r *Recorder) Else() error {
+	return r.record(&Event{Kind: &Event_BeginBlock{&Block{Kind: Block_ELSE}}})
+}
+
+// EndIf records the end of an if statement.
+func (r *Recorder) EndIf() error {
+	return r.record(&Event{Kind: &Event_EndBlock{&EndBlock{Kind: Block_IF}}})
+}
+
+// BeginFor records the start of a for loop.
+func (r *Recorder) BeginFor(name string, iterable interface{}) error {
+	return r.beginBlock(Block_FOR, name, iterable)
+}
+
+// EndFor records the end of a for loop.
+func (r *Recorder) EndFor() error {
+	return r.record(&Event{Kind: &Event_EndBlock{&EndBlock{Kind: Block_FOR}}})
+}
+
+// PushDirectory records entering a directory.
+func (r *Recorder) PushDirectory(path string) error {
+	r.dirStack = append(r.dirStack, path)
+	return r.record(&Event{Kind: &Event_PushDirectory{&PushDirectory{Path: path}}})
+}
+
+// PopDirectory records exiting the current directory, returning its path.
+func (r *Recorder) PopDirectory() (string, error) {
+	if len(r.dirStack) == 0 {
+		return "", errors.New("directory stack is empty")
+	}
+	path := r.dirStack[len(r.dirStack)-1]
+	r.dirStack = r.dirStack[:len(r.dirStack)-1]
+	return path, r.record(&Event{Kind: &Event_PopDirectory{&PopDirectory{Path: path}}})
+}
+
+// WriteCommand records an invocation of the provided command and arguments.
+func (r *Recorder) WriteCommand(cmd string, args ...interface{}) error {
+	return r.WriteCommandKw(cmd, nil, args...)
+}
+
+// WriteCommandKw records an invocation of the provided command with positional and keyword arguments.
+func (r *Recorder) WriteCommandKw(cmd string, kwargs map[string]interface{}, args ...interface{}) error {
+	c := &Command{Name: cmd}
+	for _, arg := range args {
+		val, err := writer.Marshal(arg)
+		if err != nil {
+			return err
+		}
+		c.Args = append(c.Args, string(val))
+	}
+	for name, arg := range kwargs {
+		val, err := writer.Marshal(arg)
+		if err != nil {
+			return err
+		}
+		if c.Kwargs == nil {
+			c.Kwargs = make(map[string]string, len(kwargs))
+		}
+		c.Kwargs[name] = string(val)
+	}
+	return r.record(&Event{Kind: &Event_Command{c}})
+}
+
+// WriteAssignment records an assignment of the provided value to the named variable.
+func (r *Recorder) WriteAssignment(name string, value interface{}) error {
+	val, err := writer.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return r.record(&Event{Kind: &Event_Assignment{&Assignment{Name: name, Value: string(val)}}})
+}
+
+// Flush writes the serialized stream of events recorded since the previous Flush.
+// As repeated fields are concatenated when parsed, the complete output is itself
+// a valid serialized CommandStream.
+func (r *Recorder) Flush() error {
+	data, err := proto.Marshal(r.stream)
+	if err != nil {
+		return err
+	}
+	r.stream = &CommandStream{}
+	_, err = r.w.Write(data)
+	return err
+}
+
+// beginBlock records the start of a compound statement branch with the given expression.
+func (r *Recorder) beginBlock(kind Block_Kind, name string, expr interface{}) error {
+	val, err := writer.Marshal(expr)
+	if err != nil {
+		return err
+	}
+	return r.record(&Event{Kind: &Event_BeginBlock{&Block{Kind: kind, Name: name, Expr: string(val)}}})
+}
+
+func (r *Recorder) record(ev *Event) error {
+	r.stream.Events = append(r.stream.Events, ev)
+	return nil
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright 2019 The Kythe Authors. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmdpb
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/testing/protocmp"
+)
+
+func TestRoundTrip(t *testing.T) {
+	var b bytes.Buffer
+	r := NewRecorder(&b)
+	if err := r.BeginMacro("hello_world"); err != nil {
+		t.Fatal("Unexpected error recording macro: ", err)
+	}
+	if err := r.PushDirectory("lib"); err != nil {
+		t.Fatal("Unexpected error recording directory: ", err)
+	}
+	if err := r.WriteCommandKw("cc_library", map[string]interface{}{"name": "lib"}, []string{"a.cc"}); err != nil {
+		t.Fatal("Unexpected error recording command: ", err)
+	}
+	if _, err := r.PopDirectory(); err != nil {
+		t.Fatal("Unexpected error recording directory: ", err)
+	}
+	if err := r.Flush(); err != nil {
+		t.Fatal("Unexpected error flushing recorder: ", err)
+	}
+	if err := r.EndMacro(); err != nil {
+		t.Fatal("Unexpected error ending macro: ", err)
+	}
+	if err := r.Flush(); err != nil {
+		t.Fatal("Unexpected error flushing recorder: ", err)
+	}
+
+	var got CommandStream
+	if err := proto.Unmarshal(b.Bytes(), &got); err != nil {
+		t.Fatal("Unexpected error parsing stream: ", err)
+	}
+	expected := &CommandStream{Events: []*Event{
+		{Kind: &Event_BeginMacro{&Macro{Name: "hello_world"}}},
+		{Kind: &Event_PushDirectory{&PushDirectory{Path: "lib"}}},
+		{Kind: &Event_Command{&Command{
+			Name:   "cc_library",
+			Args:   []string{`["a.cc"]`},
+			Kwargs: map[string]string{"name": `"lib"`},
+		}}},
+		{Kind: &Event_PopDirectory{&PopDirectory{Path: "lib"}}},
+		{Kind: &Event_EndMacro{&EndMacro{}}},
+	}}
+	if diff := cmp.Diff(expected, &got, protocmp.Transform()); diff != "" {
+		t.Error("Unexpected stream:\n", diff)
+	}
+}
@@ -0,0 +1,261 @@
+/*
+ * Copyright 2019 The Kythe Authors. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package writer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"bitbucket.org/creachadair/stringset"
+)
+
+// Expr is any value which may be marshaled as a Starlark expression,
+// including the expression nodes below as well as Raw, Var and Concat.
+type Expr = interface{}
+
+var binaryOperators = stringset.New(
+	"or", "and", "==", "!=", "<", ">", "<=", ">=", "in", "not in",
+	"|", "^", "&", "<<", ">>", "+", "-", "*", "/", "//", "%",
+)
+
+var unaryOperators = stringset.New("not", "-", "+", "~")
+
+// Call is a function call expression: Func(Args..., name = Kwargs[name]...).
+// Keyword arguments are written in sorted order.
+type Call struct {
+	Func   Expr
+	Args   []Expr
+	Kwargs map[string]Expr
+}
+
+// MarshalStarlark implements Marshaler.
+func (c Call) MarshalStarlark() ([]byte, error) {
+	return c.marshalStarlark(MarshalOptions{})
+}
+
+func (c Call) marshalStarlark(o MarshalOptions) ([]byte, error) {
+	fn, err := marshalOperand(o, c.Func)
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, 0, len(c.Args)+len(c.Kwargs))
+	for _, arg := range c.Args {
+		val, err := o.Marshal(arg)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, string(val))
+	}
+	names := make([]string, 0, len(c.Kwargs))
+	for name := range c.Kwargs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		val, err := o.Marshal(keywordArg{name, c.Kwargs[name]})
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, string(val))
+	}
+	return []byte(fn + "(" + strings.Join(args, ", ") + ")"), nil
+}
+
+// Attr is an attribute selection expression: X.Name.
+type Attr struct {
+	X    Expr
+	Name string
+}
+
+// MarshalStarlark implements Marshaler.
+func (a Attr) MarshalStarlark() ([]byte, error) {
+	return a.marshalStarlark(MarshalOptions{})
+}
+
+func (a Attr) marshalStarlark(o MarshalOptions) ([]byte, error) {
+	x, err := marshalOperand(o, a.X)
+	if err != nil {
+		return nil, err
+	}
+	name, err := identName(a.Name)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(x + "." + name), nil
+}
+
+// BinOp is a binary operator expression: X Op Y.
+// Operands which are themselves binary operations are parenthesized.
+type BinOp struct {
+	Op   string
+	X, Y Expr
+}
+
+// MarshalStarlark implements Marshaler.
+func (b BinOp) MarshalStarlark() ([]byte, error) {
+	return b.marshalStarlark(MarshalOptions{})
+}
+
+func (b BinOp) marshalStarlark(o MarshalOptions) ([]byte, error) {
+	if !binaryOperators.Contains(b.Op) {
+		return nil, fmt.Errorf("invalid Starlark binary operator: %s", b.Op)
+	}
+	x, err := marshalOperand(o, b.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := marshalOperand(o, b.Y)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(x + " " + b.Op + " " + y), nil
+}
+
+// UnaryOp is a unary operator expression: Op X.
+// Operands which are themselves binary operations are parenthesized.
+type UnaryOp struct {
+	Op string
+	X  Expr
+}
+
+// MarshalStarlark implements Marshaler.
+func (u UnaryOp) MarshalStarlark() ([]byte, error) {
+	return u.marshalStarlark(MarshalOptions{})
+}
+
+func (u UnaryOp) marshalStarlark(o MarshalOptions) ([]byte, error) {
+	if !unaryOperators.Contains(u.Op) {
+		return nil, fmt.Errorf("invalid Starlark unary operator: %s", u.Op)
+	}
+	x, err := marshalOperand(o, u.X)
+	if err != nil {
+		return nil, err
+	}
+	if u.Op == "not" {
+		return []byte("not " + x), nil
+	}
+	return []byte(u.Op + x), nil
+}
+
+// Index is an index expression: X[I].
+type Index struct {
+	X, I Expr
+}
+
+// MarshalStarlark implements Marshaler.
+func (ix Index) MarshalStarlark() ([]byte, error) {
+	return ix.marshalStarlark(MarshalOptions{})
+}
+
+func (ix Index) marshalStarlark(o MarshalOptions) ([]byte, error) {
+	x, err := marshalOperand(o, ix.X)
+	if err != nil {
+		return nil, err
+	}
+	i, err := o.Marshal(ix.I)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(x + "[" + string(i) + "]"), nil
+}
+
+// Slice is a slice expression: X[Lo:Hi:Step].
+// Nil bounds are omitted, as is the step if nil.
+type Slice struct {
+	X, Lo, Hi, Step Expr
+}
+
+// MarshalStarlark implements Marshaler.
+func (s Slice) MarshalStarlark() ([]byte, error) {
+	return s.marshalStarlark(MarshalOptions{})
+}
+
+func (s Slice) marshalStarlark(o MarshalOptions) ([]byte, error) {
+	x, err := marshalOperand(o, s.X)
+	if err != nil {
+		return nil, err
+	}
+	bounds := []Expr{s.Lo, s.Hi}
+	if s.Step != nil {
+		bounds = append(bounds, s.Step)
+	}
+	parts := make([]string, len(bounds))
+	for i, b := range bounds {
+		if b == nil {
+			continue
+		}
+		val, err := o.Marshal(b)
+		if err != nil {
+			return nil, err
+		}
+		parts[i] = string(val)
+	}
+	return []byte(x + "[" + strings.Join(parts, ":") + "]"), nil
+}
+
+// Comprehension is a list comprehension with a single loop: [Body for Var in In if If].
+// The condition is omitted if nil.
+type Comprehension struct {
+	Body Expr
+	Var  string
+	In   Expr
+	If   Expr
+}
+
+// MarshalStarlark implements Marshaler.
+func (c Comprehension) MarshalStarlark() ([]byte, error) {
+	return c.marshalStarlark(MarshalOptions{})
+}
+
+func (c Comprehension) marshalStarlark(o MarshalOptions) ([]byte, error) {
+	body, err := o.Marshal(c.Body)
+	if err != nil {
+		return nil, err
+	}
+	name, err := identName(c.Var)
+	if err != nil {
+		return nil, err
+	}
+	in, err := marshalOperand(o, c.In)
+	if err != nil {
+		return nil, err
+	}
+	text := "[" + string(body) + " for " + name + " in " + in
+	if c.If != nil {
+		cond, err := o.Marshal(c.If)
+		if err != nil {
+			return nil, err
+		}
+		text += " if " + string(cond)
+	}
+	return []byte(text + "]"), nil
+}
+
+// marshalOperand marshals x for use as the operand of another expression,
+// parenthesizing binary and unary operations.
+func marshalOperand(o MarshalOptions, x Expr) (string, error) {
+	val, err := o.Marshal(x)
+	if err != nil {
+		return "", err
+	}
+	switch x.(type) {
+	case BinOp, UnaryOp, ListPlusSelect:
+		return "(" + string(val) + ")", nil
+	}
+	return string(val), nil
+}
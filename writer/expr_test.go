@@ -0,0 +1,67 @@
+/*
+ * Copyright 2019 The Kythe Authors. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package writer
+
+import "testing"
+
+func TestMarshalExpr(t *testing.T) {
+	tests := []struct {
+		v Expr
+		e string
+	}{
+		{Call{Func: Var("glob"), Args: []Expr{[]string{"*.cc"}}, Kwargs: map[string]Expr{"exclude": []string{}}}, `glob(["*.cc"], exclude = [])`},
+		{Attr{Var("ctx"), "srcs"}, "ctx.srcs"},
+		{Call{Func: Attr{Var("ctx"), "push"}}, "ctx.push()"},
+		{BinOp{"+", Var("a"), BinOp{"*", Var("b"), 2}}, "a + (b * 2)"},
+		{BinOp{"not in", "x", Var("xs")}, `"x" not in xs`},
+		{Index{Var("srcs"), 0}, "srcs[0]"},
+		{Index{BinOp{"+", Var("a"), Var("b")}, -1}, "(a + b)[-1]"},
+		{Slice{Var("deps"), 1, 5, 2}, "deps[1:5:2]"},
+		{Slice{X: Var("deps"), Lo: 1}, "deps[1:]"},
+		{Slice{X: Var("x"), Hi: 2}, "x[:2]"},
+		{Slice{X: Var("x"), Step: -1}, "x[::-1]"},
+		{Attr{Index{Var("xs"), 0}, "name"}, "xs[0].name"},
+		{UnaryOp{"not", Var("a")}, "not a"},
+		{Comprehension{Body: Var("x"), Var: "x", In: Var("xs")}, "[x for x in xs]"},
+		{Comprehension{Body: Attr{Var("t"), "name"}, Var: "t", In: BinOp{"+", Var("a"), Var("b")}, If: BinOp{"not in", Var("t"), []string{"c"}}}, `[t.name for t in (a + b) if t not in ["c"]]`},
+		{UnaryOp{"-", 1}, "-1"},
+		{UnaryOp{"not", BinOp{"and", Var("a"), Var("b")}}, "not (a and b)"},
+		{BinOp{"or", UnaryOp{"not", Var("a")}, Var("b")}, "(not a) or b"},
+	}
+	for _, test := range tests {
+		a, err := Marshal(test.v)
+		if err != nil {
+			t.Errorf("Failed to marshal %#v: %v", test.v, err)
+		} else if string(a) != test.e {
+			t.Errorf("Expected %#v but got %#v", test.e, string(a))
+		}
+	}
+}
+
+func TestInvalidExpr(t *testing.T) {
+	for _, v := range []Expr{
+		BinOp{"=", Var("a"), 1},
+		UnaryOp{"!", Var("a")},
+		Comprehension{Body: Var("x"), Var: "not valid", In: Var("xs")},
+		Attr{Var("a"), "not valid"},
+		Index{Var("a"), make(chan int)},
+	} {
+		if _, err := Marshal(v); err == nil {
+			t.Errorf("Unexpected success marshaling %#v", v)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+/*
+ * Copyright 2019 The Kythe Authors. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package writer
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"bitbucket.org/creachadair/stringset"
+)
+
+var invalidIdentChars = regexp.MustCompile(`\W`)
+
+// SanitizeIdent returns a valid Starlark identifier derived from s by replacing
+// invalid characters with underscores, prefixing a leading digit with an underscore
+// and suffixing reserved words with an underscore.
+func SanitizeIdent(s string) string {
+	s = invalidIdentChars.ReplaceAllString(s, "_")
+	if s == "" || (s[0] >= '0' && s[0] <= '9') {
+		s = "_" + s
+	}
+	if starlarkReserved.Contains(s) {
+		s += "_"
+	}
+	return s
+}
+
+// IdentName returns the Starlark identifier with which s is written,
+// suffixing reserved words with an underscore.
+// Unlike SanitizeIdent, it returns an error if s is not a valid identifier.
+func IdentName(s string) (string, error) {
+	if !validIdentPattern.MatchString(s) {
+		return "", fmt.Errorf("invalid Starlark identifier: %s", s)
+	}
+	if starlarkReserved.Contains(s) {
+		return s + "_", nil
+	}
+	return s, nil
+}
+
+// IdentAllocator allocates unique, valid Starlark identifiers, recording
+// the original name of any which had to be renamed.
+type IdentAllocator struct {
+	used    stringset.Set
+	renames map[string]string
+}
+
+// NewIdentAllocator returns a new, empty, IdentAllocator.
+func NewIdentAllocator() *IdentAllocator {
+	return &IdentAllocator{used: stringset.New(), renames: make(map[string]string)}
+}
+
+// Allocate returns a sanitized identifier for name which is distinct from
+// all previously allocated identifiers, by appending a numeric suffix if necessary.
+func (a *IdentAllocator) Allocate(name string) string {
+	ident := SanitizeIdent(name)
+	if a.used.Contains(ident) {
+		base := ident
+		for i := 2; a.used.Contains(ident); i++ {
+			ident = base + "_" + strconv.Itoa(i)
+		}
+	}
+	a.used.Add(ident)
+	if ident != name {
+		a.renames[name] = ident
+	}
+	return ident
+}
+
+// Renames returns a map from the original names to the identifiers allocated
+// for them, for each name which was renamed.
+func (a *IdentAllocator) Renames() map[string]string {
+	renames := make(map[string]string, len(a.renames))
+	for k, v := range a.renames {
+		renames[k] = v
+	}
+	return renames
+}
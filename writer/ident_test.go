@@ -0,0 +1,82 @@
+/*
+ * Copyright 2019 The Kythe Authors. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package writer
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSanitizeIdent(t *testing.T) {
+	tests := map[string]string{
+		"llvm_foo":   "llvm_foo",
+		"llvm-foo":   "llvm_foo",
+		"llvm.foo+1": "llvm_foo_1",
+		"3rdparty":   "_3rdparty",
+		"":           "_",
+		"return":     "return_",
+	}
+	for input, expected := range tests {
+		if actual := SanitizeIdent(input); actual != expected {
+			t.Errorf("SanitizeIdent(%#v): expected %#v but got %#v", input, expected, actual)
+		}
+	}
+}
+
+func TestIdentName(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		valid    bool
+	}{
+		{"llvm_foo", "llvm_foo", true},
+		{"_private", "_private", true},
+		{"return", "return_", true},
+		{"load", "load_", true},
+		{"llvm-foo", "", false},
+		{"3rdparty", "", false},
+		{"", "", false},
+	}
+	for _, test := range tests {
+		actual, err := IdentName(test.input)
+		if (err == nil) != test.valid {
+			t.Errorf("IdentName(%#v): unexpected error result: %v", test.input, err)
+		} else if actual != test.expected {
+			t.Errorf("IdentName(%#v): expected %#v but got %#v", test.input, test.expected, actual)
+		}
+		internal, ierr := identName(test.input)
+		if internal != actual || (ierr == nil) != (err == nil) {
+			t.Errorf("IdentName(%#v) = %#v, %v differs from identName: %#v, %v", test.input, actual, err, internal, ierr)
+		}
+	}
+}
+
+func TestIdentAllocator(t *testing.T) {
+	a := NewIdentAllocator()
+	var actual []string
+	for _, name := range []string{"llvm_foo", "llvm-foo", "llvm.foo", "other"} {
+		actual = append(actual, a.Allocate(name))
+	}
+	if diff := cmp.Diff([]string{"llvm_foo", "llvm_foo_2", "llvm_foo_3", "other"}, actual); diff != "" {
+		t.Error("Unexpected identifiers:\n", diff)
+	}
+	expected := map[string]string{"llvm-foo": "llvm_foo_2", "llvm.foo": "llvm_foo_3"}
+	if diff := cmp.Diff(expected, a.Renames()); diff != "" {
+		t.Error("Unexpected renames:\n", diff)
+	}
+}
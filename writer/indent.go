@@ -0,0 +1,87 @@
+/*
+ * Copyright 2019 The Kythe Authors. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package writer
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DetectIndent returns the unit of indentation used by the Starlark file read from r,
+// such as a tab or two or four spaces, so that a regenerated file may match its style.
+// The unit is the most common increase in indentation between consecutive lines,
+// or the empty string if r has no indented lines.
+func DetectIndent(r io.Reader) (string, error) {
+	var tabs, spaces int
+	deltas := make(map[int]int)
+	prev := 0
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := s.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "\t") {
+			tabs++
+			continue
+		}
+		n := len(line) - len(strings.TrimLeft(line, " "))
+		if n > 0 {
+			spaces++
+		}
+		if n > prev {
+			deltas[n-prev]++
+		}
+		prev = n
+	}
+	if err := s.Err(); err != nil {
+		return "", err
+	}
+	if tabs == 0 && spaces == 0 {
+		return "", nil
+	}
+	if tabs >= spaces {
+		return "\t", nil
+	}
+	best := 0
+	for delta, count := range deltas {
+		if count > deltas[best] || (count == deltas[best] && delta < best) {
+			best = delta
+		}
+	}
+	return strings.Repeat(" ", best), nil
+}
+
+// SetIndent sets the unit of indentation used by the writer, which must consist only of
+// spaces or tabs. As it affects subsequent output, it may not be changed within a macro.
+func (sw *StarlarkWriter) SetIndent(unit string) error {
+	if sw.currentMacro != "" {
+		return errors.New("indentation cannot be changed within a macro")
+	}
+	if unit == "" || strings.Trim(unit, " \t") != "" {
+		return fmt.Errorf("invalid indentation: %q", unit)
+	}
+	if sw.marshal.Indent != "" {
+		// Values are wrapped using the writer's indentation.
+		sw.marshal.Indent = unit
+	}
+	sw.indent = unit
+	return nil
+}
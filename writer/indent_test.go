@@ -0,0 +1,96 @@
+/*
+ * Copyright 2019 The Kythe Authors. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package writer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDetectIndent(t *testing.T) {
+	tests := map[string]string{
+		"tabs": "def hello_world(ctx):\n" +
+			"\tif x:\n" +
+			"\t\tctx.run(ctx)\n" +
+			"\treturn ctx\n",
+		"  ": "def hello_world(ctx):\n" +
+			"  ctx.run(ctx, [\n" +
+			"      \"aligned\",\n" +
+			"  ])\n" +
+			"  for x in y:\n" +
+			"    ctx.run(ctx, x)\n" +
+			"\n" +
+			"  return ctx\n",
+		"    ": "def hello_world(ctx):\n" +
+			"    ctx.run(ctx)\n" +
+			"    return ctx\n",
+		"": "load(\"//a:b.bzl\", \"c\")\n",
+	}
+	for expected, input := range tests {
+		if expected == "tabs" {
+			expected = "\t"
+		}
+		actual, err := DetectIndent(strings.NewReader(input))
+		if err != nil {
+			t.Errorf("Unexpected error detecting indentation of %q: %v", input, err)
+		} else if actual != expected {
+			t.Errorf("Expected %q but got %q", expected, actual)
+		}
+	}
+}
+
+func TestSetIndent(t *testing.T) {
+	var b strings.Builder
+	writer := NewStarlarkWriter(&b, WrapValues(true))
+	if err := writer.SetIndent("  "); err != nil {
+		t.Fatal("Unexpected error setting indentation: ", err)
+	}
+	if err := writer.BeginMacro("hello_world"); err != nil {
+		t.Fatal("Unexpected error writing macro: ", err)
+	}
+	if err := writer.SetIndent("\t"); err == nil {
+		t.Error("Indentation changed within a macro")
+	}
+	if err := writer.BeginIf(Var("x")); err != nil {
+		t.Fatal("Unexpected error writing if: ", err)
+	}
+	if err := writer.WriteCommand("run", []string{"a"}); err != nil {
+		t.Fatal("Unexpected error writing command: ", err)
+	}
+	if err := writer.EndIf(); err != nil {
+		t.Fatal("Unexpected error ending if: ", err)
+	}
+	if err := writer.EndMacro(); err != nil {
+		t.Fatal("Unexpected error ending macro: ", err)
+	}
+	expected := "def hello_world(ctx):\n" +
+		"  if x:\n" +
+		"    ctx.run(ctx, [\n" +
+		"      \"a\",\n" +
+		"    ])\n" +
+		"  return ctx\n"
+	if diff := cmp.Diff(expected, b.String()); diff != "" {
+		t.Error("Unexpected writer output:\n", diff)
+	}
+	for _, unit := range []string{"", "x", " \n"} {
+		if err := writer.SetIndent(unit); err == nil {
+			t.Errorf("Invalid indentation %q accepted", unit)
+		}
+	}
+}
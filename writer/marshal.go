@@ -2,10 +2,19 @@ package writer
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math/big"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"bitbucket.org/creachadair/stringset"
 )
 
 // Marshaler is the interface implemented by types that
@@ -15,124 +24,607 @@ type Marshaler interface {
 }
 
 var (
-	marshalerType = reflect.TypeOf((*Marshaler)(nil)).Elem()
+	marshalerType  = reflect.TypeOf((*Marshaler)(nil)).Elem()
+	stringerType   = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+	jsonNumberType = reflect.TypeOf(json.Number(""))
+	bigIntType     = reflect.TypeOf((*big.Int)(nil))
+	durationType   = reflect.TypeOf(time.Duration(0))
+	timeType       = reflect.TypeOf(time.Time{})
+	stringsetType  = reflect.TypeOf(stringset.Set(nil))
+	setType        = reflect.TypeOf((*Set)(nil)).Elem()
+
+	enumMu      sync.RWMutex
+	enumSymbols = make(map[reflect.Type]map[interface{}]string)
 )
 
+// Set is the interface implemented by set types, the elements of which are
+// encoded as a sorted Starlark list.
+type Set interface {
+	Elements() []string
+}
+
+// RegisterEnum registers symbolic names for the values of a named integer type.
+// symbols must be a map from values of that type to the Starlark identifier with
+// which each should be encoded, e.g. map[Optimization]string{O2: "OPT_O2"}.
+// Values of the type without a registered symbol continue to be encoded as integers.
+func RegisterEnum(symbols interface{}) error {
+	v := reflect.ValueOf(symbols)
+	if v.Kind() != reflect.Map || v.Type().Elem().Kind() != reflect.String {
+		return fmt.Errorf("enum symbols must be a map of values to strings, found: %T", symbols)
+	}
+	t := v.Type().Key()
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+	default:
+		return fmt.Errorf("enum type must be an integer type, found: %v", t)
+	}
+	values := make(map[interface{}]string, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		sym := iter.Value().String()
+		if !validIdentPattern.MatchString(sym) || starlarkReserved.Contains(sym) {
+			return fmt.Errorf("invalid Starlark identifier for %v value %v: %s", t, iter.Key(), sym)
+		}
+		values[iter.Key().Interface()] = sym
+	}
+	enumMu.Lock()
+	defer enumMu.Unlock()
+	enumSymbols[t] = values
+	return nil
+}
+
+// enumSymbol returns the symbol registered for v, if any.
+func enumSymbol(v reflect.Value) (string, bool) {
+	enumMu.RLock()
+	defer enumMu.RUnlock()
+	values, ok := enumSymbols[v.Type()]
+	if !ok {
+		return "", false
+	}
+	sym, ok := values[v.Interface()]
+	return sym, ok
+}
+
 // Marshal returns the Starlark encoding of v.
 //
-// Marshal traverses the value v recursively using the following type-dependent default encodings:
+// Marshal traverses the value v recursively. Values implementing Marshaler, at any depth
+// and including map values and struct fields, are encoded by their MarshalStarlark method.
+// Otherwise, Marshal uses the following type-dependent default encodings:
 //
 // Boolean values are encoded as True/False.
 // Strings values are encoded as quoted Starlark strings.
 // Array and slice values are encoded as Starlark lists, with their contents recursively encoded.
+// Map values are encoded as Starlark dicts. Entries of maps with integer or floating point
+// keys are sorted numerically, while all others, including maps with interface keys
+// of mixed types, are sorted by their encoded key.
+// Keys are encoded like any other value, so string keys are always quoted.
+// Struct values are encoded as Starlark dicts, as described below.
 // Nil pointer values are encoded as None.
+// Values of types registered with RegisterEnum are encoded as their symbolic name, if any.
+// json.Number and *big.Int values are encoded exactly, as Starlark int or float literals.
+// time.Duration values are encoded as strings, e.g. "1m30s", and time.Time values as RFC 3339 strings.
+// Values implementing Set, including stringset.Set, are encoded as a sorted list of their elements.
+//
+// Each exported struct field becomes a dict entry keyed by the field name, unless
+// overridden by a `starlark:"name"` tag. A tag of "-" omits the field, as does
+// an "omitempty" option if the field has an empty value (false, 0, a nil pointer or
+// interface, or an empty array, slice, map or string). The fields of embedded structs
+// are flattened into the enclosing dict unless tagged with a name, with fields of the
+// enclosing struct taking precedence. Entries are written in a stable order: direct
+// fields in declaration order, followed by the fields of each embedded struct in
+// declaration order, recursively.
+//
+// Values nested more deeply than DefaultMarshalDepth, including cyclic values, cannot be
+// marshaled and result in an error.
 func Marshal(v interface{}) ([]byte, error) {
+	return MarshalOptions{}.Marshal(v)
+}
+
+// QuoteStyle selects the quote character used for Starlark string literals.
+type QuoteStyle int
+
+// Constants defining the supported quote styles.
+const (
+	DoubleQuotes QuoteStyle = iota // Strings are written as "...", the buildifier style.
+	SingleQuotes                   // Strings are written as '...'.
+)
+
+// MarshalOptions configures the Starlark encoding of values.
+// The zero value selects the defaults used by Marshal.
+type MarshalOptions struct {
+	Quote  QuoteStyle // Quote character for string literals.
+	Indent string     // If non-empty, the indentation used to write non-empty lists and dicts one element per line.
+
+	// If true, values implementing fmt.Stringer which are not otherwise handled specially
+	// are encoded as the quoted result of their String method, rather than by their kind.
+	Stringers bool
+
+	// If true, marshaling a Select without a //conditions:default entry is an error.
+	RequireSelectDefault bool
+
+	// If true, marshaling a string which is not valid UTF-8 is an error. Otherwise,
+	// each invalid byte is written as a \xhh escape, as described by Marshal.
+	StrictUTF8 bool
+
+	// The maximum nesting depth of values, beyond which marshaling fails rather than
+	// recursing without bound, as for cyclic values. If zero, DefaultMarshalDepth is used.
+	MaxDepth int
+
+	level int // The nesting depth at which the value is being marshaled, by an enclosing Marshaler.
+}
+
+// DefaultMarshalDepth is the default maximum nesting depth of marshaled values, see MarshalOptions.
+const DefaultMarshalDepth = 1000
+
+// errMaxDepth is returned when marshaling a value nested beyond the maximum depth.
+var errMaxDepth = errors.New("maximum marshal depth exceeded")
+
+// Marshal returns the Starlark encoding of v using the configured options.
+// Options are propagated to the types defined in this package, such as Struct and Call,
+// but not to other Marshaler implementations.
+func (o MarshalOptions) Marshal(v interface{}) ([]byte, error) {
 	var buf bytes.Buffer
-	if err := encodeValue(&buf, reflect.ValueOf(v)); err != nil {
+	enc := &encoder{opts: o, level: o.level}
+	if err := enc.encodeValue(&buf, reflect.ValueOf(v)); err != nil {
 		return nil, err
 	}
 	return buf.Bytes(), nil
 }
 
-func encodeValue(b *bytes.Buffer, v reflect.Value) error {
+// optionsMarshaler is implemented by the Marshaler types in this package which
+// marshal nested values and so need access to the options in use.
+type optionsMarshaler interface {
+	marshalStarlark(o MarshalOptions) ([]byte, error)
+}
+
+// MarshalIndent is like Marshal, but writes non-empty lists and dicts with
+// one element per line, each indented by indent, and a trailing comma.
+func MarshalIndent(v interface{}, indent string) ([]byte, error) {
+	return MarshalOptions{Indent: indent}.Marshal(v)
+}
+
+// encoder holds the options and state used for a single call to Marshal.
+type encoder struct {
+	opts  MarshalOptions
+	depth int // Current nesting depth of indented lists and dicts.
+	level int // Current nesting depth of values, limited by MaxDepth.
+}
+
+// beginElement writes the separator preceding element i of a list or dict.
+func (enc *encoder) beginElement(b *bytes.Buffer, i int) error {
+	if enc.opts.Indent != "" {
+		return writeString(b, "\n"+strings.Repeat(enc.opts.Indent, enc.depth))
+	}
+	if i > 0 {
+		return writeString(b, ", ")
+	}
+	return nil
+}
+
+// endElement writes the terminator following an element of a list or dict.
+func (enc *encoder) endElement(b *bytes.Buffer) error {
+	if enc.opts.Indent != "" {
+		return b.WriteByte(',')
+	}
+	return nil
+}
+
+// endElements writes the separator preceding the closing bracket of a list or dict of n elements.
+func (enc *encoder) endElements(b *bytes.Buffer, n int) error {
+	if enc.opts.Indent != "" && n > 0 {
+		return writeString(b, "\n"+strings.Repeat(enc.opts.Indent, enc.depth))
+	}
+	return nil
+}
+
+// reindent indents the continuation lines of a multi-line value to the current depth.
+func (enc *encoder) reindent(value string) string {
+	if enc.opts.Indent == "" || enc.depth == 0 {
+		return value
+	}
+	return strings.Replace(value, "\n", "\n"+strings.Repeat(enc.opts.Indent, enc.depth), -1)
+}
+
+// quote returns s as a Starlark string literal using the configured quote style.
+// Only the selected quote character is escaped.
+//
+// The literal is always ASCII, so that parsing it yields exactly the bytes of s regardless of
+// the encoding with which the file is read. Printable ASCII characters other than the quote
+// and backslash are written as-is. Control characters with a named escape (\a, \b, \f, \n, \r,
+// \t and \v) are written using it, and all other control characters and DEL as \xhh escapes.
+// Valid non-ASCII runes, including combining characters, are written as \uhhhh or \Uhhhhhhhh
+// escapes of their code point, which Starlark encodes as UTF-8. Bytes which are not part of
+// valid UTF-8 are written as \xhh escapes, which denote the byte itself.
+func (enc *encoder) quote(s string) string {
+	if enc.opts.Quote != SingleQuotes {
+		return strconv.QuoteToASCII(s)
+	}
+	var b strings.Builder
+	b.WriteByte('\'')
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			fmt.Fprintf(&b, `\x%02x`, s[i])
+		case r == '\'':
+			b.WriteString(`\'`)
+		case r == '"':
+			b.WriteByte('"')
+		default:
+			q := strconv.QuoteRuneToASCII(r)
+			b.WriteString(q[1 : len(q)-1])
+		}
+		i += size
+	}
+	b.WriteByte('\'')
+	return b.String()
+}
+
+func (enc *encoder) encodeValue(b *bytes.Buffer, v reflect.Value) error {
 	if !v.IsValid() {
 		return writeString(b, "None")
 	}
-	return encodeType(b, v.Type(), v)
+	max := enc.opts.MaxDepth
+	if max == 0 {
+		max = DefaultMarshalDepth
+	}
+	if enc.level >= max {
+		return errMaxDepth
+	}
+	enc.level++
+	defer func() { enc.level-- }()
+	return enc.encodeType(b, v.Type(), v)
 }
 
-func encodeType(b *bytes.Buffer, t reflect.Type, v reflect.Value) error {
+func (enc *encoder) encodeType(b *bytes.Buffer, t reflect.Type, v reflect.Value) error {
 	if t.Implements(marshalerType) {
-		return encodeMarshaler(b, v)
+		return enc.encodeMarshaler(b, v)
+	}
+	if sym, ok := enumSymbol(v); ok {
+		return writeString(b, sym)
+	}
+	switch t {
+	case jsonNumberType:
+		return enc.encodeJSONNumber(b, v)
+	case bigIntType:
+		return enc.encodeBigInt(b, v)
+	case durationType:
+		return writeString(b, enc.quote(time.Duration(v.Int()).String()))
+	case timeType:
+		return writeString(b, enc.quote(v.Interface().(time.Time).Format(time.RFC3339)))
+	}
+	if t.Implements(setType) && !(t.Kind() == reflect.Ptr && v.IsNil()) {
+		return enc.encodeSet(b, v)
+	}
+	if enc.opts.Stringers && t.Implements(stringerType) && !(t.Kind() == reflect.Ptr && v.IsNil()) {
+		return enc.encodeStringValue(b, v.Interface().(fmt.Stringer).String())
 	}
 
 	switch t.Kind() {
 	case reflect.Bool:
-		return encodeBool(b, v)
+		return enc.encodeBool(b, v)
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint:
-		return encodeInt(b, v)
+		return enc.encodeInt(b, v)
 	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
-		return encodeUint(b, v)
+		return enc.encodeUint(b, v)
 	case reflect.Float32, reflect.Float64:
-		return encodeFloat(b, v)
+		return enc.encodeFloat(b, v)
 	case reflect.String:
-		return encodeString(b, v)
+		return enc.encodeString(b, v)
 	case reflect.Slice:
-		return encodeSlice(b, v)
+		return enc.encodeSlice(b, v)
 	case reflect.Array:
-		return encodeArray(b, v)
+		return enc.encodeArray(b, v)
+	case reflect.Map:
+		return enc.encodeMap(b, v)
+	case reflect.Struct:
+		return enc.encodeStruct(b, v)
 	case reflect.Interface, reflect.Ptr:
-		return encodeInterface(b, v)
+		return enc.encodeInterface(b, v)
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer, reflect.Complex64, reflect.Complex128:
+		return fmt.Errorf("unsupported type: %v", t)
 	default:
 		return fmt.Errorf("unsupported encoding type for value: %#v", v)
 	}
 }
 
-func encodeBool(b *bytes.Buffer, v reflect.Value) error {
+func (enc *encoder) encodeBool(b *bytes.Buffer, v reflect.Value) error {
 	return writeString(b, strings.Title(strconv.FormatBool(v.Bool())))
 }
 
-func encodeInt(b *bytes.Buffer, v reflect.Value) error {
+func (enc *encoder) encodeInt(b *bytes.Buffer, v reflect.Value) error {
 	return writeString(b, strconv.FormatInt(v.Int(), 10))
 }
 
-func encodeUint(b *bytes.Buffer, v reflect.Value) error {
+func (enc *encoder) encodeUint(b *bytes.Buffer, v reflect.Value) error {
 	return writeString(b, strconv.FormatUint(v.Uint(), 10))
 }
 
-func encodeFloat(b *bytes.Buffer, v reflect.Value) error {
+func (enc *encoder) encodeFloat(b *bytes.Buffer, v reflect.Value) error {
 	return writeString(b, strconv.FormatFloat(v.Float(), 'g', -1, 64))
 }
 
-func encodeString(b *bytes.Buffer, v reflect.Value) error {
-	return writeString(b, strconv.QuoteToASCII(v.String()))
+func (enc *encoder) encodeJSONNumber(b *bytes.Buffer, v reflect.Value) error {
+	n := v.String()
+	if i, ok := new(big.Int).SetString(n, 10); ok {
+		return writeString(b, i.String())
+	}
+	if _, err := strconv.ParseFloat(n, 64); err != nil {
+		return fmt.Errorf("invalid json.Number: %q", n)
+	}
+	// Use the original text to avoid any loss of precision.
+	return writeString(b, n)
 }
 
-func encodeSlice(b *bytes.Buffer, v reflect.Value) error {
+func (enc *encoder) encodeBigInt(b *bytes.Buffer, v reflect.Value) error {
+	if v.IsNil() {
+		return writeString(b, "None")
+	}
+	return writeString(b, v.Interface().(*big.Int).String())
+}
+
+func (enc *encoder) encodeString(b *bytes.Buffer, v reflect.Value) error {
+	return enc.encodeStringValue(b, v.String())
+}
+
+// encodeStringValue writes s as a string literal, rejecting invalid UTF-8 if configured with StrictUTF8.
+func (enc *encoder) encodeStringValue(b *bytes.Buffer, s string) error {
+	if enc.opts.StrictUTF8 && !utf8.ValidString(s) {
+		for i := 0; i < len(s); {
+			r, size := utf8.DecodeRuneInString(s[i:])
+			if r == utf8.RuneError && size == 1 {
+				return fmt.Errorf("invalid UTF-8 at byte offset %d of string %q", i, s)
+			}
+			i += size
+		}
+	}
+	return writeString(b, enc.quote(s))
+}
+
+func (enc *encoder) encodeSet(b *bytes.Buffer, v reflect.Value) error {
+	if v.Type() == stringsetType {
+		// The elements of a stringset.Set are already sorted.
+		return enc.encodeArray(b, reflect.ValueOf(v.Interface().(stringset.Set).Elements()))
+	}
+	return enc.encodeArray(b, reflect.ValueOf(sortedStrings(v.Interface().(Set).Elements())))
+}
+
+func (enc *encoder) encodeSlice(b *bytes.Buffer, v reflect.Value) error {
 	if v.IsNil() {
 		return writeString(b, "[]")
 	}
-	return encodeArray(b, v)
+	return enc.encodeArray(b, v)
 }
 
-func encodeArray(b *bytes.Buffer, v reflect.Value) error {
+func (enc *encoder) encodeArray(b *bytes.Buffer, v reflect.Value) error {
 	if err := b.WriteByte('['); err != nil {
 		return err
 	}
 	n := v.Len()
+	enc.depth++
 	for i := 0; i < n; i++ {
-		if i > 0 {
-			if err := writeString(b, ", "); err != nil {
-				return err
-			}
+		if err := enc.beginElement(b, i); err != nil {
+			return err
 		}
-		if err := encodeValue(b, v.Index(i)); err != nil {
+		if err := enc.encodeValue(b, v.Index(i)); err != nil {
+			return err
+		}
+		if err := enc.endElement(b); err != nil {
 			return err
 		}
 	}
+	enc.depth--
+	if err := enc.endElements(b, n); err != nil {
+		return err
+	}
 	return b.WriteByte(']')
 }
 
-func encodeInterface(b *bytes.Buffer, v reflect.Value) error {
+func (enc *encoder) encodeMap(b *bytes.Buffer, v reflect.Value) error {
+	type entry struct {
+		key    string
+		rawKey reflect.Value
+		value  reflect.Value
+	}
+	entries := make([]entry, 0, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		key, err := enc.marshalValue(iter.Key())
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry{key, iter.Key(), iter.Value()})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		ki, kj := entries[i].rawKey, entries[j].rawKey
+		switch ki.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return ki.Int() < kj.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return ki.Uint() < kj.Uint()
+		case reflect.Float32, reflect.Float64:
+			return ki.Float() < kj.Float()
+		}
+		return entries[i].key < entries[j].key
+	})
+
+	if err := b.WriteByte('{'); err != nil {
+		return err
+	}
+	enc.depth++
+	for i, ent := range entries {
+		if err := enc.beginElement(b, i); err != nil {
+			return err
+		}
+		if err := writeString(b, ent.key+": "); err != nil {
+			return err
+		}
+		if err := enc.encodeValue(b, ent.value); err != nil {
+			return err
+		}
+		if err := enc.endElement(b); err != nil {
+			return err
+		}
+	}
+	enc.depth--
+	if err := enc.endElements(b, len(entries)); err != nil {
+		return err
+	}
+	return b.WriteByte('}')
+}
+
+// structField describes a single field of a struct which is encoded as a dict entry.
+type structField struct {
+	name      string
+	index     []int // Index sequence for reflect.Value.FieldByIndex.
+	omitEmpty bool
+}
+
+// structFields returns the fields of t to encode, in order.
+func structFields(t reflect.Type) []structField {
+	var fields, embedded []structField
+	seen := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("starlark")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if comma := strings.Index(tag, ","); comma >= 0 {
+			name, opts = tag[:comma], tag[comma+1:]
+		}
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			for _, ef := range structFields(ft) {
+				ef.index = append([]int{i}, ef.index...)
+				embedded = append(embedded, ef)
+			}
+			continue
+		}
+		if f.PkgPath != "" { // Unexported.
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		seen[name] = true
+		fields = append(fields, structField{name, []int{i}, opts == "omitempty"})
+	}
+	for _, f := range embedded {
+		if !seen[f.name] {
+			seen[f.name] = true
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// fieldByIndex is like reflect.Value.FieldByIndex, but returns false rather than panicking
+// if the field is within a nil embedded pointer.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// isEmptyValue reports whether v is empty for the purposes of omitempty.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+func (enc *encoder) encodeStruct(b *bytes.Buffer, v reflect.Value) error {
+	if err := b.WriteByte('{'); err != nil {
+		return err
+	}
+	enc.depth++
+	n := 0
+	for _, f := range structFields(v.Type()) {
+		fv, ok := fieldByIndex(v, f.index)
+		if !ok || (f.omitEmpty && isEmptyValue(fv)) {
+			continue
+		}
+		if err := enc.beginElement(b, n); err != nil {
+			return err
+		}
+		if err := writeString(b, enc.quote(f.name)+": "); err != nil {
+			return err
+		}
+		if err := enc.encodeValue(b, fv); err != nil {
+			return err
+		}
+		if err := enc.endElement(b); err != nil {
+			return err
+		}
+		n++
+	}
+	enc.depth--
+	if err := enc.endElements(b, n); err != nil {
+		return err
+	}
+	return b.WriteByte('}')
+}
+
+func (enc *encoder) encodeInterface(b *bytes.Buffer, v reflect.Value) error {
 	if v.IsNil() {
 		return writeString(b, "None")
 	}
-	return encodeValue(b, v.Elem())
+	return enc.encodeValue(b, v.Elem())
 }
 
-func encodeMarshaler(b *bytes.Buffer, v reflect.Value) error {
+func (enc *encoder) encodeMarshaler(b *bytes.Buffer, v reflect.Value) error {
 	if v.Kind() == reflect.Ptr && v.IsNil() {
 		return writeString(b, "None")
 	}
-	m, ok := v.Interface().(Marshaler)
-	if !ok {
+	var r []byte
+	var err error
+	switch m := v.Interface().(type) {
+	case optionsMarshaler:
+		o := enc.opts
+		o.level = enc.level
+		r, err = m.marshalStarlark(o)
+	case Marshaler:
+		r, err = m.MarshalStarlark()
+	default:
 		return writeString(b, "None")
 	}
-	r, err := m.MarshalStarlark()
 	if err != nil {
 		return err
 	}
-	return writeString(b, string(r))
+	return writeString(b, enc.reindent(string(r)))
+}
+
+func (enc *encoder) marshalValue(v reflect.Value) (string, error) {
+	var b bytes.Buffer
+	if err := enc.encodeValue(&b, v); err != nil {
+		return "", err
+	}
+	return b.String(), nil
 }
 
 func writeString(b *bytes.Buffer, value string) error {
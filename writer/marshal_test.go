@@ -1,7 +1,21 @@
 package writer
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
+	"unicode/utf8"
+	"unsafe"
+
+	"bitbucket.org/creachadair/stringset"
+	"github.com/google/go-cmp/cmp"
 )
 
 type marsh struct{}
@@ -22,8 +36,535 @@ func TestMarshalling(t *testing.T) {
 		{"hello, world", `"hello, world"`},
 		{[]interface{}{1, true, "hello"}, "[1, True, \"hello\"]"},
 		{marsh{}, "marshaled"},
+		{map[string]int{"b": 2, "a": 1}, `{"a": 1, "b": 2}`},
+		{map[string]interface{}{}, "{}"},
+		{QuotedIdent("cc_library"), `"cc_library"`},
+		{Struct{"name": "a", "deps": []string{"b"}}, `struct(deps = ["b"], name = "a")`},
+	}
+
+	for _, test := range tests {
+		a, err := Marshal(test.v)
+		if err != nil {
+			t.Errorf("Failed to marshal %#v: %v", test.v, err)
+		} else if string(a) != test.e {
+			t.Errorf("Expected %#v but got %#v", test.e, string(a))
+		}
+	}
+}
+
+type optimization int
+
+const (
+	optO0 optimization = iota
+	optO1
+	optO2
+)
+
+func TestMarshalPointersAndSlices(t *testing.T) {
+	a := "a"
+	ints := []int{1, 2}
+	var nilInts *[]int
+	var nilSlice []int
+	tests := []struct {
+		v interface{}
+		e string
+	}{
+		{[]*string{&a, nil}, `["a", None]`},
+		{[]*string{}, `[]`},
+		{&ints, `[1, 2]`},
+		{nilInts, `None`},
+		{&nilSlice, `[]`},
+		{[]*[]int{&ints, nil, &nilSlice}, `[[1, 2], None, []]`},
+		{map[string]*[]int{"a": &ints, "b": nil}, `{"a": [1, 2], "b": None}`},
+		{struct{ P *[]*string }{&[]*string{nil, &a}}, `{"P": [None, "a"]}`},
+	}
+	for _, test := range tests {
+		a, err := Marshal(test.v)
+		if err != nil {
+			t.Errorf("Failed to marshal %#v: %v", test.v, err)
+		} else if string(a) != test.e {
+			t.Errorf("Expected %#v but got %#v", test.e, string(a))
+		}
+	}
+}
+
+// letterSet is a custom set implementation.
+type letterSet struct{ letters string }
+
+func (ls letterSet) Elements() []string { return strings.Split(ls.letters, "") }
+
+func TestMarshalSets(t *testing.T) {
+	tests := []struct {
+		v interface{}
+		e string
+	}{
+		{stringset.New("b", "c", "a"), `["a", "b", "c"]`},
+		{stringset.Set(nil), `[]`},
+		{letterSet{"cab"}, `["a", "b", "c"]`},
+		{&letterSet{"ba"}, `["a", "b"]`},
+		{(*letterSet)(nil), `None`},
+		{map[string]Set{"deps": stringset.New("y", "x"), "srcs": letterSet{"zx"}}, `{"deps": ["x", "y"], "srcs": ["x", "z"]}`},
+	}
+	for _, test := range tests {
+		a, err := Marshal(test.v)
+		if err != nil {
+			t.Errorf("Failed to marshal %#v: %v", test.v, err)
+		} else if string(a) != test.e {
+			t.Errorf("Expected %#v but got %#v", test.e, string(a))
+		}
+	}
+}
+
+func TestMarshalEnum(t *testing.T) {
+	if err := RegisterEnum(map[optimization]string{optO0: "OPT_O0", optO2: "OPT_O2"}); err != nil {
+		t.Fatal("Unexpected error registering enum: ", err)
+	}
+	tests := []struct {
+		v interface{}
+		e string
+	}{
+		{optO0, "OPT_O0"},
+		{optO1, "1"},
+		{optO2, "OPT_O2"},
+		{[]optimization{optO2, optO1}, "[OPT_O2, 1]"},
+		{int(optO2), "2"},
+		{Raw("select(CONFIG)"), "select(CONFIG)"},
+	}
+	for _, test := range tests {
+		a, err := Marshal(test.v)
+		if err != nil {
+			t.Errorf("Failed to marshal %#v: %v", test.v, err)
+		} else if string(a) != test.e {
+			t.Errorf("Expected %#v but got %#v", test.e, string(a))
+		}
+	}
+}
+
+func TestRegisterInvalidEnum(t *testing.T) {
+	for _, symbols := range []interface{}{
+		map[string]string{"a": "A"},
+		map[optimization]int{optO0: 0},
+		map[optimization]string{optO0: "not valid"},
+		[]string{"A"},
+	} {
+		if err := RegisterEnum(symbols); err == nil {
+			t.Errorf("Invalid enum %#v accepted", symbols)
+		}
+	}
+}
+
+func TestMarshalExactNumbers(t *testing.T) {
+	large, ok := new(big.Int).SetString("-1234567890123456789012345678901234567890", 10)
+	if !ok {
+		t.Fatal("Invalid big.Int literal")
+	}
+	tests := []struct {
+		v interface{}
+		e string
+	}{
+		{large, "-1234567890123456789012345678901234567890"},
+		{(*big.Int)(nil), "None"},
+		{json.Number("12345678901234567890123"), "12345678901234567890123"},
+		{json.Number("0.30000000000000000001"), "0.30000000000000000001"},
+		{json.Number("1e3"), "1e3"},
+	}
+	for _, test := range tests {
+		a, err := Marshal(test.v)
+		if err != nil {
+			t.Errorf("Failed to marshal %#v: %v", test.v, err)
+		} else if string(a) != test.e {
+			t.Errorf("Expected %#v but got %#v", test.e, string(a))
+		}
+	}
+	if _, err := Marshal(json.Number("1.2.3")); err == nil {
+		t.Error("Invalid json.Number accepted")
+	}
+}
+
+func TestMarshalTime(t *testing.T) {
+	tests := []struct {
+		v interface{}
+		e string
+	}{
+		{90 * time.Second, `"1m30s"`},
+		{[]time.Duration{time.Millisecond}, `["1ms"]`},
+		{time.Date(2019, 6, 1, 12, 30, 0, 0, time.UTC), `"2019-06-01T12:30:00Z"`},
+		{time.Date(2019, 6, 1, 12, 30, 0, 0, time.FixedZone("", -7*60*60)), `"2019-06-01T12:30:00-07:00"`},
+		{int64(90 * time.Second), "90000000000"},
+	}
+	for _, test := range tests {
+		a, err := Marshal(test.v)
+		if err != nil {
+			t.Errorf("Failed to marshal %#v: %v", test.v, err)
+		} else if string(a) != test.e {
+			t.Errorf("Expected %#v but got %#v", test.e, string(a))
+		}
+	}
+}
+
+func TestMarshalConcat(t *testing.T) {
+	tests := []struct {
+		v interface{}
+		e string
+	}{
+		{Concat{Raw("prefix"), "/", Raw("name")}, `(prefix + "/" + name)`},
+		{Concat{Var("prefix"), Var("name"), ".cc"}, `(prefix + name + ".cc")`},
+		{Concat{Concat{"a", Var("b")}, "c"}, `(("a" + b) + "c")`},
+		{[]interface{}{Concat{Var("dir"), "/x.h"}}, `[(dir + "/x.h")]`},
+		{Concat{}, `""`},
+		{Var("pass"), "pass_"},
+	}
+	for _, test := range tests {
+		a, err := Marshal(test.v)
+		if err != nil {
+			t.Errorf("Failed to marshal %#v: %v", test.v, err)
+		} else if string(a) != test.e {
+			t.Errorf("Expected %#v but got %#v", test.e, string(a))
+		}
+	}
+	if _, err := Marshal(Concat{Var("not valid")}); err == nil {
+		t.Error("Unexpected success marshaling invalid variable name")
+	}
+}
+
+func TestMarshalQuoteStyle(t *testing.T) {
+	tests := []struct {
+		quote QuoteStyle
+		v     interface{}
+		e     string
+	}{
+		{DoubleQuotes, `it's "quoted"`, `"it's \"quoted\""`},
+		{SingleQuotes, `it's "quoted"`, `'it\'s "quoted"'`},
+		{SingleQuotes, "tab\t\\ é\xff", `'tab\t\\ \u00e9\xff'`},
+		{SingleQuotes, []string{"a"}, `['a']`},
+		{SingleQuotes, Struct{"name": "a"}, `struct(name = 'a')`},
+		{SingleQuotes, Concat{Var("dir"), "/'x'"}, `(dir + '/\'x\'')`},
+		{SingleQuotes, Call{Func: Var("f"), Kwargs: map[string]Expr{"k": "v"}}, `f(k = 'v')`},
+	}
+	for _, test := range tests {
+		a, err := MarshalOptions{Quote: test.quote}.Marshal(test.v)
+		if err != nil {
+			t.Errorf("Failed to marshal %#v: %v", test.v, err)
+		} else if string(a) != test.e {
+			t.Errorf("Expected %#v but got %#v", test.e, string(a))
+		}
+	}
+}
+
+func TestMarshalTrailingBackslash(t *testing.T) {
+	tests := []struct {
+		v      string
+		double string
+		single string
+	}{
+		{`a\`, `"a\\"`, `'a\\'`},
+		{`a\\`, `"a\\\\"`, `'a\\\\'`},
+		{`a\\\`, `"a\\\\\\"`, `'a\\\\\\'`},
+		{`\`, `"\\"`, `'\\'`},
+	}
+	for _, test := range tests {
+		a, err := Marshal(test.v)
+		if err != nil {
+			t.Errorf("Failed to marshal %#v: %v", test.v, err)
+		} else if string(a) != test.double {
+			t.Errorf("Expected %#v but got %#v", test.double, string(a))
+		} else if s, err := strconv.Unquote(string(a)); err != nil || s != test.v {
+			// Starlark and Go share the same escape sequences for these literals.
+			t.Errorf("Marshaled %#v does not parse back to %#v: %q, %v", test.v, test.v, s, err)
+		}
+		a, err = MarshalOptions{Quote: SingleQuotes}.Marshal(test.v)
+		if err != nil {
+			t.Errorf("Failed to marshal %#v: %v", test.v, err)
+		} else if string(a) != test.single {
+			t.Errorf("Expected %#v but got %#v", test.single, string(a))
+		}
+	}
+}
+
+// unquoteStarlark parses a Starlark string literal according to the Starlark specification,
+// requiring that everything other than escape sequences be printable ASCII.
+func unquoteStarlark(lit string) (string, error) {
+	if len(lit) < 2 || (lit[0] != '"' && lit[0] != '\'') || lit[len(lit)-1] != lit[0] {
+		return "", fmt.Errorf("not a quoted string: %s", lit)
+	}
+	quote, body := lit[0], lit[1:len(lit)-1]
+	var b strings.Builder
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		if c == quote {
+			return "", fmt.Errorf("unescaped quote at %d", i)
+		}
+		if c < 0x20 || c >= 0x7f {
+			return "", fmt.Errorf("non-printable byte %#x at %d", c, i)
+		}
+		if c != '\\' {
+			b.WriteByte(c)
+			continue
+		}
+		if i++; i == len(body) {
+			return "", errors.New("trailing backslash")
+		}
+		switch c := body[i]; c {
+		case 'a':
+			b.WriteByte('\a')
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'v':
+			b.WriteByte('\v')
+		case '\\', '\'', '"':
+			b.WriteByte(c)
+		case 'x', 'u', 'U':
+			n := map[byte]int{'x': 2, 'u': 4, 'U': 8}[c]
+			if i+n >= len(body) {
+				return "", fmt.Errorf("truncated \\%c escape", c)
+			}
+			v, err := strconv.ParseUint(body[i+1:i+1+n], 16, 32)
+			if err != nil {
+				return "", err
+			}
+			if c == 'x' {
+				b.WriteByte(byte(v))
+			} else if r := rune(v); !utf8.ValidRune(r) {
+				return "", fmt.Errorf("invalid code point %#x", v)
+			} else {
+				b.WriteRune(r)
+			}
+			i += n
+		default:
+			return "", fmt.Errorf("unknown escape \\%c", c)
+		}
+	}
+	return b.String(), nil
+}
+
+func TestMarshalStringRoundTrip(t *testing.T) {
+	tests := []string{
+		"",
+		"\x00\a\b\f\v\r\n\t",
+		"nul\x00in the middle",
+		"del\x7f",
+		"\x80\xfe\xff",
+		"\xed\xa0\x80",      // An encoded surrogate, which is not valid UTF-8.
+		"e\u0301\u20dd",     // Combining characters.
+		"\U0001f600 \ufffd", // Supplementary plane and the replacement character.
+		"\xe2\x82",          // Truncated multi-byte sequence.
+		`quotes ' and " and \`,
+		`\x41A\101`, // Escape sequences themselves.
+	}
+	// Every single byte.
+	for c := 0; c < 256; c++ {
+		tests = append(tests, string([]byte{byte(c)}))
+	}
+	// And random byte strings.
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		data := make([]byte, rng.Intn(16))
+		rng.Read(data)
+		tests = append(tests, string(data))
+	}
+	for _, quote := range []QuoteStyle{DoubleQuotes, SingleQuotes} {
+		for _, test := range tests {
+			a, err := MarshalOptions{Quote: quote}.Marshal(test)
+			if err != nil {
+				t.Errorf("Failed to marshal %q: %v", test, err)
+				continue
+			}
+			if s, err := unquoteStarlark(string(a)); err != nil {
+				t.Errorf("Marshaled %q is not a valid string literal: %s: %v", test, a, err)
+			} else if s != test {
+				t.Errorf("Marshaled %q parsed as %q: %s", test, s, a)
+			}
+		}
+	}
+}
+
+func TestMarshalIndent(t *testing.T) {
+	tests := []struct {
+		v interface{}
+		e string
+	}{
+		{[]int{}, "[]"},
+		{[]int{1, 2}, "[\n  1,\n  2,\n]"},
+		{map[string]interface{}{"a": []string{"x"}, "b": map[string]int{}}, "{\n  \"a\": [\n    \"x\",\n  ],\n  \"b\": {},\n}"},
+		{[]interface{}{Struct{"deps": []string{"x"}}}, "[\n  struct(deps = [\n    \"x\",\n  ]),\n]"},
+	}
+	for _, test := range tests {
+		a, err := MarshalIndent(test.v, "  ")
+		if err != nil {
+			t.Errorf("Failed to marshal %#v: %v", test.v, err)
+		} else if string(a) != test.e {
+			t.Errorf("Expected %#v but got %#v", test.e, string(a))
+		}
+	}
+}
+
+type commonAttrs struct {
+	Visibility []string `starlark:"visibility,omitempty"`
+	Name       string   `starlark:"name"`
+	Testonly   bool     `starlark:"testonly,omitempty"`
+}
+
+type extraAttrs struct {
+	Tags []string `starlark:"tags"`
+}
+
+type libraryAttrs struct {
+	*extraAttrs
+	commonAttrs
+	Srcs       []string `starlark:"srcs"`
+	Deps       []string `starlark:"deps,omitempty"`
+	Name       string   `starlark:"name"`
+	Linkopts   []string `starlark:"-"`
+	Alwayslink bool
+	internal   string
+}
+
+func TestMarshalStructOrder(t *testing.T) {
+	tests := []struct {
+		v interface{}
+		e string
+	}{
+		{
+			libraryAttrs{
+				commonAttrs: commonAttrs{Name: "shadowed", Visibility: []string{"//visibility:public"}},
+				Srcs:        []string{"a.cc"},
+				Name:        "lib",
+				Linkopts:    []string{"-lm"},
+				internal:    "hidden",
+			},
+			`{"srcs": ["a.cc"], "name": "lib", "Alwayslink": False, "visibility": ["//visibility:public"]}`,
+		},
+		{
+			&libraryAttrs{extraAttrs: &extraAttrs{Tags: []string{"manual"}}, Deps: []string{"b"}},
+			`{"srcs": [], "deps": ["b"], "name": "", "Alwayslink": False, "tags": ["manual"]}`,
+		},
+		{struct{}{}, "{}"},
+	}
+	for _, test := range tests {
+		for i := 0; i < 3; i++ {
+			a, err := Marshal(test.v)
+			if err != nil {
+				t.Errorf("Failed to marshal %#v: %v", test.v, err)
+			} else if string(a) != test.e {
+				t.Errorf("Expected %#v but got %#v", test.e, string(a))
+			}
+		}
+	}
+}
+
+func TestMarshalUnsupported(t *testing.T) {
+	var i int
+	tests := []struct {
+		v interface{}
+		e string
+	}{
+		{make(chan int), "unsupported type: chan int"},
+		{func() {}, "unsupported type: func()"},
+		{unsafe.Pointer(&i), "unsupported type: unsafe.Pointer"},
+		{complex64(1i), "unsupported type: complex64"},
+		{[]interface{}{complex(1, 2)}, "unsupported type: complex128"},
+		{map[string]interface{}{"a": func(int) error { return nil }}, "unsupported type: func(int) error"},
+	}
+	for _, test := range tests {
+		if _, err := Marshal(test.v); err == nil {
+			t.Errorf("Unexpected success marshaling %T", test.v)
+		} else if err.Error() != test.e {
+			t.Errorf("Expected error %q but got %q", test.e, err)
+		}
+	}
+}
+
+func TestMarshalList(t *testing.T) {
+	multiline := ListFormat{Multiline: true}
+	trailing := ListFormat{TrailingComma: true}
+	tests := []struct {
+		v interface{}
+		e string
+	}{
+		{List(nil), "[]"},
+		{List{}, "[]"},
+		{List{"a"}, `["a"]`},
+		{List{"a", 1, List{true}}, `["a", 1, [True]]`},
+		{FormattedList{List{}, multiline}, "[]"},
+		{FormattedList{List{"a"}, multiline}, "[\n    \"a\",\n]"},
+		{FormattedList{List{"a", List{"b", "c"}}, multiline}, "[\n    \"a\",\n    [\"b\", \"c\"],\n]"},
+		{FormattedList{List{}, trailing}, "[]"},
+		{FormattedList{List{"a"}, trailing}, `["a",]`},
+		{FormattedList{List{"a", "b"}, trailing}, `["a", "b",]`},
+		{FormattedList{List{"a", "b"}, ListFormat{}}, `["a", "b"]`},
+		{map[string]interface{}{"k": FormattedList{List{"a"}, multiline}}, "{\"k\": [\n    \"a\",\n]}"},
+	}
+	for _, test := range tests {
+		a, err := Marshal(test.v)
+		if err != nil {
+			t.Errorf("Failed to marshal %#v: %v", test.v, err)
+		} else if string(a) != test.e {
+			t.Errorf("Expected %#v but got %#v", test.e, string(a))
+		}
+	}
+
+	// Formatted lists are written as requested regardless of the indentation options.
+	a, err := MarshalIndent(map[string]interface{}{"k": FormattedList{List{"a", "b"}, ListFormat{}}, "l": List{"c"}}, "  ")
+	if err != nil {
+		t.Fatal("Failed to marshal: ", err)
+	}
+	if diff := cmp.Diff("{\n  \"k\": [\"a\", \"b\"],\n  \"l\": [\n    \"c\",\n  ],\n}", string(a)); diff != "" {
+		t.Error("Unexpected output:\n", diff)
+	}
+}
+
+func TestMarshalTuple(t *testing.T) {
+	tests := []struct {
+		v interface{}
+		e string
+	}{
+		{Tuple{}, "()"},
+		{Tuple(nil), "()"},
+		{Tuple{"a"}, `("a",)`},
+		{Tuple{"a", 1}, `("a", 1)`},
+		{Tuple{Tuple{"a"}, List{Tuple{}}}, `(("a",), [()])`},
+	}
+	for _, test := range tests {
+		a, err := Marshal(test.v)
+		if err != nil {
+			t.Errorf("Failed to marshal %#v: %v", test.v, err)
+		} else if string(a) != test.e {
+			t.Errorf("Expected %#v but got %#v", test.e, string(a))
+		}
+	}
+}
+
+func TestMarshalDictKeys(t *testing.T) {
+	a, err := Marshal(map[string]int{"//a:b": 1, "with space": 2, "quote\"here": 3, "ident": 4})
+	if err != nil {
+		t.Fatal("Failed to marshal: ", err)
 	}
+	expected := `{"//a:b": 1, "ident": 4, "quote\"here": 3, "with space": 2}`
+	if diff := cmp.Diff(expected, string(a)); diff != "" {
+		t.Error("Unexpected output:\n", diff)
+	}
+}
 
+func TestMarshalNumericDictKeys(t *testing.T) {
+	tests := []struct {
+		v interface{}
+		e string
+	}{
+		{map[int]string{10: "c", 2: "b", 1: "a"}, `{1: "a", 2: "b", 10: "c"}`},
+		{map[int]string{-1: "a", 0: "b"}, `{-1: "a", 0: "b"}`},
+		{map[uint8]bool{100: true, 9: false}, `{9: False, 100: True}`},
+		{map[float64]int{1.5: 1, 10: 2, 2: 3}, `{1.5: 1, 2: 3, 10: 2}`},
+		// Keys of mixed types are sorted by their encoded form.
+		{map[interface{}]int{10: 1, 2: 2, "a": 3}, `{"a": 3, 10: 1, 2: 2}`},
+	}
 	for _, test := range tests {
 		a, err := Marshal(test.v)
 		if err != nil {
@@ -33,3 +574,427 @@ func TestMarshalling(t *testing.T) {
 		}
 	}
 }
+
+func TestMarshalAnnotatedDict(t *testing.T) {
+	tests := []struct {
+		v interface{}
+		e string
+	}{
+		{AnnotatedDict{}, "{}"},
+		{AnnotatedDict{{Key: "b", Value: 1}, {Key: "a", Value: 2}}, `{"b": 1, "a": 2}`},
+	}
+	for _, test := range tests {
+		a, err := Marshal(test.v)
+		if err != nil {
+			t.Errorf("Failed to marshal %#v: %v", test.v, err)
+		} else if string(a) != test.e {
+			t.Errorf("Expected %#v but got %#v", test.e, string(a))
+		}
+	}
+
+	for _, v := range []AnnotatedDict{
+		{{Key: "a", Value: 1, Comment: "comment"}},
+		{{Key: "a", Value: 1, Comment: "multi\nline"}},
+	} {
+		if a, err := Marshal(v); err == nil {
+			t.Errorf("Expected error marshaling %#v but got %#v", v, string(a))
+		}
+	}
+}
+
+func TestMarshalIndentCommentedSelect(t *testing.T) {
+	v := Call{Func: Var("select"), Args: []Expr{AnnotatedDict{
+		{Key: "//config:linux", Value: []string{"linux.cc", "posix.cc"}, Comment: "platform Linux"},
+		{Key: "//config:windows", Value: []string{"windows.cc"}, Comment: "platform Windows"},
+		{Key: "//conditions:default", Value: []string{}},
+	}}}
+	a, err := MarshalIndent(v, "    ")
+	if err != nil {
+		t.Fatalf("Failed to marshal %#v: %v", v, err)
+	}
+	expected := `select({
+    "//config:linux": [
+        "linux.cc",
+        "posix.cc",
+    ],  # platform Linux
+    "//config:windows": [
+        "windows.cc",
+    ],  # platform Windows
+    "//conditions:default": [],
+})`
+	if diff := cmp.Diff(expected, string(a)); diff != "" {
+		t.Error("Unexpected output:\n", diff)
+	}
+}
+
+type version struct {
+	Major, Minor int
+}
+
+func (v version) String() string {
+	return fmt.Sprintf("%d.%d", v.Major, v.Minor)
+}
+
+func TestMarshalStringers(t *testing.T) {
+	tests := []struct {
+		v        interface{}
+		disabled string
+		enabled  string
+	}{
+		{version{1, 2}, `{"Major": 1, "Minor": 2}`, `"1.2"`},
+		{&version{1, 2}, `{"Major": 1, "Minor": 2}`, `"1.2"`},
+		{(*version)(nil), "None", "None"},
+		{[]interface{}{version{3, 0}}, `[{"Major": 3, "Minor": 0}]`, `["3.0"]`},
+		{net.IPv4(127, 0, 0, 1).To4(), "[127, 0, 0, 1]", `"127.0.0.1"`},
+		{time.Second, `"1s"`, `"1s"`},
+		{Var("x"), "x", "x"},
+	}
+	for _, test := range tests {
+		for _, o := range []MarshalOptions{{}, {Stringers: true}} {
+			expected := test.disabled
+			if o.Stringers {
+				expected = test.enabled
+			}
+			a, err := o.Marshal(test.v)
+			if err != nil {
+				t.Errorf("Failed to marshal %#v: %v", test.v, err)
+			} else if string(a) != expected {
+				t.Errorf("Expected %#v but got %#v", expected, string(a))
+			}
+		}
+	}
+}
+
+func TestMarshalSelect(t *testing.T) {
+	tests := []struct {
+		v interface{}
+		e string
+	}{
+		{Select{}, "select({})"},
+		{Select{"//c:a": map[string]bool{"x": true}}, `select({"//c:a": {"x": True}})`},
+		{Select{"//c:b": false, "//c:a": true}, `select({"//c:a": True, "//c:b": False})`},
+		{Select{"//c:a": map[string]bool{"z": false, "y": true, "x": true}}, `select({"//c:a": {"x": True, "y": True, "z": False}})`},
+		{Select{"//c:a": []bool{true, false}}, `select({"//c:a": [True, False]})`},
+		{Select{"//c:a": map[string]interface{}{"b": []interface{}{true, map[string]bool{"d": false, "c": true}}, "a": 1}},
+			`select({"//c:a": {"a": 1, "b": [True, {"c": True, "d": False}]}})`},
+		{Select{"//c:a": map[bool]string{true: "t", false: "f"}}, `select({"//c:a": {False: "f", True: "t"}})`},
+		{Select{"//c:a": Select{"//c:b": []string{"x"}}}, `select({"//c:a": select({"//c:b": ["x"]})})`},
+		{map[string]interface{}{"srcs": Select{"//conditions:default": nil}}, `{"srcs": select({"//conditions:default": None})}`},
+	}
+	for _, test := range tests {
+		// Marshal repeatedly to exercise map iteration order.
+		for i := 0; i < 10; i++ {
+			a, err := Marshal(test.v)
+			if err != nil {
+				t.Errorf("Failed to marshal %#v: %v", test.v, err)
+				break
+			} else if string(a) != test.e {
+				t.Errorf("Expected %#v but got %#v", test.e, string(a))
+				break
+			}
+		}
+	}
+}
+
+func TestMarshalListPlusSelect(t *testing.T) {
+	sel := Select{"//c:linux": []string{"-pthread"}, DefaultCondition: []string{}}
+	tests := []struct {
+		v interface{}
+		e string
+	}{
+		{ListPlusSelect{Base: []interface{}{"-O2"}, Select: sel},
+			`["-O2"] + select({"//c:linux": ["-pthread"], "//conditions:default": []})`},
+		{ListPlusSelect{Select: sel}, `select({"//c:linux": ["-pthread"], "//conditions:default": []})`},
+		{ListPlusSelect{Base: []interface{}{"-O2"}}, `["-O2"]`},
+		{ListPlusSelect{}, `[]`},
+		// The composition binds as a single operand of an enclosing expression.
+		{BinOp{Op: "+", X: ListPlusSelect{Base: []interface{}{"-O2"}, Select: Select{"//c:a": []string{"-g"}}}, Y: List{"-Wall"}},
+			`(["-O2"] + select({"//c:a": ["-g"]})) + ["-Wall"]`},
+		{map[string]interface{}{"copts": ListPlusSelect{Base: []interface{}{Var("COPTS")}, Select: Select{"//c:a": Var("EXTRA")}}},
+			`{"copts": [COPTS] + select({"//c:a": EXTRA})}`},
+	}
+	for _, test := range tests {
+		a, err := Marshal(test.v)
+		if err != nil {
+			t.Errorf("Failed to marshal %#v: %v", test.v, err)
+		} else if string(a) != test.e {
+			t.Errorf("Expected %#v but got %#v", test.e, string(a))
+		}
+	}
+}
+
+func TestMarshalIndentSelect(t *testing.T) {
+	a, err := MarshalIndent(Select{"//c:b": map[string]bool{"y": false, "x": true}, "//c:a": []bool{true}}, "  ")
+	if err != nil {
+		t.Fatal("Failed to marshal: ", err)
+	}
+	expected := "select({\n  \"//c:a\": [\n    True,\n  ],\n  \"//c:b\": {\n    \"x\": True,\n    \"y\": False,\n  },\n})"
+	if diff := cmp.Diff(expected, string(a)); diff != "" {
+		t.Error("Unexpected output:\n", diff)
+	}
+}
+
+func TestMarshalSelectRequireDefault(t *testing.T) {
+	tests := []struct {
+		v     Select
+		valid bool
+	}{
+		{Select{"//c:a": 1, DefaultCondition: 2}, true},
+		{Select{DefaultCondition: 2}, true},
+		{Select{"//c:a": 1}, false},
+		{Select{}, false},
+	}
+	for _, test := range tests {
+		if _, err := Marshal(test.v); err != nil {
+			t.Errorf("Failed to marshal %#v: %v", test.v, err)
+		}
+		_, err := MarshalOptions{RequireSelectDefault: true}.Marshal(test.v)
+		if test.valid && err != nil {
+			t.Errorf("Failed to marshal %#v: %v", test.v, err)
+		} else if !test.valid && err == nil {
+			t.Errorf("Select without default accepted: %#v", test.v)
+		}
+	}
+
+	// Nested selects are validated as well.
+	nested := map[string]interface{}{"srcs": Select{"//c:a": []string{"a.cc"}}}
+	if _, err := (MarshalOptions{RequireSelectDefault: true}).Marshal(nested); err == nil {
+		t.Errorf("Nested select without default accepted: %#v", nested)
+	}
+}
+
+// upperMarshaler is a Marshaler which is not defined by this package.
+type upperMarshaler string
+
+func (u upperMarshaler) MarshalStarlark() ([]byte, error) {
+	return []byte(strings.ToUpper(string(u))), nil
+}
+
+func TestMarshalAnonymousStructAndMarshalerValues(t *testing.T) {
+	tests := []struct {
+		v interface{}
+		e string
+	}{
+		{struct {
+			Name string
+			Deps []string `starlark:"deps"`
+		}{"a", []string{"b"}}, `{"Name": "a", "deps": ["b"]}`},
+		{[]struct{ X int }{{1}, {2}}, `[{"X": 1}, {"X": 2}]`},
+		{struct{}{}, "{}"},
+		{map[string]ArgumentLiterals{"b": {"x", "y"}, "a": {"z"}}, `{"a": "z", "b": "x", "y"}`},
+		{map[string]upperMarshaler{"k": "value"}, `{"k": VALUE}`},
+		{map[string]interface{}{"k": upperMarshaler("value"), "l": Var("v")}, `{"k": VALUE, "l": v}`},
+		{struct{ U upperMarshaler }{"u"}, `{"U": U}`},
+	}
+	for _, test := range tests {
+		a, err := Marshal(test.v)
+		if err != nil {
+			t.Errorf("Failed to marshal %#v: %v", test.v, err)
+		} else if string(a) != test.e {
+			t.Errorf("Expected %#v but got %#v", test.e, string(a))
+		}
+	}
+}
+
+func TestMarshalGlob(t *testing.T) {
+	tests := []struct {
+		v interface{}
+		e string
+	}{
+		{Glob{}, "glob([])"},
+		{Glob{Include: []string{"*.h", "*.cc"}}, `glob(["*.cc", "*.h"])`},
+		{Glob{Include: []string{"*.cc"}, Exclude: []string{"b.cc", "a.cc"}}, `glob(["*.cc"], exclude = ["a.cc", "b.cc"])`},
+		{Glob{Include: []string{"*.cc"}, AllowEmpty: true}, `glob(["*.cc"], allow_empty = True)`},
+		{Glob{Include: []string{"*.cc"}, Exclude: []string{"a.cc"}, AllowEmpty: true}, `glob(["*.cc"], exclude = ["a.cc"], allow_empty = True)`},
+	}
+	for _, test := range tests {
+		a, err := Marshal(test.v)
+		if err != nil {
+			t.Errorf("Failed to marshal %#v: %v", test.v, err)
+		} else if string(a) != test.e {
+			t.Errorf("Expected %#v but got %#v", test.e, string(a))
+		}
+	}
+}
+
+func TestMarshalSortedSet(t *testing.T) {
+	tests := []struct {
+		v interface{}
+		e string
+	}{
+		{SortedSet(nil), "[]"},
+		{SortedSet{"b", "a", "b"}, `["a", "b"]`},
+		{SortedSet{":z", "//lib:a", ":z", ":b", "//lib:a"}, `["//lib:a", ":b", ":z"]`},
+		{map[string]interface{}{"deps": SortedSet{"c", "c"}}, `{"deps": ["c"]}`},
+	}
+	for _, test := range tests {
+		a, err := Marshal(test.v)
+		if err != nil {
+			t.Errorf("Failed to marshal %#v: %v", test.v, err)
+		} else if string(a) != test.e {
+			t.Errorf("Expected %#v but got %#v", test.e, string(a))
+		}
+	}
+
+	// Marshaling must not modify the original.
+	ss := SortedSet{"b", "a", "b"}
+	if _, err := Marshal(ss); err != nil {
+		t.Fatalf("Failed to marshal %#v: %v", ss, err)
+	}
+	if diff := cmp.Diff(SortedSet{"b", "a", "b"}, ss); diff != "" {
+		t.Error("SortedSet modified by marshaling:\n", diff)
+	}
+}
+
+func TestMarshalVisibility(t *testing.T) {
+	tests := []struct {
+		v interface{}
+		e string
+	}{
+		{Visibility{PublicVisibility}, `["//visibility:public"]`},
+		{Visibility{PrivateVisibility, PrivateVisibility}, `["//visibility:private"]`},
+		{Visibility{"//llvm/lib:__subpackages__", ":__pkg__", "//clang:__pkg__", "@llvm-project//mlir/tools:__pkg__", "//:__subpackages__"},
+			`["//:__subpackages__", "//clang:__pkg__", "//llvm/lib:__subpackages__", ":__pkg__", "@llvm-project//mlir/tools:__pkg__"]`},
+		{Visibility{}, `[]`},
+	}
+	for _, test := range tests {
+		a, err := Marshal(test.v)
+		if err != nil {
+			t.Errorf("Failed to marshal %#v: %v", test.v, err)
+		} else if string(a) != test.e {
+			t.Errorf("Expected %#v but got %#v", test.e, string(a))
+		}
+	}
+	for _, v := range []Visibility{
+		{"//llvm:Support"},
+		{"//visibility:protected"},
+		{"llvm:__pkg__"},
+		{"//llvm/:__pkg__"},
+		{"//llvm:__pkg__ "},
+		{PublicVisibility, "//llvm:__pkg__"},
+		{PrivateVisibility, PublicVisibility},
+	} {
+		if a, err := Marshal(v); err == nil {
+			t.Errorf("Invalid visibility %#v marshaled as %s", v, a)
+		}
+	}
+}
+
+func TestMarshalIndentTrailingComma(t *testing.T) {
+	a, err := MarshalIndent(map[string]interface{}{"srcs": []string{"a.cc", "b.cc", "c.cc"}}, "    ")
+	if err != nil {
+		t.Fatal("Failed to marshal: ", err)
+	}
+	expected := `{
+    "srcs": [
+        "a.cc",
+        "b.cc",
+        "c.cc",
+    ],
+}`
+	if diff := cmp.Diff(expected, string(a)); diff != "" {
+		t.Error("Unexpected output:\n", diff)
+	}
+}
+
+func TestMarshalMaxDepth(t *testing.T) {
+	cyclic := []interface{}{1, nil}
+	cyclic[1] = cyclic
+	list := List{nil}
+	list[0] = list
+	m := map[string]interface{}{}
+	m["self"] = Struct{"m": m}
+	for _, v := range []interface{}{cyclic, list, m} {
+		if _, err := Marshal(v); err == nil || err.Error() != "maximum marshal depth exceeded" {
+			t.Errorf("Expected maximum depth error marshaling cyclic %T but got %v", v, err)
+		}
+	}
+
+	o := MarshalOptions{MaxDepth: 3}
+	if a, err := o.Marshal([][]int{{1}}); err != nil {
+		t.Error("Failed to marshal within the maximum depth: ", err)
+	} else if string(a) != "[[1]]" {
+		t.Errorf("Expected %#v but got %#v", "[[1]]", string(a))
+	}
+	if a, err := o.Marshal([][][]int{{{1}}}); err == nil {
+		t.Errorf("Value exceeding the maximum depth marshaled as %s", a)
+	}
+}
+
+func TestMarshalStrictUTF8(t *testing.T) {
+	for _, test := range []struct {
+		v interface{}
+		e string
+	}{
+		{"a\x80b", `"a\x80b"`},
+		{[]string{"\x80"}, `["\x80"]`},
+	} {
+		a, err := Marshal(test.v)
+		if err != nil {
+			t.Errorf("Failed to marshal %#v: %v", test.v, err)
+		} else if string(a) != test.e {
+			t.Errorf("Expected %#v but got %#v", test.e, string(a))
+		}
+	}
+
+	strict := MarshalOptions{StrictUTF8: true}
+	if a, err := strict.Marshal("valid \u00e9"); err != nil {
+		t.Error("Failed to marshal valid UTF-8: ", err)
+	} else if expected := `"valid \u00e9"`; string(a) != expected {
+		t.Errorf("Expected %#v but got %#v", expected, string(a))
+	}
+	for _, v := range []interface{}{"a\x80b", map[string]string{"a\x80b": "a"}, Struct{"a": "a\x80b"}} {
+		_, err := strict.Marshal(v)
+		if err == nil {
+			t.Errorf("Invalid UTF-8 in %#v accepted", v)
+		} else if !strings.Contains(err.Error(), "byte offset 1") {
+			t.Errorf("Expected error naming byte offset 1 but got %v", err)
+		}
+	}
+}
+
+func TestMarshalArrays(t *testing.T) {
+	for _, test := range []struct {
+		v interface{}
+		e string
+	}{
+		{[3]int{1, 2, 3}, "[1, 2, 3]"},
+		{[2]string{"a", "b"}, `["a", "b"]`},
+		{[0]int{}, "[]"},
+		{[2][1]bool{{true}, {false}}, "[[True], [False]]"},
+		{&[1]interface{}{nil}, "[None]"},
+		{map[string][2]int{"a": {1, 2}}, `{"a": [1, 2]}`},
+	} {
+		a, err := Marshal(test.v)
+		if err != nil {
+			t.Errorf("Failed to marshal %#v: %v", test.v, err)
+		} else if string(a) != test.e {
+			t.Errorf("Expected %#v but got %#v", test.e, string(a))
+		}
+	}
+}
+
+func TestMarshalInterfaceValues(t *testing.T) {
+	type rule struct {
+		Name  string      `starlark:"name"`
+		Srcs  interface{} `starlark:"srcs"`
+		Deps  interface{} `starlark:"deps,omitempty"`
+		Extra Marshaler   `starlark:"extra"`
+	}
+	for _, test := range []struct {
+		v interface{}
+		e string
+	}{
+		{rule{Name: "a", Srcs: []string{"a.cc", "b.cc"}}, `{"name": "a", "srcs": ["a.cc", "b.cc"], "extra": None}`},
+		{rule{Name: "a", Srcs: &[]string{"a.cc"}, Deps: []interface{}{":b"}, Extra: List{1}}, `{"name": "a", "srcs": ["a.cc"], "deps": [":b"], "extra": [1]}`},
+		{rule{Name: "a", Srcs: interface{}(stringset.New("b", "a"))}, `{"name": "a", "srcs": ["a", "b"], "extra": None}`},
+		{[]interface{}{[]string{"a"}, map[string]interface{}{"b": []int{1}}, nil}, `[["a"], {"b": [1]}, None]`},
+	} {
+		a, err := Marshal(test.v)
+		if err != nil {
+			t.Errorf("Failed to marshal %#v: %v", test.v, err)
+		} else if string(a) != test.e {
+			t.Errorf("Expected %#v but got %#v", test.e, string(a))
+		}
+	}
+}
@@ -0,0 +1,228 @@
+/*
+ * Copyright 2019 The Kythe Authors. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package writer
+
+// Option is a configuration option for a StarlarkWriter.
+type Option func(*StarlarkWriter)
+
+// SanitizeNames configures the writer to sanitize invalid macro and command names
+// rather than rejecting them. Macro names are additionally made unique.
+func SanitizeNames(sanitize bool) Option {
+	return func(sw *StarlarkWriter) {
+		if sanitize {
+			sw.idents = NewIdentAllocator()
+		} else {
+			sw.idents = nil
+		}
+	}
+}
+
+// CommentRenames configures the writer to annotate macro definitions and commands
+// with a comment recording the original name when it differs from the one written.
+func CommentRenames(comment bool) Option {
+	return func(sw *StarlarkWriter) { sw.commentRenames = comment }
+}
+
+// Quotes configures the quote character the writer uses for string literals.
+func Quotes(style QuoteStyle) Option {
+	return func(sw *StarlarkWriter) { sw.marshal.Quote = style }
+}
+
+// TypeComments configures the writer to follow each macro definition with a
+// type comment listing the types of its parameters, e.g. "# type: (ctx, list[str]) -> ctx".
+// When enabled, every parameter must have a type.
+func TypeComments(comment bool) Option {
+	return func(sw *StarlarkWriter) { sw.typeComments = comment }
+}
+
+// PassContextArg configures whether the writer passes ctx as the first argument
+// to each command, e.g. ctx.cmd(ctx, args...), or only the provided arguments, e.g. ctx.cmd(args...).
+// The default is to pass ctx.
+func PassContextArg(pass bool) Option {
+	return func(sw *StarlarkWriter) { sw.omitContextArg = !pass }
+}
+
+// ContextName configures the name of the context parameter of each macro, which is passed to
+// each command and returned, in place of ctx. The name must be a valid Starlark identifier,
+// or beginning a macro returns an error.
+func ContextName(name string) Option {
+	return func(sw *StarlarkWriter) { sw.ctxName = name }
+}
+
+// CommentsSuppressEmpty configures whether a directory containing only comments is
+// considered empty, in which case its push and pop are suppressed along with the comments.
+// By default, comments count as content of the directory.
+func CommentsSuppressEmpty(suppress bool) Option {
+	return func(sw *StarlarkWriter) { sw.commentsSuppressEmpty = suppress }
+}
+
+// CommentTabWidth configures the writer to replace tabs within comments with spaces,
+// aligned to multiples of width. By default, or if width is not positive, tabs are kept.
+func CommentTabWidth(width int) Option {
+	return func(sw *StarlarkWriter) { sw.commentTabWidth = width }
+}
+
+// DropEmptyCommentLines configures the writer to omit empty lines from comments,
+// rather than writing them as a bare #.
+func DropEmptyCommentLines(drop bool) Option {
+	return func(sw *StarlarkWriter) { sw.dropEmptyCommentLines = drop }
+}
+
+// Signatures configures the writer to validate the arguments to the named commands against
+// their signatures, returning an error without writing anything if they do not match.
+// Commands without a registered signature are not validated.
+func Signatures(sigs map[string]CommandSignature) Option {
+	return func(sw *StarlarkWriter) {
+		sw.signatures = make(map[string]CommandSignature, len(sigs))
+		for cmd, sig := range sigs {
+			sw.signatures[cmd] = sig
+		}
+	}
+}
+
+// MaxDepth configures the maximum number of directories which may be nested at once,
+// beyond which PushDirectory returns an error. A non-positive depth disables the limit.
+// The default is DefaultMaxDepth.
+func MaxDepth(depth int) Option {
+	return func(sw *StarlarkWriter) { sw.maxDepth = depth }
+}
+
+// DropEmptyArgs configures the writer to omit empty string positional arguments from commands,
+// rather than writing them as "". Keyword arguments are always written.
+func DropEmptyArgs(drop bool) Option {
+	return func(sw *StarlarkWriter) { sw.dropEmptyArgs = drop }
+}
+
+// PathLabels configures the writer to replace each string positional argument of a command
+// for which match returns true, such as source file paths, with its label relative to
+// the current directory, as returned by ToLabel.
+func PathLabels(match func(arg string) bool) Option {
+	return func(sw *StarlarkWriter) { sw.pathLabels = match }
+}
+
+// OmitNoneKwargs configures the writer to omit keyword arguments whose value is written as None,
+// such as nil pointers, for rules which treat an absent attribute and None equivalently.
+func OmitNoneKwargs(omit bool) Option {
+	return func(sw *StarlarkWriter) { sw.omitNoneKwargs = omit }
+}
+
+// CanonicalAttributeOrder configures the writer to write the keyword arguments of WriteCommandKw
+// in the order used by buildifier for rule attributes, with name first, rather than alphabetically.
+// Attributes unknown to buildifier follow all known attributes, in alphabetical order.
+func CanonicalAttributeOrder(canonical bool) Option {
+	return func(sw *StarlarkWriter) { sw.canonicalOrder = canonical }
+}
+
+// OnLine configures the writer to pass each line of output, without its trailing newline,
+// to hook before it is written. The line returned by hook is written in its place,
+// unless hook returns false, in which case the line is dropped.
+func OnLine(hook func(line string) (string, bool)) Option {
+	return func(sw *StarlarkWriter) { sw.onLine = hook }
+}
+
+// CompactMacros configures the writer to write a macro whose body is a single simple statement
+// on the line declaring it, e.g. def name(ctx): ctx.cmd(ctx); return ctx.
+// Macros with comments, blocks or multi-line statements are written as usual.
+func CompactMacros(compact bool) Option {
+	return func(sw *StarlarkWriter) { sw.compactMacros = compact }
+}
+
+// FinalizeOnFlush configures the writer to treat a successful Flush as finalizing its output,
+// after which any attempt to write returns an error rather than being silently appended.
+func FinalizeOnFlush(finalize bool) Option {
+	return func(sw *StarlarkWriter) { sw.finalizeOnFlush = finalize }
+}
+
+// CaptureMacros configures the writer to render each macro into an internal buffer
+// rather than the underlying writer, such that the text of complete macros may be
+// retrieved using Finish and assembled by the caller. Load statements are not captured.
+func CaptureMacros(capture bool) Option {
+	return func(sw *StarlarkWriter) { sw.capture = capture }
+}
+
+// StrictUTF8 configures the writer to reject any string which is not valid UTF-8,
+// rather than escaping each invalid byte.
+func StrictUTF8(strict bool) Option {
+	return func(sw *StarlarkWriter) { sw.marshal.StrictUTF8 = strict }
+}
+
+// DirectoryComments configures the writer to annotate each pop_directory with a comment
+// naming the directory being exited, quoted exactly as in the corresponding push_directory.
+func DirectoryComments(comment bool) Option {
+	return func(sw *StarlarkWriter) { sw.directoryComments = comment }
+}
+
+// RequireSelectDefault configures the writer to reject any Select without a
+// //conditions:default entry, which fails analysis for unmatched configurations.
+func RequireSelectDefault(require bool) Option {
+	return func(sw *StarlarkWriter) { sw.marshal.RequireSelectDefault = require }
+}
+
+// DeclareMacros configures the form in which the writer declares macros.
+// Lambda macros consist of a single command or returned expression, or return ctx if empty.
+// The default is DefMacros.
+func DeclareMacros(style MacroStyle) Option {
+	return func(sw *StarlarkWriter) { sw.macroStyle = style }
+}
+
+// CollectErrors configures the writer to record validation errors, such as invalid
+// command names or arguments and unbalanced blocks or directories, rather than returning them.
+// The invalid construct is omitted from the output and the errors are available from Errors,
+// such that a single run may report every problem.
+func CollectErrors(collect bool) Option {
+	return func(sw *StarlarkWriter) { sw.collectErrors = collect }
+}
+
+// WrapValues configures the writer to write non-empty lists and dicts one element per line,
+// as with MarshalIndent, using the writer's indentation. Each element, including the last,
+// is followed by a comma and the closing bracket is written on its own line.
+func WrapValues(wrap bool) Option {
+	return func(sw *StarlarkWriter) {
+		if wrap {
+			sw.marshal.Indent = sw.indent
+		} else {
+			sw.marshal.Indent = ""
+		}
+	}
+}
+
+// CountCommands configures the writer to count the number of times each command is written,
+// as reported by CommandCounts.
+func CountCommands(count bool) Option {
+	return func(sw *StarlarkWriter) {
+		if count {
+			sw.commandCounts = make(map[string]int)
+		} else {
+			sw.commandCounts = nil
+		}
+	}
+}
+
+// HelperLoad configures the writer to load symbol from file, such as the implementation of ctx,
+// before the first load statement or macro it writes. Explicit loads of the same symbol from file
+// are merged with the helper load rather than repeated.
+func HelperLoad(file, symbol string) Option {
+	return func(sw *StarlarkWriter) { sw.helperFile, sw.helperSymbol = file, symbol }
+}
+
+// SingleMacro configures the writer to write every statement within a single macro named name,
+// which is begun implicitly by the first statement and ended by Flush, such that the output
+// is one callable containing each of the directories pushed in turn.
+// BeginMacro and EndMacro return an error when the writer is so configured.
+func SingleMacro(name string) Option {
+	return func(sw *StarlarkWriter) { sw.singleMacro = name }
+}
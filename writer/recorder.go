@@ -0,0 +1,178 @@
+/*
+ * Copyright 2019 The Kythe Authors. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package writer
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+)
+
+// MacroWriter is the interface shared by StarlarkWriter and JSONRecorder.
+type MacroWriter interface {
+	WriteLoad(file string, symbols ...string) error
+	BeginMacro(name string) error
+	EndMacro() error
+	BeginIf(cond interface{}) error
+	ElseIf(cond interface{}) error
+	Else() error
+	EndIf() error
+	BeginFor(name string, iterable interface{}) error
+	EndFor() error
+	PushDirectory(path string) error
+	PopDirectory() (string, error)
+	WriteCommand(cmd string, args ...interface{}) error
+	WriteCommandKw(cmd string, kwargs map[string]interface{}, args ...interface{}) error
+	WriteAssignment(name string, value interface{}) error
+	Flush() error
+}
+
+var (
+	_ MacroWriter = (*StarlarkWriter)(nil)
+	_ MacroWriter = (*JSONRecorder)(nil)
+)
+
+// Event is a single recorded call to a MacroWriter.
+// Argument values are recorded in their marshaled Starlark form.
+type Event struct {
+	Op     string            `json:"op"`
+	Name   string            `json:"name,omitempty"`
+	Args   []string          `json:"args,omitempty"`
+	Kwargs map[string]string `json:"kwargs,omitempty"`
+}
+
+// JSONRecorder is a MacroWriter which, rather than rendering Starlark,
+// writes each call as a JSON-encoded Event, one per line.
+type JSONRecorder struct {
+	enc      *json.Encoder
+	dirStack []string
+}
+
+// NewJSONRecorder creates a new JSONRecorder writing to the provided output.
+func NewJSONRecorder(w io.Writer) *JSONRecorder {
+	return &JSONRecorder{enc: json.NewEncoder(w)}
+}
+
+// WriteLoad records a load of the given symbols from file.
+func (jr *JSONRecorder) WriteLoad(file string, symbols ...string) error {
+	return jr.record(Event{Op: "load", Name: file, Args: symbols})
+}
+
+// BeginMacro records the start of a macro.
+func (jr *JSONRecorder) BeginMacro(name string) error {
+	return jr.record(Event{Op: "begin_macro", Name: name})
+}
+
+// EndMacro records the end of the current macro.
+func (jr *JSONRecorder) EndMacro() error {
+	return jr.record(Event{Op: "end_macro"})
+}
+
+// BeginIf records the start of an if statement.
+func (jr *JSONRecorder) BeginIf(cond interface{}) error {
+	return jr.recordArgs(Event{Op: "if"}, cond)
+}
+
+// ElseIf records the start of an elif branch.
+func (jr *JSONRecorder) ElseIf(cond interface{}) error {
+	return jr.recordArgs(Event{Op: "elif"}, cond)
+}
+
+// Else records the start of an else branch.
+func (jr *JSONRecorder) Else() error {
+	return jr.record(Event{Op: "else"})
+}
+
+// EndIf records the end of an if statement.
+func (jr *JSONRecorder) EndIf() error {
+	return jr.record(Event{Op: "endif"})
+}
+
+// BeginFor records the start of a for loop.
+func (jr *JSONRecorder) BeginFor(name string, iterable interface{}) error {
+	return jr.recordArgs(Event{Op: "for", Name: name}, iterable)
+}
+
+// EndFor records the end of a for loop.
+func (jr *JSONRecorder) EndFor() error {
+	return jr.record(Event{Op: "endfor"})
+}
+
+// PushDirectory records entering a directory.
+func (jr *JSONRecorder) PushDirectory(path string) error {
+	jr.dirStack = append(jr.dirStack, path)
+	return jr.record(Event{Op: "push_directory", Name: path})
+}
+
+// PopDirectory records exiting the current directory, returning its path.
+func (jr *JSONRecorder) PopDirectory() (string, error) {
+	if len(jr.dirStack) == 0 {
+		return "", errors.New("directory stack is empty")
+	}
+	path := pop(&jr.dirStack)
+	return path, jr.record(Event{Op: "pop_directory", Name: path})
+}
+
+// WriteCommand records an invocation of the provided command and arguments.
+func (jr *JSONRecorder) WriteCommand(cmd string, args ...interface{}) error {
+	return jr.recordArgs(Event{Op: "command", Name: cmd}, args...)
+}
+
+// WriteCommandKw records an invocation of the provided command with positional and keyword arguments.
+func (jr *JSONRecorder) WriteCommandKw(cmd string, kwargs map[string]interface{}, args ...interface{}) error {
+	ev := Event{Op: "command", Name: cmd, Kwargs: make(map[string]string, len(kwargs))}
+	names := make([]string, 0, len(kwargs))
+	for name := range kwargs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		val, err := Marshal(kwargs[name])
+		if err != nil {
+			return err
+		}
+		ev.Kwargs[name] = string(val)
+	}
+	return jr.recordArgs(ev, args...)
+}
+
+// WriteAssignment records an assignment of the provided value to the named variable.
+func (jr *JSONRecorder) WriteAssignment(name string, value interface{}) error {
+	return jr.recordArgs(Event{Op: "assign", Name: name}, value)
+}
+
+// Flush is a no-op, as each event is written as it is recorded.
+func (jr *JSONRecorder) Flush() error {
+	return nil
+}
+
+// recordArgs marshals args into ev before recording it.
+func (jr *JSONRecorder) recordArgs(ev Event, args ...interface{}) error {
+	for _, arg := range args {
+		val, err := Marshal(arg)
+		if err != nil {
+			return err
+		}
+		ev.Args = append(ev.Args, string(val))
+	}
+	return jr.record(ev)
+}
+
+func (jr *JSONRecorder) record(ev Event) error {
+	return jr.enc.Encode(ev)
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright 2019 The Kythe Authors. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package writer
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestJSONRecorder(t *testing.T) {
+	var b strings.Builder
+	var w MacroWriter = NewJSONRecorder(&b)
+	if err := w.BeginMacro("hello_world"); err != nil {
+		t.Fatal("Unexpected error recording macro: ", err)
+	}
+	if err := w.PushDirectory("lib"); err != nil {
+		t.Fatal("Unexpected error recording directory: ", err)
+	}
+	if err := w.WriteCommand("run", "with", 1); err != nil {
+		t.Fatal("Unexpected error recording command: ", err)
+	}
+	if err := w.WriteCommandKw("cc_library", map[string]interface{}{"name": "lib", "srcs": []string{"a.cc"}}); err != nil {
+		t.Fatal("Unexpected error recording command: ", err)
+	}
+	if p, err := w.PopDirectory(); err != nil {
+		t.Fatal("Unexpected error recording directory: ", err)
+	} else if p != "lib" {
+		t.Errorf("Unexpected directory path: %s", p)
+	}
+	if err := w.EndMacro(); err != nil {
+		t.Fatal("Unexpected error ending macro: ", err)
+	}
+
+	var events []Event
+	dec := json.NewDecoder(strings.NewReader(b.String()))
+	for dec.More() {
+		var ev Event
+		if err := dec.Decode(&ev); err != nil {
+			t.Fatal("Unexpected error decoding event: ", err)
+		}
+		events = append(events, ev)
+	}
+	expected := []Event{
+		{Op: "begin_macro", Name: "hello_world"},
+		{Op: "push_directory", Name: "lib"},
+		{Op: "command", Name: "run", Args: []string{`"with"`, "1"}},
+		{Op: "command", Name: "cc_library", Kwargs: map[string]string{"name": `"lib"`, "srcs": `["a.cc"]`}},
+		{Op: "pop_directory", Name: "lib"},
+		{Op: "end_macro"},
+	}
+	if diff := cmp.Diff(expected, events); diff != "" {
+		t.Error("Unexpected events:\n", diff)
+	}
+}
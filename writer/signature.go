@@ -0,0 +1,63 @@
+/*
+ * Copyright 2019 The Kythe Authors. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package writer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CommandSignature describes the arguments expected by a command.
+type CommandSignature struct {
+	MinArgs int // The minimum number of positional arguments.
+	// The maximum number of positional arguments. If zero or negative, as when left unset,
+	// any number of positional arguments is allowed.
+	MaxArgs     int
+	KeywordOnly bool     // If true, no positional arguments are allowed, regardless of MaxArgs.
+	Required    []string // The keyword arguments which must be provided.
+}
+
+// validate returns an error describing the ways in which args do not match the signature of cmd.
+func (s CommandSignature) validate(cmd string, args []interface{}) error {
+	var positional int
+	kwargs := make(map[string]bool)
+	for _, arg := range args {
+		if kw, ok := arg.(keywordArg); ok {
+			kwargs[kw.name] = true
+		} else {
+			positional++
+		}
+	}
+	var problems []string
+	if positional < s.MinArgs {
+		problems = append(problems, fmt.Sprintf("at least %d positional arguments required, found %d", s.MinArgs, positional))
+	}
+	if s.KeywordOnly && positional > 0 {
+		problems = append(problems, fmt.Sprintf("no positional arguments allowed, found %d", positional))
+	} else if s.MaxArgs > 0 && positional > s.MaxArgs {
+		problems = append(problems, fmt.Sprintf("at most %d positional arguments allowed, found %d", s.MaxArgs, positional))
+	}
+	for _, name := range s.Required {
+		if !kwargs[name] {
+			problems = append(problems, fmt.Sprintf("missing required keyword argument %q", name))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid arguments to %s: %s", cmd, strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+/*
+ * Copyright 2019 The Kythe Authors. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package writer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCommandSignatures(t *testing.T) {
+	var b strings.Builder
+	writer := NewStarlarkWriter(&b, Signatures(map[string]CommandSignature{
+		"cc_library": {KeywordOnly: true, Required: []string{"name"}},
+		"message":    {MinArgs: 1},
+		"pair":       {MaxArgs: 2},
+	}))
+	if err := writer.BeginMacro("hello_world"); err != nil {
+		t.Fatal("Unexpected error writing macro: ", err)
+	}
+	if err := writer.WriteCommandKw("cc_library", map[string]interface{}{"srcs": []string{"a.cc"}}); err == nil {
+		t.Error("Expected error writing cc_library without a name")
+	} else if expected := `invalid arguments to cc_library: missing required keyword argument "name"`; err.Error() != expected {
+		t.Errorf("Expected error %q but got %q", expected, err)
+	}
+	if err := writer.WriteCommandKw("cc_library", map[string]interface{}{"name": "a"}, "extra"); err == nil {
+		t.Error("Expected error writing cc_library with positional arguments")
+	}
+	if err := writer.WriteCommand("message"); err == nil {
+		t.Error("Expected error writing message without arguments")
+	}
+	if err := writer.WriteCommand("pair", "a", "b", "c"); err == nil {
+		t.Error("Expected error writing pair with three arguments")
+	} else if expected := "invalid arguments to pair: at most 2 positional arguments allowed, found 3"; err.Error() != expected {
+		t.Errorf("Expected error %q but got %q", expected, err)
+	}
+	if err := writer.WriteCommandKw("cc_library", map[string]interface{}{"name": "a"}); err != nil {
+		t.Error("Unexpected error writing command: ", err)
+	}
+	if err := writer.WriteCommand("message", "a", "b", "c"); err != nil {
+		t.Error("Unexpected error writing command: ", err)
+	}
+	if err := writer.WriteCommand("unregistered"); err != nil {
+		t.Error("Unexpected error writing command: ", err)
+	}
+	if err := writer.EndMacro(); err != nil {
+		t.Fatal("Unexpected error ending macro: ", err)
+	}
+	expected := "def hello_world(ctx):\n" +
+		"    ctx.cc_library(ctx, name = \"a\")\n" +
+		"    ctx.message(ctx, \"a\", \"b\", \"c\")\n" +
+		"    ctx.unregistered(ctx)\n" +
+		"    return ctx\n"
+	if diff := cmp.Diff(expected, b.String()); diff != "" {
+		t.Error("Unexpected writer output:\n", diff)
+	}
+}
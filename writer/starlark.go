@@ -18,16 +18,23 @@ package writer
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
+	"path"
 	"regexp"
+	"sort"
+	"strings"
+	"unicode"
 
 	"bitbucket.org/creachadair/stringset"
 )
 
 var (
 	validIdentPattern = regexp.MustCompile(`^[a-zA-Z_]\w*$`)
+	// targetNamePattern matches the characters permitted in a Bazel target name.
+	targetNamePattern = regexp.MustCompile(`^[a-zA-Z0-9!%@^_"#$&'()*+,;<=>?\[\]{|}~/.-]+$`)
 	starlarkReserved  = stringset.New(
 		"if", "elif", "else", "assert",
 		"and", "or", "not", "in", "is", "as",
@@ -38,61 +45,707 @@ var (
 	)
 )
 
+// DefaultMaxDepth is the default maximum number of nested directories, see MaxDepth.
+const DefaultMaxDepth = 256
+
 // StarlarkWriter is a simple type for writing basic Starlark macros with a consistent form.
 type StarlarkWriter struct {
 	w            *bufio.Writer
-	buf          []string
+	buf          []bufEntry
 	currentMacro string
 	dirStack     []string
+	blocks       []*block
+	indent       string
+
+	idents         *IdentAllocator
+	commentRenames bool
+	marshal        MarshalOptions
+	typeComments   bool
+	omitContextArg bool
+
+	commentsSuppressEmpty bool
+	commentTabWidth       int
+	dropEmptyCommentLines bool
+	signatures            map[string]CommandSignature
+	maxDepth              int
+	dropEmptyArgs         bool
+	pathLabels            func(arg string) bool
+	omitNoneKwargs        bool
+	canonicalOrder        bool
+	directoryComments     bool
+
+	written bool // True if anything has been written.
+
+	finalizeOnFlush bool
+	finalized       bool // True if the writer has been flushed with finalizeOnFlush set.
+
+	onLine      func(line string) (string, bool)
+	partialLine string // Text written since the last newline, if filtering lines.
+
+	ctxName     string // The name of the context parameter, passed to and returned by each macro.
+	singleMacro string // If non-empty, the name of the implicit macro enclosing every statement.
+
+	helperFile    string
+	helperSymbol  string
+	helperWritten bool // True if the helper load has been written.
+
+	leadingComments string // Comments written outside of a macro, pending the next top-level statement.
+
+	prelude     []string          // Pending top-level statements, written before the next macro.
+	preludeSeen map[string]string // The prelude assignment to each name, for de-duplication.
+
+	commandCounts map[string]int // If non-nil, the number of times each command has been written.
+	collectErrors bool
+	errs          []error
+
+	macroStyle   MacroStyle
+	lambdaHeader string // The declaration of the current lambda macro, written with its body.
+	lambdaBody   string // The expression of the current lambda macro, if any.
+
+	compactMacros bool
+	compactHeader string   // The declaration of the current macro, if held by CompactMacros.
+	compactBody   []string // The text written within the current macro while its declaration is held.
+
+	capture   bool
+	capturing bool         // True if the current macro is being captured.
+	macroBuf  bytes.Buffer // The text of the current macro, if capturing.
+	captured  []byte       // The text of the macros captured since the last call to Finish.
 }
 
 // NewStarlarkWriter creates a new StarlarkWriter writing to the provided output.
-func NewStarlarkWriter(w io.Writer) *StarlarkWriter {
-	return &StarlarkWriter{w: bufio.NewWriter(w)}
+func NewStarlarkWriter(w io.Writer, opts ...Option) *StarlarkWriter {
+	return NewStarlarkWriterSize(w, 0, opts...)
+}
+
+// NewStarlarkWriterSize creates a new StarlarkWriter writing to the provided output,
+// whose buffer has at least the specified size. As with bufio.NewWriterSize,
+// a non-positive size selects the default.
+func NewStarlarkWriterSize(w io.Writer, size int, opts ...Option) *StarlarkWriter {
+	sw := &StarlarkWriter{w: bufio.NewWriterSize(w, size), indent: "    ", ctxName: "ctx", maxDepth: DefaultMaxDepth}
+	for _, o := range opts {
+		o(sw)
+	}
+	return sw
+}
+
+// BufferedStarlarkWriter is a StarlarkWriter which writes to an internal buffer.
+type BufferedStarlarkWriter struct {
+	*StarlarkWriter
+	buf bytes.Buffer
+}
+
+// NewBufferedStarlarkWriter creates a new StarlarkWriter writing to an internal buffer,
+// whose contents are available via Bytes, String and WriteTo.
+func NewBufferedStarlarkWriter(opts ...Option) *BufferedStarlarkWriter {
+	bw := &BufferedStarlarkWriter{}
+	bw.StarlarkWriter = NewStarlarkWriter(&bw.buf, opts...)
+	return bw
+}
+
+// Bytes returns the output written so far, including any partially written macro.
+func (bw *BufferedStarlarkWriter) Bytes() []byte {
+	// Writes to a bytes.Buffer cannot fail.
+	bw.w.Flush()
+	return bw.buf.Bytes()
+}
+
+// String returns the output written so far as a string.
+func (bw *BufferedStarlarkWriter) String() string {
+	return string(bw.Bytes())
+}
+
+// WriteTo implements io.WriterTo, writing the output written so far to w.
+// The output is consumed, as with bytes.Buffer.
+func (bw *BufferedStarlarkWriter) WriteTo(w io.Writer) (int64, error) {
+	bw.w.Flush()
+	return bw.buf.WriteTo(w)
+}
+
+// WriteLoad writes a load statement importing the given symbols from file.
+// Load statements must be written outside of any macro.
+func (sw *StarlarkWriter) WriteLoad(file string, symbols ...string) error {
+	syms := make([]LoadSymbol, len(symbols))
+	for i, sym := range symbols {
+		syms[i] = LoadSymbol{Name: sym}
+	}
+	return sw.WriteLoadSymbols(file, syms...)
+}
+
+// WriteModuleDocstring writes text as the docstring of the module, which must precede everything else.
+func (sw *StarlarkWriter) WriteModuleDocstring(text string) error {
+	if err := sw.checkFinalized(); err != nil {
+		return err
+	}
+	if sw.written || sw.currentMacro != "" {
+		return errors.New("module docstring must be written first")
+	}
+	text = strings.Replace(text, `\`, `\\`, -1)
+	text = strings.Replace(text, `"""`, `\"\"\"`, -1)
+	if strings.HasSuffix(text, `"`) {
+		// Prevent a final quote from running into the closing delimiter.
+		text = text[:len(text)-1] + `\"`
+	}
+	return sw.writeString(`"""` + text + `"""` + "\n")
+}
+
+// LoadSymbol is a symbol imported by a load statement, optionally bound to an alias.
+type LoadSymbol struct {
+	Alias string // If non-empty, the identifier to which the symbol is bound.
+	Name  string // The name of the symbol within the loaded file.
+}
+
+// key returns the name under which the symbol is bound by the load statement.
+func (ls LoadSymbol) key() string {
+	if ls.Alias != "" {
+		return ls.Alias
+	}
+	return ls.Name
+}
+
+// WriteLoadSymbols is like WriteLoad, but writes aliased symbols as alias = "name".
+// Symbols are sorted by the name to which they are bound.
+func (sw *StarlarkWriter) WriteLoadSymbols(file string, symbols ...LoadSymbol) error {
+	if err := sw.checkFinalized(); err != nil {
+		return err
+	}
+	if sw.currentMacro != "" {
+		return errors.New("load statements are not allowed within a macro")
+	}
+	if len(symbols) == 0 {
+		return errors.New("load statements require at least one symbol")
+	}
+	sorted := append([]LoadSymbol(nil), symbols...)
+	if sw.helperSymbol != "" && file == sw.helperFile {
+		helper := LoadSymbol{Name: sw.helperSymbol}
+		var rest []LoadSymbol
+		for _, sym := range sorted {
+			if sym.key() != helper.key() || sym.Name != helper.Name {
+				rest = append(rest, sym)
+			}
+		}
+		if sw.helperWritten {
+			if len(rest) == 0 {
+				return nil
+			}
+		} else {
+			sw.helperWritten = true
+			rest = append(rest, helper)
+		}
+		sorted = rest
+	} else if err := sw.writeHelperLoad(); err != nil {
+		return err
+	}
+	if err := sw.writeLeadingComments(); err != nil {
+		return err
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].key() < sorted[j].key() })
+	path, err := sw.marshal.Marshal(file)
+	if err != nil {
+		return err
+	}
+	vals := []string{string(path)}
+	for _, sym := range sorted {
+		if sym.Name == "" {
+			return errors.New("load statements require non-empty symbol names")
+		}
+		name, err := sw.marshal.Marshal(QuotedIdent(sym.Name))
+		if err != nil {
+			return err
+		}
+		if sym.Alias == "" || sym.Alias == sym.Name {
+			vals = append(vals, string(name))
+			continue
+		}
+		if !validIdentPattern.MatchString(sym.Alias) || starlarkReserved.Contains(sym.Alias) {
+			return fmt.Errorf("invalid Starlark identifier: %s", sym.Alias)
+		}
+		vals = append(vals, fmt.Sprintf("%s = %s", sym.Alias, name))
+	}
+	return sw.writeString(fmt.Sprintf("load(%s)\n", strings.Join(vals, ", ")))
+}
+
+// takeLeadingComments returns and clears the comments pending the next top-level statement.
+func (sw *StarlarkWriter) takeLeadingComments() string {
+	lines := sw.leadingComments
+	sw.leadingComments = ""
+	return lines
+}
+
+// writeLeadingComments writes any comments pending the next top-level statement.
+func (sw *StarlarkWriter) writeLeadingComments() error {
+	if sw.leadingComments == "" {
+		return nil
+	}
+	return sw.writeString(sw.takeLeadingComments())
+}
+
+// errImplicitMacro is returned when beginning or ending a macro explicitly while configured with SingleMacro.
+var errImplicitMacro = errors.New("macros are implicit when configured with SingleMacro")
+
+// requireMacro returns an error if there is no current macro, unless configured with SingleMacro,
+// in which case the implicit macro is begun.
+func (sw *StarlarkWriter) requireMacro() error {
+	if sw.currentMacro != "" {
+		return nil
+	}
+	if sw.singleMacro != "" {
+		return sw.beginMacro(sw.singleMacro)
+	}
+	return errors.New("no current macro")
+}
+
+// writeHelperLoad writes the load configured by HelperLoad, if it has not already been written.
+func (sw *StarlarkWriter) writeHelperLoad() error {
+	if sw.helperSymbol == "" || sw.helperWritten {
+		return nil
+	}
+	// Pending comments document the statement which required the helper, not the helper itself.
+	comments := sw.takeLeadingComments()
+	err := sw.WriteLoad(sw.helperFile, sw.helperSymbol)
+	sw.leadingComments = comments
+	return err
+}
+
+// block is an open compound statement within a macro.
+type block struct {
+	kind       string // One of "def", "if", "elif", "else" or "for".
+	statements int    // The number of statements written directly within the block.
+	terminated bool   // True if the block ends with a return statement.
 }
 
+// Param is an additional parameter of a macro, following ctx.
+type Param struct {
+	Name    string
+	Default interface{} // If non-nil, the default value of the parameter.
+	Type    string      // The type of the parameter, written when type comments are enabled.
+}
+
+// MacroStyle selects the form in which macros are declared.
+type MacroStyle int
+
+// Constants defining the supported macro styles.
+const (
+	DefMacros    MacroStyle = iota // Macros are declared as functions: def name(ctx): ...
+	LambdaMacros                   // Macros are bound to a lambda of a single expression: name = lambda ctx: ...
+)
+
 // BeginMacro starts writing a new macro with the given name.
 func (sw *StarlarkWriter) BeginMacro(name string) error {
+	return sw.BeginMacroParams(name)
+}
+
+// BeginMacroParams starts writing a new macro with the given name, taking the
+// provided parameters in addition to ctx.
+func (sw *StarlarkWriter) BeginMacroParams(name string, params ...Param) error {
+	if sw.singleMacro != "" {
+		return errImplicitMacro
+	}
+	return sw.beginMacro(name, params...)
+}
+
+func (sw *StarlarkWriter) beginMacro(name string, params ...Param) error {
+	if err := sw.checkFinalized(); err != nil {
+		return err
+	}
 	if sw.currentMacro != "" {
 		return errors.New("nested macros are not allowed")
 	}
-	name, err := identName(name)
+	if err := sw.writeHelperLoad(); err != nil {
+		return err
+	}
+	if err := sw.writePrelude(); err != nil {
+		return err
+	}
+	if !validIdentPattern.MatchString(sw.ctxName) || starlarkReserved.Contains(sw.ctxName) {
+		return fmt.Errorf("invalid context name: %q", sw.ctxName)
+	}
+	ident, err := sw.macroName(name)
 	if err != nil {
 		return err
 	}
-	sw.buf = append(sw.buf, fmt.Sprintf("def %s(ctx):\n", name))
-	sw.currentMacro = name
+	decls := []string{sw.ctxName}
+	types := []string{"ctx"}
+	for _, p := range params {
+		decl, err := identName(p.Name)
+		if err != nil {
+			return err
+		}
+		if p.Default != nil {
+			val, err := sw.marshal.Marshal(p.Default)
+			if err != nil {
+				return err
+			}
+			decl += " = " + string(val)
+		}
+		if sw.typeComments && strings.TrimSpace(p.Type) == "" {
+			return fmt.Errorf("missing type for parameter %s of macro %s", p.Name, name)
+		}
+		decls = append(decls, decl)
+		types = append(types, p.Type)
+	}
+	if sw.macroStyle == LambdaMacros {
+		if sw.typeComments {
+			return fmt.Errorf("type comments are not supported for lambda macro %s", name)
+		}
+		sw.currentMacro = ident
+		sw.blocks = []*block{{kind: "def"}}
+		sw.lambdaHeader = sw.takeLeadingComments() + fmt.Sprintf("%s = lambda %s: ", ident, strings.Join(decls, ", "))
+		sw.lambdaBody = ""
+		return nil
+	}
+	comment := sw.renameComment(name, ident)
+	text := sw.takeLeadingComments() + fmt.Sprintf("def %s(%s):%s\n", ident, strings.Join(decls, ", "), comment)
+	if sw.typeComments {
+		text += fmt.Sprintf("%s# type: (%s) -> ctx\n", sw.indent, strings.Join(types, ", "))
+	}
+	sw.capturing = sw.capture
+	sw.currentMacro = ident
+	sw.blocks = []*block{{kind: "def"}}
+	if sw.compactMacros && comment == "" && !sw.typeComments {
+		// Hold the declaration until it is known whether the body is a single statement.
+		sw.written = true
+		sw.compactHeader = strings.TrimSuffix(text, "\n")
+		return nil
+	}
+	if err := sw.writeString(text); err != nil {
+		return err
+	}
 	return nil
 }
 
 // EndMacro ends writing the current macro; flushing any pending output.
 func (sw *StarlarkWriter) EndMacro() error {
+	if sw.singleMacro != "" {
+		return errImplicitMacro
+	}
+	return sw.endMacro()
+}
+
+func (sw *StarlarkWriter) endMacro() error {
 	if sw.currentMacro == "" {
 		return errors.New("no current macro")
 	}
+	if len(sw.blocks) > 1 {
+		if err := sw.report(fmt.Errorf("unclosed %s block in macro %s", sw.topBlock().kind, sw.currentMacro)); err != nil {
+			return err
+		}
+		sw.blocks = sw.blocks[:1]
+	}
+	if len(sw.dirStack) > 0 {
+		if err := sw.report(fmt.Errorf("unclosed directory %q in macro %s", sw.dirStack[len(sw.dirStack)-1], sw.currentMacro)); err != nil {
+			return err
+		}
+		sw.dirStack, sw.buf = nil, nil
+	}
 	err := sw.writeBuffered()
 	if err != nil {
 		return err
 	}
-	if err := sw.writeString(sw.indentf("return ctx\n")); err != nil {
-		return err
+	if sw.macroStyle == LambdaMacros {
+		body := sw.lambdaBody
+		if body == "" {
+			body = sw.ctxName
+		}
+		sw.capturing = sw.capture
+		if err := sw.writeString(sw.lambdaHeader + body + "\n"); err != nil {
+			return err
+		}
+	} else if sw.compactHeader != "" {
+		if err := sw.endCompactMacro(); err != nil {
+			return err
+		}
+	} else if !sw.blocks[0].terminated {
+		if err := sw.writeString(sw.indentf("return %s\n", sw.ctxName)); err != nil {
+			return err
+		}
 	}
 	sw.currentMacro = ""
+	sw.blocks = nil
+	if sw.capturing {
+		sw.capturing = false
+		sw.captured = append(sw.captured, sw.macroBuf.Bytes()...)
+		sw.macroBuf.Reset()
+		return nil
+	}
+	return sw.w.Flush()
+}
+
+// endCompactMacro writes a macro configured by CompactMacros whose body has at most one statement,
+// and so is still held, on a single line if the statement permits.
+func (sw *StarlarkWriter) endCompactMacro() error {
+	header, body := sw.compactHeader, sw.compactBody
+	sw.compactHeader, sw.compactBody = "", nil
+	terminated := sw.blocks[0].terminated
+	stmt := "return " + sw.ctxName
+	if len(body) == 1 {
+		line := strings.TrimPrefix(body[0], sw.indent)
+		// Only a simple statement on a single line, without any comment, may follow the declaration.
+		if strings.Count(line, "\n") != 1 || strings.Contains(line, "#") || strings.HasPrefix(line, " ") || strings.HasSuffix(line, ":\n") {
+			text := header + "\n" + body[0]
+			if !terminated {
+				text += sw.indentf("return %s\n", sw.ctxName)
+			}
+			return sw.writeString(text)
+		}
+		stmt = strings.TrimSuffix(line, "\n")
+		if !terminated {
+			stmt += "; return " + sw.ctxName
+		}
+	}
+	return sw.writeString(header + " " + stmt + "\n")
+}
+
+// Finish returns the text of the macros captured since the last call to Finish,
+// when configured with CaptureMacros. Any macro still being written is not included.
+func (sw *StarlarkWriter) Finish() []byte {
+	captured := sw.captured
+	sw.captured = nil
+	return captured
+}
+
+// BeginIf starts a new if statement with the given condition.
+// The condition is marshaled like any other value, so expressions should generally be Raw.
+func (sw *StarlarkWriter) BeginIf(cond interface{}) error {
+	val, err := sw.marshal.Marshal(cond)
+	if err != nil {
+		return err
+	}
+	return sw.beginBlock("if", fmt.Sprintf("if %s:\n", val))
+}
+
+// ElseIf ends the current if or elif branch and begins an elif branch with the given condition.
+func (sw *StarlarkWriter) ElseIf(cond interface{}) error {
+	val, err := sw.marshal.Marshal(cond)
+	if err != nil {
+		return err
+	}
+	return sw.continueBlock("elif", fmt.Sprintf("elif %s:\n", val), "if", "elif")
+}
+
+// Else ends the current if or elif branch and begins the else branch.
+func (sw *StarlarkWriter) Else() error {
+	return sw.continueBlock("else", "else:\n", "if", "elif")
+}
+
+// EndIf ends the current if statement.
+func (sw *StarlarkWriter) EndIf() error {
+	return sw.endBlock("if", "if", "elif", "else")
+}
+
+// ConditionalBranch is a single branch of an if statement written by WriteConditionalCommands.
+type ConditionalBranch struct {
+	Cond  interface{}                    // The condition of the branch, or nil for the final else branch.
+	Write func(sw *StarlarkWriter) error // If non-nil, writes the body of the branch.
+}
+
+// WriteConditionalCommands writes an if statement with a branch for each of branches in turn,
+// the first being the if branch, followed by elif branches and an optional final else branch.
+// Branches with an empty body are written as pass.
+func (sw *StarlarkWriter) WriteConditionalCommands(branches []ConditionalBranch) error {
+	if len(branches) == 0 || branches[0].Cond == nil {
+		return errors.New("conditional commands require an initial condition")
+	}
+	for i, b := range branches {
+		if b.Cond == nil && 0 < i && i < len(branches)-1 {
+			return errors.New("else branch must be the last of the conditional commands")
+		}
+	}
+	for i, b := range branches {
+		var err error
+		switch {
+		case i == 0:
+			err = sw.BeginIf(b.Cond)
+		case b.Cond != nil:
+			err = sw.ElseIf(b.Cond)
+		default:
+			err = sw.Else()
+		}
+		if err != nil {
+			return err
+		}
+		if b.Write != nil {
+			if err := b.Write(sw); err != nil {
+				return err
+			}
+		}
+	}
+	return sw.EndIf()
+}
+
+// BeginFor starts a new for loop binding the named variable to each element of iterable.
+func (sw *StarlarkWriter) BeginFor(name string, iterable interface{}) error {
+	ident, err := identName(name)
+	if err != nil {
+		return err
+	}
+	val, err := sw.marshal.Marshal(iterable)
+	if err != nil {
+		return err
+	}
+	return sw.beginBlock("for", fmt.Sprintf("for %s in %s:\n", ident, val))
+}
+
+// EndFor ends the current for loop.
+func (sw *StarlarkWriter) EndFor() error {
+	return sw.endBlock("for", "for")
+}
+
+// Flush verifies that every macro and block has been closed and flushes any pending output.
+// If configured with SingleMacro, Flush first ends the implicit macro.
+func (sw *StarlarkWriter) Flush() error {
+	if sw.singleMacro != "" && sw.currentMacro != "" && len(sw.dirStack) == 0 && len(sw.blocks) <= 1 {
+		if err := sw.endMacro(); err != nil {
+			return err
+		}
+	}
+	var open []string
+	if sw.currentMacro != "" {
+		open = append(open, fmt.Sprintf("macro %s", sw.currentMacro))
+	}
+	for _, dir := range sw.dirStack {
+		open = append(open, fmt.Sprintf("directory %q", dir))
+	}
+	for i := 1; i < len(sw.blocks); i++ {
+		open = append(open, fmt.Sprintf("%s block", sw.blocks[i].kind))
+	}
+	if len(open) > 0 {
+		return fmt.Errorf("unclosed constructs: %s", strings.Join(open, ", "))
+	}
+	if err := sw.writePrelude(); err != nil {
+		return err
+	}
+	if err := sw.writeLeadingComments(); err != nil {
+		return err
+	}
+	sw.finalized = sw.finalizeOnFlush
+	if sw.partialLine != "" {
+		line := sw.partialLine
+		sw.partialLine = ""
+		if line, ok := sw.onLine(line); ok {
+			if _, err := sw.w.WriteString(line); err != nil {
+				return err
+			}
+		}
+	}
 	return sw.w.Flush()
 }
 
+// beginBlock writes the header of a new compound statement and makes it the current block.
+func (sw *StarlarkWriter) beginBlock(kind, header string) error {
+	if err := sw.requireMacro(); err != nil {
+		return err
+	}
+	if err := sw.requireStatements(kind + " block"); err != nil {
+		return err
+	}
+	if err := sw.writeBuffered(); err != nil {
+		return err
+	}
+	if err := sw.writeStatement(sw.indentf(header)); err != nil {
+		return err
+	}
+	sw.blocks = append(sw.blocks, &block{kind: kind})
+	return nil
+}
+
+// continueBlock ends the current branch of a compound statement, which must be one of the
+// given kinds, and begins a new branch with the provided header.
+func (sw *StarlarkWriter) continueBlock(kind, header string, after ...string) error {
+	b := sw.topBlock()
+	if b == nil || !containsString(after, b.kind) {
+		return sw.report(fmt.Errorf("%s without matching %s", kind, after[0]))
+	}
+	if err := sw.closeBranch(b); err != nil {
+		return err
+	}
+	if err := sw.writeString(strings.Repeat(sw.indent, len(sw.blocks)-1) + header); err != nil {
+		return err
+	}
+	b.kind, b.statements, b.terminated = kind, 0, false
+	return nil
+}
+
+// endBlock ends the current compound statement, which must be one of the given kinds.
+func (sw *StarlarkWriter) endBlock(name string, kinds ...string) error {
+	b := sw.topBlock()
+	if b == nil || !containsString(kinds, b.kind) {
+		return sw.report(fmt.Errorf("end%s without matching %s", name, name))
+	}
+	if err := sw.closeBranch(b); err != nil {
+		return err
+	}
+	sw.blocks = sw.blocks[:len(sw.blocks)-1]
+	return nil
+}
+
+// closeBranch writes any pending output for the current block, ensuring it is not empty.
+func (sw *StarlarkWriter) closeBranch(b *block) error {
+	if err := sw.writeBuffered(); err != nil {
+		return err
+	}
+	if b.statements == 0 {
+		return sw.writeStatement(sw.indentf("pass\n"))
+	}
+	return nil
+}
+
+// topBlock returns the innermost open compound statement, excluding the macro itself.
+func (sw *StarlarkWriter) topBlock() *block {
+	if len(sw.blocks) <= 1 {
+		return nil
+	}
+	return sw.blocks[len(sw.blocks)-1]
+}
+
 // PushDirectory writes a Starlark directive indicating a new directory context should be used in the given path.
 func (sw *StarlarkWriter) PushDirectory(path string) error {
-	if sw.currentMacro == "" {
-		return errors.New("no current macro")
+	if err := sw.requireMacro(); err != nil {
+		return err
+	}
+	if err := sw.requireStatements("directory"); err != nil {
+		return err
+	}
+	if sw.maxDepth > 0 && len(sw.dirStack) >= sw.maxDepth {
+		return fmt.Errorf("maximum directory depth of %d exceeded entering %q", sw.maxDepth, path)
 	}
 	sw.dirStack = append(sw.dirStack, path)
-	sw.buf = append(sw.buf, sw.pushDirString(path))
+	sw.buf = append(sw.buf, bufEntry{text: sw.pushDirString(path)})
 	return nil
 }
 
 func (sw *StarlarkWriter) pushDirString(path string) string {
-	return sw.indentf("ctx = ctx.push_directory(ctx, %#v)\n", path)
+	return sw.indentf("%[1]s = %[1]s.push_directory(%[1]s, %[2]s)\n", sw.ctxName, sw.quotePath(path))
+}
+
+// quotePath returns path as a string literal, as written in both push_directory and any comment naming it.
+func (sw *StarlarkWriter) quotePath(path string) string {
+	val, err := sw.marshal.Marshal(path)
+	if err != nil {
+		// Strings are always valid Starlark values.
+		panic(err)
+	}
+	return string(val)
+}
+
+// CurrentDirectory returns the path of the current directory, formed by joining those
+// entered with PushDirectory, or the empty string outside of any directory.
+func (sw *StarlarkWriter) CurrentDirectory() string {
+	return path.Join(sw.dirStack...)
+}
+
+// ToLabel returns the Bazel label for the file at the slash-separated path p, as referenced from
+// the package currentDir, treating each directory as a package. Relative paths are relative to
+// currentDir and absolute paths to the root of the source tree, beyond which p may not refer.
+func ToLabel(p, currentDir string) string {
+	current := path.Join("/", currentDir)
+	if !path.IsAbs(p) {
+		p = path.Join(current, p)
+	}
+	pkg, name := path.Split(path.Clean(p))
+	if pkg = path.Clean(pkg); pkg == current {
+		return ":" + name
+	}
+	return "/" + pkg + ":" + name
 }
 
 // PopDirectory writes a Starlark directive indicating that the directory has been exited and to restore the previous context.
@@ -101,56 +754,497 @@ func (sw *StarlarkWriter) PopDirectory() (string, error) {
 		return "", errors.New("no current macro")
 	}
 	if len(sw.dirStack) == 0 {
-		return "", errors.New("no current directory")
+		return "", sw.report(errors.New("no current directory"))
 	}
 	path := pop(&sw.dirStack)
-	// Suppress enter/exit pairs which are otherwise empty.
-	if len(sw.buf) > 0 && sw.buf[len(sw.buf)-1] == sw.pushDirString(path) {
-		sw.buf = sw.buf[:len(sw.buf)-1]
+	// Suppress enter/exit pairs which are otherwise empty, discarding any buffered comments.
+	i := len(sw.buf) - 1
+	for i >= 0 && sw.buf[i].comment {
+		i--
+	}
+	if i >= 0 && sw.buf[i].text == sw.pushDirString(path) {
+		sw.buf = sw.buf[:i]
 		return path, nil
 	}
-	return path, sw.writeString(sw.indentf("ctx = ctx.pop_directory(ctx)\n"))
+	text := fmt.Sprintf("%[1]s = %[1]s.pop_directory(%[1]s)", sw.ctxName)
+	if sw.directoryComments {
+		text += "  # " + sw.quotePath(path)
+	}
+	return path, sw.writeStatement(sw.indentf("%s\n", text))
+}
+
+// WriteComment writes the provided text as a comment at the current indentation, one line per line of text.
+// Trailing whitespace is removed from each line, and empty lines are written as a bare #.
+// Unless the writer is configured with CommentsSuppressEmpty, a comment counts as content
+// of the current directory, preventing its push and pop from being suppressed.
+// Outside of a macro, the comment is written at the top level of the file, such as a header,
+// immediately preceding the next load statement or macro declaration, which it documents.
+func (sw *StarlarkWriter) WriteComment(text string) error {
+	if err := sw.checkFinalized(); err != nil {
+		return err
+	}
+	var lines string
+	for _, line := range strings.Split(text, "\n") {
+		if sw.commentTabWidth > 0 {
+			line = expandTabs(line, sw.commentTabWidth)
+		}
+		line = strings.TrimRightFunc(line, unicode.IsSpace)
+		if line == "" && sw.dropEmptyCommentLines {
+			continue
+		}
+		lines += strings.TrimRight(sw.indentf("# %s", line), " ") + "\n"
+	}
+	if lines == "" {
+		return nil
+	}
+	if sw.currentMacro == "" {
+		// Hold the comment so that it immediately precedes whatever follows,
+		// such as the declaration of a macro, rather than the helper load or prelude.
+		sw.written = true
+		sw.leadingComments += lines
+		return nil
+	}
+	if err := sw.requireStatements("comment"); err != nil {
+		return err
+	}
+	if sw.commentsSuppressEmpty && len(sw.buf) > 0 {
+		sw.buf = append(sw.buf, bufEntry{text: lines, comment: true})
+		return nil
+	}
+	if err := sw.writeBuffered(); err != nil {
+		return err
+	}
+	return sw.writeString(lines)
 }
 
 // WriteCommand writes an invocation of the provided command and arguments.
 func (sw *StarlarkWriter) WriteCommand(cmd string, args ...interface{}) error {
-	if sw.currentMacro == "" {
-		return errors.New("no current macro")
+	if err := sw.checkFinalized(); err != nil {
+		return err
+	}
+	if err := sw.requireMacro(); err != nil {
+		return err
+	}
+	text, err := sw.RenderCommand(cmd, args...)
+	if err != nil {
+		return sw.report(err)
+	}
+	if err := sw.writeBuffered(); err != nil {
+		return err
+	}
+	if err := sw.writeStatement(text); err != nil {
+		return err
+	}
+	if sw.commandCounts != nil {
+		sw.commandCounts[cmd]++
+	}
+	return nil
+}
+
+// CommandCounts returns the number of times each command has been written,
+// when configured with CountCommands.
+func (sw *StarlarkWriter) CommandCounts() map[string]int {
+	counts := make(map[string]int, len(sw.commandCounts))
+	for cmd, n := range sw.commandCounts {
+		counts[cmd] = n
+	}
+	return counts
+}
+
+// WriteAssignment writes an assignment of the provided value to the named local variable.
+func (sw *StarlarkWriter) WriteAssignment(name string, value interface{}) error {
+	if err := sw.checkFinalized(); err != nil {
+		return err
 	}
-	cmd, err := identName(cmd)
+	if err := sw.requireMacro(); err != nil {
+		return err
+	}
+	if err := sw.requireStatements("assignment"); err != nil {
+		return err
+	}
+	ident, err := identName(name)
+	if err != nil {
+		return sw.report(err)
+	}
+	val, err := sw.marshal.Marshal(value)
+	if err != nil {
+		return sw.report(err)
+	}
+	if err := sw.writeBuffered(); err != nil {
+		return err
+	}
+	return sw.writeStatement(sw.indentf("%s = %s\n", ident, sw.reindent(val)))
+}
+
+// WritePreludeAssignment adds an assignment of value to the top-level variable name to the prelude,
+// which is written before the next macro begins, or when the writer is flushed. Identical assignments
+// are written only once, so that each of several macros may declare the constants they share.
+// Assigning a different value to a name already in the prelude is an error.
+func (sw *StarlarkWriter) WritePreludeAssignment(name string, value interface{}) error {
+	if err := sw.checkFinalized(); err != nil {
+		return err
+	}
+	ident, err := identName(name)
+	if err != nil {
+		return err
+	}
+	val, err := sw.marshal.Marshal(value)
 	if err != nil {
 		return err
 	}
+	text := fmt.Sprintf("%s = %s\n", ident, val)
+	if prev, ok := sw.preludeSeen[ident]; ok {
+		if prev != text {
+			return fmt.Errorf("conflicting prelude assignments to %s", ident)
+		}
+		return nil
+	}
+	if sw.preludeSeen == nil {
+		sw.preludeSeen = make(map[string]string)
+	}
+	sw.preludeSeen[ident] = text
+	sw.prelude = append(sw.prelude, text)
+	return nil
+}
+
+// writePrelude writes any pending prelude statements at the top level of the file.
+func (sw *StarlarkWriter) writePrelude() error {
+	for _, text := range sw.prelude {
+		if err := sw.writeString(text); err != nil {
+			return err
+		}
+	}
+	sw.prelude = nil
+	return nil
+}
+
+// WriteReturn writes a return statement of the provided value, or a bare return if the value is nil,
+// terminating the current block. A macro terminated by an explicit return omits the implicit return ctx.
+func (sw *StarlarkWriter) WriteReturn(value interface{}) error {
+	if err := sw.checkFinalized(); err != nil {
+		return err
+	}
+	if err := sw.requireMacro(); err != nil {
+		return err
+	}
+	text := sw.indentf("return\n")
+	if value != nil {
+		val, err := sw.marshal.Marshal(value)
+		if err != nil {
+			return err
+		}
+		text = sw.indentf("return %s\n", sw.reindent(val))
+	}
 	if err := sw.writeBuffered(); err != nil {
 		return err
 	}
-	if err := sw.writeString(sw.indentf("ctx.%s(ctx", cmd)); err != nil {
+	if err := sw.writeStatement(text); err != nil {
 		return err
 	}
+	sw.blocks[len(sw.blocks)-1].terminated = true
+	return nil
+}
+
+// RenderCommand returns the text which WriteCommand would write for the provided command
+// and arguments, without writing it or otherwise modifying the state of the writer.
+func (sw *StarlarkWriter) RenderCommand(cmd string, args ...interface{}) (string, error) {
+	if sw.currentMacro == "" {
+		return "", errors.New("no current macro")
+	}
+	if sw.dropEmptyArgs {
+		args = dropEmptyStrings(args)
+	}
+	if sw.pathLabels != nil {
+		args = sw.labelPaths(args)
+	}
+	if sig, ok := sw.signatures[cmd]; ok {
+		if err := sig.validate(cmd, args); err != nil {
+			return "", err
+		}
+	}
+	ident, err := sw.commandName(cmd)
+	if err != nil {
+		return "", err
+	}
+	// Assemble the command in a single builder, as commands may have hundreds of arguments.
+	var text strings.Builder
+	indent := strings.Repeat(sw.indent, len(sw.blocks))
+	text.WriteString(indent)
+	text.WriteString(sw.ctxName)
+	text.WriteByte('.')
+	text.WriteString(ident)
+	text.WriteByte('(')
+	sep := ""
+	if !sw.omitContextArg {
+		text.WriteString(sw.ctxName)
+		sep = ", "
+	}
 	for _, arg := range args {
-		val, err := Marshal(arg)
+		val, err := sw.marshal.Marshal(arg)
 		if err != nil {
-			return err
+			return "", err
 		}
-		if err := sw.writeString(fmt.Sprintf(", %s", string(val))); err != nil {
-			return err
+		text.WriteString(sep)
+		if bytes.IndexByte(val, '\n') < 0 {
+			text.Write(val)
+		} else {
+			text.WriteString(strings.Replace(string(val), "\n", "\n"+indent, -1))
+		}
+		sep = ", "
+	}
+	text.WriteByte(')')
+	text.WriteString(sw.renameComment(cmd, ident))
+	text.WriteByte('\n')
+	return text.String(), nil
+}
+
+// WriteCommandKw writes an invocation of the provided command with the positional arguments
+// followed by the keyword arguments, sorted by name or, if the writer is configured with
+// CanonicalAttributeOrder, in buildifier's canonical order.
+func (sw *StarlarkWriter) WriteCommandKw(cmd string, kwargs map[string]interface{}, args ...interface{}) error {
+	names := make([]string, 0, len(kwargs))
+	for name := range kwargs {
+		names = append(names, name)
+	}
+	if sw.canonicalOrder {
+		sortAttributes(names)
+	} else {
+		sort.Strings(names)
+	}
+	ordered := make([]Kwarg, len(names))
+	for i, name := range names {
+		ordered[i] = Kwarg{name, kwargs[name]}
+	}
+	return sw.WriteCommandKwargs(cmd, ordered, args...)
+}
+
+// WriteAlias writes an alias rule named name for the target actual, such that references to a
+// target by its original name continue to work after it has been renamed, as by an IdentAllocator.
+// The actual target may be a label or the name of a target in the current package.
+// Nothing is written if name and actual refer to the same target.
+func (sw *StarlarkWriter) WriteAlias(name, actual string) error {
+	if !validTargetName(name) {
+		return fmt.Errorf("invalid target name for alias: %q", name)
+	}
+	label := actual
+	if !strings.HasPrefix(actual, ":") && !strings.HasPrefix(actual, "//") && !strings.HasPrefix(actual, "@") {
+		label = ":" + actual
+	}
+	// A label without a target name refers to the target named after its package.
+	if target := label[strings.LastIndexAny(label, ":/")+1:]; !validTargetName(target) {
+		return fmt.Errorf("invalid label for alias %s: %q", name, actual)
+	}
+	if label == ":"+name {
+		return nil
+	}
+	return sw.WriteCommandKwargs("alias", []Kwarg{{"name", name}, {"actual", label}})
+}
+
+// WriteFilegroup writes a filegroup rule named name collecting srcs, such that commands
+// referencing the same files may refer to the filegroup instead.
+// The sources are written sorted and without duplicates.
+func (sw *StarlarkWriter) WriteFilegroup(name string, srcs []string) error {
+	if !validTargetName(name) {
+		return fmt.Errorf("invalid target name for filegroup: %q", name)
+	}
+	return sw.WriteCommandKwargs("filegroup", []Kwarg{{"name", name}, {"srcs", SortedSet(srcs)}})
+}
+
+// WriteExportsFiles writes an exports_files call making files visible to other packages,
+// restricted to the given visibility, if any. The files are written sorted and without duplicates.
+func (sw *StarlarkWriter) WriteExportsFiles(files []string, visibility []string) error {
+	if len(files) == 0 {
+		return errors.New("exports_files requires at least one file")
+	}
+	for _, file := range files {
+		if !validTargetName(file) {
+			return fmt.Errorf("invalid file name for exports_files: %q", file)
+		}
+	}
+	var kwargs []Kwarg
+	if len(visibility) > 0 {
+		kwargs = append(kwargs, Kwarg{"visibility", Visibility(visibility)})
+	}
+	return sw.WriteCommandKwargs("exports_files", kwargs, SortedSet(files))
+}
+
+// Kwarg is a single keyword argument to a command.
+type Kwarg struct {
+	Name  string
+	Value interface{}
+}
+
+// WriteCommandKwargs writes an invocation of the provided command with the positional arguments
+// followed by the keyword arguments, in the order given. Duplicate names are an error.
+// Keyword arguments whose value is written as None are omitted if the writer is
+// configured with OmitNoneKwargs.
+func (sw *StarlarkWriter) WriteCommandKwargs(cmd string, kwargs []Kwarg, args ...interface{}) error {
+	all := make([]interface{}, 0, len(args)+len(kwargs))
+	all = append(all, args...)
+	seen := make(map[string]bool, len(kwargs))
+	for _, kw := range kwargs {
+		if seen[kw.Name] {
+			return sw.report(fmt.Errorf("duplicate keyword argument to %s: %s", cmd, kw.Name))
 		}
+		seen[kw.Name] = true
+		if sw.omitNoneKwargs {
+			if val, err := sw.marshal.Marshal(kw.Value); err == nil && string(val) == "None" {
+				continue
+			}
+		}
+		all = append(all, keywordArg{kw.Name, kw.Value})
+	}
+	return sw.WriteCommand(cmd, all...)
+}
+
+// macroName returns the identifier to use when defining the named macro.
+func (sw *StarlarkWriter) macroName(name string) (string, error) {
+	if sw.idents != nil {
+		return sw.idents.Allocate(name), nil
+	}
+	return identName(name)
+}
+
+// commandName returns the identifier to use when invoking the named command.
+func (sw *StarlarkWriter) commandName(name string) (string, error) {
+	if sw.idents != nil {
+		return SanitizeIdent(name), nil
+	}
+	return identName(name)
+}
+
+// renameComment returns a trailing comment recording the original name, if configured and renamed.
+func (sw *StarlarkWriter) renameComment(original, ident string) string {
+	if !sw.commentRenames || original == ident {
+		return ""
+	}
+	quoted, err := sw.marshal.Marshal(original)
+	if err != nil {
+		return ""
 	}
-	return sw.writeString(")\n")
+	return fmt.Sprintf("  # originally %s", quoted)
 }
 
+// reindent indents the continuation lines of a multi-line value to the current block depth.
+func (sw *StarlarkWriter) reindent(val []byte) string {
+	return strings.Replace(string(val), "\n", "\n"+strings.Repeat(sw.indent, len(sw.blocks)), -1)
+}
+
+// indentf formats according to the format specifier, indented to the current block depth.
 func (sw *StarlarkWriter) indentf(format string, vals ...interface{}) string {
-	return fmt.Sprintf("    "+format, vals...)
+	return fmt.Sprintf(strings.Repeat(sw.indent, len(sw.blocks))+format, vals...)
 }
 
 func (sw *StarlarkWriter) writeString(s string) error {
+	sw.written = true
+	if sw.compactHeader != "" {
+		sw.compactBody = append(sw.compactBody, s)
+		if len(sw.compactBody) == 1 {
+			return nil
+		}
+		// The body has more than one statement, so the macro is written in full.
+		text := sw.compactHeader + "\n" + strings.Join(sw.compactBody, "")
+		sw.compactHeader, sw.compactBody = "", nil
+		s = text
+	}
+	if sw.onLine != nil {
+		s = sw.filterLines(s)
+	}
+	if sw.capturing {
+		_, err := sw.macroBuf.WriteString(s)
+		return err
+	}
 	_, err := sw.w.WriteString(s)
 	return err
 }
 
+// filterLines passes each complete line of s, along with any partial line previously written,
+// to the OnLine hook, returning the text of the lines which are kept.
+// Any remaining partial line is held until it is completed.
+func (sw *StarlarkWriter) filterLines(s string) string {
+	s = sw.partialLine + s
+	end := strings.LastIndexByte(s, '\n') + 1
+	sw.partialLine = s[end:]
+	var b strings.Builder
+	for _, line := range strings.SplitAfter(s[:end], "\n") {
+		if line == "" {
+			continue
+		}
+		if line, ok := sw.onLine(strings.TrimSuffix(line, "\n")); ok {
+			b.WriteString(line + "\n")
+		}
+	}
+	return b.String()
+}
+
+// Errors returns the validation errors collected by a writer configured with CollectErrors.
+func (sw *StarlarkWriter) Errors() []error {
+	return append([]error(nil), sw.errs...)
+}
+
+// checkFinalized returns an error if the writer has been finalized by Flush.
+func (sw *StarlarkWriter) checkFinalized() error {
+	if sw.finalized {
+		return errors.New("writer already finalized")
+	}
+	return nil
+}
+
+// report returns err, unless the writer is collecting errors, in which case err is recorded
+// and nil returned so that writing may continue.
+func (sw *StarlarkWriter) report(err error) error {
+	if err == nil || !sw.collectErrors {
+		return err
+	}
+	sw.errs = append(sw.errs, err)
+	return nil
+}
+
+// requireStatements returns an error if the current macro, being a lambda, cannot contain the named construct.
+func (sw *StarlarkWriter) requireStatements(what string) error {
+	if sw.macroStyle == LambdaMacros {
+		return fmt.Errorf("%s is not allowed in lambda macro %s", what, sw.currentMacro)
+	}
+	return nil
+}
+
+// writeStatement writes s as a statement within the current block.
+func (sw *StarlarkWriter) writeStatement(s string) error {
+	if sw.macroStyle == LambdaMacros && sw.currentMacro != "" {
+		// The sole statement of a lambda is an expression, either a command or returned value.
+		if sw.lambdaBody != "" {
+			return fmt.Errorf("lambda macro %s may contain only a single expression", sw.currentMacro)
+		}
+		body := strings.TrimSpace(s)
+		if body == "return" {
+			body = "None"
+		}
+		sw.lambdaBody = strings.TrimPrefix(body, "return ")
+		return nil
+	}
+	if len(sw.blocks) > 0 {
+		b := sw.blocks[len(sw.blocks)-1]
+		if b.terminated {
+			return fmt.Errorf("unreachable statement after return in %s block", b.kind)
+		}
+		b.statements++
+	}
+	return sw.writeString(s)
+}
+
+// bufEntry is a pending line of output, buffered so that empty directories may be suppressed.
+type bufEntry struct {
+	text    string
+	comment bool // Comments are not statements.
+}
+
 func (sw *StarlarkWriter) writeBuffered() error {
 	for _, entry := range sw.buf {
-		if err := sw.writeString(entry); err != nil {
+		write := sw.writeStatement
+		if entry.comment {
+			write = sw.writeString
+		}
+		if err := write(entry.text); err != nil {
 			return err
 		}
 	}
@@ -164,24 +1258,111 @@ type ArgumentLiterals []string
 
 // MarshalStarlark implements Marshaler.
 func (al ArgumentLiterals) MarshalStarlark() ([]byte, error) {
-	b, err := Marshal([]string(al))
+	return al.marshalStarlark(MarshalOptions{})
+}
+
+func (al ArgumentLiterals) marshalStarlark(o MarshalOptions) ([]byte, error) {
+	b, err := o.Marshal([]string(al))
 	if err != nil {
 		return nil, err
 	}
 	return b[1 : len(b)-1], nil
 }
 
+// keywordArg is a single keyword argument to a command.
+type keywordArg struct {
+	name  string
+	value interface{}
+}
+
+// MarshalStarlark implements Marshaler.
+func (kw keywordArg) MarshalStarlark() ([]byte, error) {
+	return kw.marshalStarlark(MarshalOptions{})
+}
+
+func (kw keywordArg) marshalStarlark(o MarshalOptions) ([]byte, error) {
+	name, err := identName(kw.name)
+	if err != nil {
+		return nil, err
+	}
+	val, err := o.Marshal(kw.value)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(name + " = " + string(val)), nil
+}
+
+func containsString(ss []string, s string) bool {
+	for _, e := range ss {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// validTargetName returns true if name is a valid name for a Bazel target.
+func validTargetName(name string) bool {
+	if !targetNamePattern.MatchString(name) {
+		return false
+	}
+	for _, seg := range strings.Split(name, "/") {
+		if seg == "" || seg == "." || seg == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// expandTabs replaces the tabs in line with spaces up to the following multiple of width.
+func expandTabs(line string, width int) string {
+	if !strings.Contains(line, "\t") {
+		return line
+	}
+	var b strings.Builder
+	col := 0
+	for _, r := range line {
+		if r == '\t' {
+			n := width - col%width
+			b.WriteString(strings.Repeat(" ", n))
+			col += n
+			continue
+		}
+		b.WriteRune(r)
+		col++
+	}
+	return b.String()
+}
+
+// labelPaths returns args with each string argument selected by the PathLabels option
+// replaced by its label relative to the current directory.
+func (sw *StarlarkWriter) labelPaths(args []interface{}) []interface{} {
+	labeled := make([]interface{}, len(args))
+	for i, arg := range args {
+		if s, ok := arg.(string); ok && sw.pathLabels(s) {
+			arg = ToLabel(s, sw.CurrentDirectory())
+		}
+		labeled[i] = arg
+	}
+	return labeled
+}
+
+// dropEmptyStrings returns args without any empty string arguments.
+func dropEmptyStrings(args []interface{}) []interface{} {
+	kept := make([]interface{}, 0, len(args))
+	for _, arg := range args {
+		if s, ok := arg.(string); !ok || s != "" {
+			kept = append(kept, arg)
+		}
+	}
+	return kept
+}
+
 func pop(s *[]string) (x string) {
 	x, *s = (*s)[len(*s)-1], (*s)[:len(*s)-1]
 	return
 }
 
 func identName(ident string) (string, error) {
-	if !validIdentPattern.MatchString(ident) {
-		return "", fmt.Errorf("invalid Starlark identifier: %s", ident)
-	}
-	if starlarkReserved.Contains(ident) {
-		return ident + "_", nil
-	}
-	return ident, nil
+	return IdentName(ident)
 }
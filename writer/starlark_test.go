@@ -1,6 +1,9 @@
 package writer
 
 import (
+	"fmt"
+	"io"
+	"sort"
 	"strings"
 	"testing"
 
@@ -108,3 +111,1672 @@ func TestReservedWord(t *testing.T) {
 		t.Error("Unexpected writer output:\n", diff)
 	}
 }
+
+func TestWriteLoad(t *testing.T) {
+	var b strings.Builder
+	writer := NewStarlarkWriter(&b)
+	if err := writer.WriteLoad("//bzl:cmake.bzl", "cmake_library", "cmake_context"); err != nil {
+		t.Fatal("Unexpected error writing load: ", err)
+	}
+	if err := writer.BeginMacro("hello_world"); err != nil {
+		t.Fatal("Unexpected error writing macro: ", err)
+	}
+	if err := writer.WriteLoad("//bzl:cmake.bzl", "cmake_context"); err == nil {
+		t.Error("Load accepted within a macro")
+	}
+	if err := writer.WriteCommand("run", Struct{"srcs": []string{"a.cc"}, "name": "a"}); err != nil {
+		t.Fatal("Unexpected error writing command: ", err)
+	}
+	if err := writer.EndMacro(); err != nil {
+		t.Fatal("Unpexpected error ending macro: ", err)
+	}
+	expected := "load(\"//bzl:cmake.bzl\", \"cmake_context\", \"cmake_library\")\n" +
+		"def hello_world(ctx):\n" +
+		"    ctx.run(ctx, struct(name = \"a\", srcs = [\"a.cc\"]))\n" +
+		"    return ctx\n"
+	if diff := cmp.Diff(expected, b.String()); diff != "" {
+		t.Error("Unexpected writer output:\n", diff)
+	}
+}
+
+func TestInvalidLoadSymbol(t *testing.T) {
+	var b strings.Builder
+	writer := NewStarlarkWriter(&b)
+	for _, sym := range []string{"not valid", "load"} {
+		if err := writer.WriteLoad("//bzl:cmake.bzl", sym); err == nil {
+			t.Errorf("Invalid load symbol %#v accepted", sym)
+		}
+	}
+}
+
+func TestWriteLoadSymbols(t *testing.T) {
+	var b strings.Builder
+	writer := NewStarlarkWriter(&b)
+	if err := writer.WriteLoadSymbols("//x:defs.bzl",
+		LoadSymbol{Name: "rule"},
+		LoadSymbol{Alias: "my_rule", Name: "rule"},
+		LoadSymbol{Alias: "b_rule", Name: "other"},
+		LoadSymbol{Alias: "same", Name: "same"},
+	); err != nil {
+		t.Fatal("Unexpected error writing load: ", err)
+	}
+	if err := writer.Flush(); err != nil {
+		t.Fatal("Unexpected error flushing: ", err)
+	}
+	expected := "load(\"//x:defs.bzl\", b_rule = \"other\", my_rule = \"rule\", \"rule\", \"same\")\n"
+	if diff := cmp.Diff(expected, b.String()); diff != "" {
+		t.Error("Unexpected writer output:\n", diff)
+	}
+
+	for _, sym := range []LoadSymbol{{Alias: "not valid", Name: "rule"}, {Alias: "load", Name: "rule"}, {Alias: "rule"}} {
+		if err := writer.WriteLoadSymbols("//x:defs.bzl", sym); err == nil {
+			t.Errorf("Invalid load symbol %#v accepted", sym)
+		}
+	}
+}
+
+func TestCommandKwWriting(t *testing.T) {
+	var b strings.Builder
+	writer := NewStarlarkWriter(&b)
+	if err := writer.BeginMacro("hello_world"); err != nil {
+		t.Fatal("Unexpected error writing macro: ", err)
+	}
+	kwargs := map[string]interface{}{
+		"srcs": []string{"a.cc"},
+		"name": "a",
+		"deps": []string{"b", "c"},
+	}
+	if err := writer.WriteCommandKw("cc_library", kwargs, "positional"); err != nil {
+		t.Fatal("Unpexected error writing command: ", err)
+	}
+	if err := writer.WriteCommandKw("cc_library", map[string]interface{}{"not valid": 1}); err == nil {
+		t.Error("Invalid keyword accepted")
+	}
+	if err := writer.EndMacro(); err != nil {
+		t.Fatal("Unpexpected error ending macro: ", err)
+	}
+	expected := "def hello_world(ctx):\n" +
+		"    ctx.cc_library(ctx, \"positional\", deps = [\"b\", \"c\"], name = \"a\", srcs = [\"a.cc\"])\n" +
+		"    return ctx\n"
+	if diff := cmp.Diff(expected, b.String()); diff != "" {
+		t.Error("Unexpected writer output:\n", diff)
+	}
+}
+
+func TestRenderCommand(t *testing.T) {
+	var b strings.Builder
+	writer := NewStarlarkWriter(&b)
+	if _, err := writer.RenderCommand("run"); err == nil {
+		t.Error("Command rendered outside of a macro")
+	}
+	if err := writer.BeginMacro("hello_world"); err != nil {
+		t.Fatal("Unexpected error writing macro: ", err)
+	}
+	if err := writer.PushDirectory("this/is/a/path"); err != nil {
+		t.Fatal("Unpexpected error entering directory: ", err)
+	}
+	args := []interface{}{"with", []string{"list", "args"}, 1}
+	rendered, err := writer.RenderCommand("run", args...)
+	if err != nil {
+		t.Fatal("Unexpected error rendering command: ", err)
+	}
+	// Rendering must not consume the buffered directory, which is still suppressed when empty.
+	if _, err := writer.PopDirectory(); err != nil {
+		t.Fatal("Unpexpected error exiting directory: ", err)
+	}
+	if err := writer.WriteCommand("run", args...); err != nil {
+		t.Fatal("Unpexected error writing command: ", err)
+	}
+	if err := writer.EndMacro(); err != nil {
+		t.Fatal("Unpexpected error ending macro: ", err)
+	}
+	expected := "def hello_world(ctx):\n" + rendered + "    return ctx\n"
+	if diff := cmp.Diff(expected, b.String()); diff != "" {
+		t.Error("Unexpected writer output:\n", diff)
+	}
+	if diff := cmp.Diff("    ctx.run(ctx, \"with\", [\"list\", \"args\"], 1)\n", rendered); diff != "" {
+		t.Error("Unexpected rendered command:\n", diff)
+	}
+}
+
+func TestRenameComments(t *testing.T) {
+	var b strings.Builder
+	writer := NewStarlarkWriter(&b, SanitizeNames(true), CommentRenames(true))
+	if err := writer.BeginMacro("llvm-foo"); err != nil {
+		t.Fatal("Unexpected error writing macro: ", err)
+	}
+	if err := writer.WriteCommand("add-library", "a"); err != nil {
+		t.Fatal("Unpexected error writing command: ", err)
+	}
+	if err := writer.WriteCommand("add_library", "b"); err != nil {
+		t.Fatal("Unpexected error writing command: ", err)
+	}
+	if err := writer.EndMacro(); err != nil {
+		t.Fatal("Unpexpected error ending macro: ", err)
+	}
+	if err := writer.BeginMacro("llvm_bar"); err != nil {
+		t.Fatal("Unexpected error writing macro: ", err)
+	}
+	if err := writer.EndMacro(); err != nil {
+		t.Fatal("Unpexpected error ending macro: ", err)
+	}
+	expected := "def llvm_foo(ctx):  # originally \"llvm-foo\"\n" +
+		"    ctx.add_library(ctx, \"a\")  # originally \"add-library\"\n" +
+		"    ctx.add_library(ctx, \"b\")\n" +
+		"    return ctx\n" +
+		"def llvm_bar(ctx):\n" +
+		"    return ctx\n"
+	if diff := cmp.Diff(expected, b.String()); diff != "" {
+		t.Error("Unexpected writer output:\n", diff)
+	}
+}
+
+func TestBlockWriting(t *testing.T) {
+	var b strings.Builder
+	writer := NewStarlarkWriter(&b)
+	if err := writer.BeginMacro("hello_world"); err != nil {
+		t.Fatal("Unexpected error writing macro: ", err)
+	}
+	if err := writer.BeginFor("src", Raw("ctx.srcs")); err != nil {
+		t.Fatal("Unexpected error beginning for: ", err)
+	}
+	if err := writer.BeginIf(Raw("src.endswith(\".cc\")")); err != nil {
+		t.Fatal("Unexpected error beginning if: ", err)
+	}
+	if err := writer.WriteCommand("compile", Raw("src")); err != nil {
+		t.Fatal("Unexpected error writing command: ", err)
+	}
+	if err := writer.ElseIf(Raw("src.endswith(\".h\")")); err != nil {
+		t.Fatal("Unexpected error writing elif: ", err)
+	}
+	if err := writer.Else(); err != nil {
+		t.Fatal("Unexpected error writing else: ", err)
+	}
+	if err := writer.WriteCommand("skip", Raw("src")); err != nil {
+		t.Fatal("Unexpected error writing command: ", err)
+	}
+	if err := writer.EndIf(); err != nil {
+		t.Fatal("Unexpected error ending if: ", err)
+	}
+	if err := writer.EndFor(); err != nil {
+		t.Fatal("Unexpected error ending for: ", err)
+	}
+	if err := writer.EndMacro(); err != nil {
+		t.Fatal("Unexpected error ending macro: ", err)
+	}
+	if err := writer.Flush(); err != nil {
+		t.Fatal("Unexpected error flushing writer: ", err)
+	}
+	expected := "def hello_world(ctx):\n" +
+		"    for src in ctx.srcs:\n" +
+		"        if src.endswith(\".cc\"):\n" +
+		"            ctx.compile(ctx, src)\n" +
+		"        elif src.endswith(\".h\"):\n" +
+		"            pass\n" +
+		"        else:\n" +
+		"            ctx.skip(ctx, src)\n" +
+		"    return ctx\n"
+	if diff := cmp.Diff(expected, b.String()); diff != "" {
+		t.Error("Unexpected writer output:\n", diff)
+	}
+}
+
+func TestMismatchedBlocks(t *testing.T) {
+	var b strings.Builder
+	writer := NewStarlarkWriter(&b)
+	if err := writer.BeginMacro("hello_world"); err != nil {
+		t.Fatal("Unexpected error writing macro: ", err)
+	}
+	if err := writer.EndIf(); err == nil {
+		t.Error("Unexpected success ending unopened if")
+	}
+	if err := writer.BeginFor("x", Raw("xs")); err != nil {
+		t.Fatal("Unexpected error beginning for: ", err)
+	}
+	if err := writer.Else(); err == nil {
+		t.Error("Unexpected success writing else within for")
+	}
+	if err := writer.EndIf(); err == nil {
+		t.Error("Unexpected success ending for with endif")
+	}
+	if err := writer.EndMacro(); err == nil {
+		t.Error("Unexpected success ending macro with open for")
+	}
+}
+
+func TestUnclosedAtFlush(t *testing.T) {
+	tests := []struct {
+		desc     string
+		open     func(*StarlarkWriter) error
+		expected string
+	}{
+		{"macro", func(sw *StarlarkWriter) error { return nil }, "macro hello_world"},
+		{"if", func(sw *StarlarkWriter) error { return sw.BeginIf(Raw("cond")) }, "if block"},
+		{"else", func(sw *StarlarkWriter) error {
+			if err := sw.BeginIf(Raw("cond")); err != nil {
+				return err
+			}
+			return sw.Else()
+		}, "else block"},
+		{"for", func(sw *StarlarkWriter) error { return sw.BeginFor("x", Raw("xs")) }, "for block"},
+		{"directory", func(sw *StarlarkWriter) error { return sw.PushDirectory("a") }, "directory \"a\""},
+	}
+	for _, test := range tests {
+		var b strings.Builder
+		writer := NewStarlarkWriter(&b)
+		if err := writer.BeginMacro("hello_world"); err != nil {
+			t.Fatal("Unexpected error writing macro: ", err)
+		}
+		if err := test.open(writer); err != nil {
+			t.Fatalf("Unexpected error opening %s: %v", test.desc, err)
+		}
+		err := writer.Flush()
+		if err == nil {
+			t.Errorf("Unexpected success flushing with unclosed %s", test.desc)
+		} else if !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("Flush error %q does not mention %q", err, test.expected)
+		}
+	}
+}
+
+// writeCounter counts the number of calls to Write.
+type writeCounter int
+
+func (wc *writeCounter) Write(p []byte) (int, error) {
+	*wc++
+	return len(p), nil
+}
+
+func benchmarkWriter(b *testing.B, size int) {
+	const commands = 1 << 14 // Roughly 1MB of output.
+	args := ArgumentLiterals{"some_target", "source_file.cc", "another_source_file.cc"}
+	for i := 0; i < b.N; i++ {
+		var wc writeCounter
+		writer := NewStarlarkWriterSize(&wc, size)
+		if err := writer.BeginMacro("hello_world"); err != nil {
+			b.Fatal("Unexpected error writing macro: ", err)
+		}
+		for j := 0; j < commands; j++ {
+			if err := writer.WriteCommand("add_library", args); err != nil {
+				b.Fatal("Unexpected error writing command: ", err)
+			}
+		}
+		if err := writer.EndMacro(); err != nil {
+			b.Fatal("Unexpected error ending macro: ", err)
+		}
+		b.ReportMetric(float64(wc), "writes/op")
+	}
+}
+
+func BenchmarkDefaultSize(b *testing.B) {
+	benchmarkWriter(b, 0)
+}
+
+func BenchmarkPresized(b *testing.B) {
+	benchmarkWriter(b, 1<<20)
+}
+
+func BenchmarkManyArguments(b *testing.B) {
+	args := make([]interface{}, 500)
+	for i := range args {
+		args[i] = fmt.Sprintf("source_file_%d.cc", i)
+	}
+	writer := NewStarlarkWriter(io.Discard)
+	if err := writer.BeginMacro("hello_world"); err != nil {
+		b.Fatal("Unexpected error writing macro: ", err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := writer.WriteCommand("add_library", args...); err != nil {
+			b.Fatal("Unexpected error writing command: ", err)
+		}
+	}
+}
+
+func TestQuoteStyle(t *testing.T) {
+	var b strings.Builder
+	writer := NewStarlarkWriter(&b, Quotes(SingleQuotes))
+	if err := writer.BeginMacro("hello_world"); err != nil {
+		t.Fatal("Unexpected error writing macro: ", err)
+	}
+	if err := writer.WriteCommandKw("run", map[string]interface{}{"name": `"it's"`}, ArgumentLiterals{"a"}); err != nil {
+		t.Fatal("Unexpected error writing command: ", err)
+	}
+	if err := writer.EndMacro(); err != nil {
+		t.Fatal("Unexpected error ending macro: ", err)
+	}
+	expected := "def hello_world(ctx):\n" +
+		"    ctx.run(ctx, 'a', name = '\"it\\'s\"')\n" +
+		"    return ctx\n"
+	if diff := cmp.Diff(expected, b.String()); diff != "" {
+		t.Error("Unexpected writer output:\n", diff)
+	}
+}
+
+func TestMacroParams(t *testing.T) {
+	var b strings.Builder
+	writer := NewStarlarkWriter(&b, TypeComments(true))
+	params := []Param{
+		{Name: "srcs", Type: "list[str]"},
+		{Name: "visibility", Default: []string{}, Type: "list[str]"},
+	}
+	if err := writer.BeginMacroParams("hello_world", params...); err != nil {
+		t.Fatal("Unexpected error writing macro: ", err)
+	}
+	if err := writer.WriteCommand("run", Var("srcs")); err != nil {
+		t.Fatal("Unexpected error writing command: ", err)
+	}
+	if err := writer.EndMacro(); err != nil {
+		t.Fatal("Unexpected error ending macro: ", err)
+	}
+	expected := "def hello_world(ctx, srcs, visibility = []):\n" +
+		"    # type: (ctx, list[str], list[str]) -> ctx\n" +
+		"    ctx.run(ctx, srcs)\n" +
+		"    return ctx\n"
+	if diff := cmp.Diff(expected, b.String()); diff != "" {
+		t.Error("Unexpected writer output:\n", diff)
+	}
+
+	if err := NewStarlarkWriter(&b, TypeComments(true)).BeginMacroParams("untyped", Param{Name: "srcs", Type: " "}); err == nil {
+		t.Error("Unexpected success writing untyped parameter")
+	}
+	if err := NewStarlarkWriter(&b).BeginMacroParams("untyped", Param{Name: "srcs"}); err != nil {
+		t.Error("Unexpected error writing untyped parameter without type comments: ", err)
+	}
+}
+
+func TestMultilineArgument(t *testing.T) {
+	var b strings.Builder
+	writer := NewStarlarkWriter(&b)
+	if err := writer.BeginMacro("hello_world"); err != nil {
+		t.Fatal("Unexpected error writing macro: ", err)
+	}
+	if err := writer.BeginFor("x", Var("xs")); err != nil {
+		t.Fatal("Unexpected error beginning for: ", err)
+	}
+	if err := writer.BeginIf(Var("x")); err != nil {
+		t.Fatal("Unexpected error beginning if: ", err)
+	}
+	attrs, err := MarshalIndent(map[string]interface{}{
+		"copts": []string{"-Wall"},
+		"deps":  map[string][]string{"//conditions:default": {":a", ":b"}},
+	}, "    ")
+	if err != nil {
+		t.Fatal("Unexpected error marshaling argument: ", err)
+	}
+	if err := writer.WriteCommand("run", Raw(attrs), 1); err != nil {
+		t.Fatal("Unexpected error writing command: ", err)
+	}
+	if err := writer.EndIf(); err != nil {
+		t.Fatal("Unexpected error ending if: ", err)
+	}
+	if err := writer.EndFor(); err != nil {
+		t.Fatal("Unexpected error ending for: ", err)
+	}
+	if err := writer.EndMacro(); err != nil {
+		t.Fatal("Unexpected error ending macro: ", err)
+	}
+	expected := `def hello_world(ctx):
+    for x in xs:
+        if x:
+            ctx.run(ctx, {
+                "copts": [
+                    "-Wall",
+                ],
+                "deps": {
+                    "//conditions:default": [
+                        ":a",
+                        ":b",
+                    ],
+                },
+            }, 1)
+    return ctx
+`
+	if diff := cmp.Diff(expected, b.String()); diff != "" {
+		t.Error("Unexpected writer output:\n", diff)
+	}
+}
+
+func TestPassContextArg(t *testing.T) {
+	tests := []struct {
+		pass     bool
+		args     []interface{}
+		expected string
+	}{
+		{true, nil, "    ctx.run(ctx)\n"},
+		{true, []interface{}{"a", 1}, "    ctx.run(ctx, \"a\", 1)\n"},
+		{false, nil, "    ctx.run()\n"},
+		{false, []interface{}{"a", 1}, "    ctx.run(\"a\", 1)\n"},
+	}
+	for _, test := range tests {
+		writer := NewStarlarkWriter(&strings.Builder{}, PassContextArg(test.pass))
+		if err := writer.BeginMacro("hello_world"); err != nil {
+			t.Fatal("Unexpected error writing macro: ", err)
+		}
+		actual, err := writer.RenderCommand("run", test.args...)
+		if err != nil {
+			t.Errorf("Unexpected error rendering command: %v", err)
+		} else if diff := cmp.Diff(test.expected, actual); diff != "" {
+			t.Errorf("Unexpected command with PassContextArg(%v):\n%s", test.pass, diff)
+		}
+	}
+}
+
+func TestWriteReturn(t *testing.T) {
+	var b strings.Builder
+	writer := NewStarlarkWriter(&b)
+	if err := writer.BeginMacro("hello_world"); err != nil {
+		t.Fatal("Unexpected error writing macro: ", err)
+	}
+	if err := writer.BeginIf(Var("done")); err != nil {
+		t.Fatal("Unexpected error beginning if: ", err)
+	}
+	if err := writer.WriteReturn(Raw("None")); err != nil {
+		t.Fatal("Unexpected error writing return: ", err)
+	}
+	if err := writer.WriteCommand("unreachable"); err == nil {
+		t.Error("Unexpected success writing unreachable command")
+	}
+	if err := writer.Else(); err != nil {
+		t.Fatal("Unexpected error writing else: ", err)
+	}
+	if err := writer.WriteReturn(nil); err != nil {
+		t.Fatal("Unexpected error writing return: ", err)
+	}
+	if err := writer.EndIf(); err != nil {
+		t.Fatal("Unexpected error ending if: ", err)
+	}
+	if err := writer.WriteCommand("run"); err != nil {
+		t.Fatal("Unexpected error writing command: ", err)
+	}
+	if err := writer.WriteReturn(Var("ctx")); err != nil {
+		t.Fatal("Unexpected error writing return: ", err)
+	}
+	if err := writer.EndMacro(); err != nil {
+		t.Fatal("Unexpected error ending macro: ", err)
+	}
+	expected := "def hello_world(ctx):\n" +
+		"    if done:\n" +
+		"        return None\n" +
+		"    else:\n" +
+		"        return\n" +
+		"    ctx.run(ctx)\n" +
+		"    return ctx\n"
+	if diff := cmp.Diff(expected, b.String()); diff != "" {
+		t.Error("Unexpected writer output:\n", diff)
+	}
+}
+
+func TestCommentsInDirectory(t *testing.T) {
+	tests := []struct {
+		suppress bool
+		expected string
+	}{
+		{false, "def hello_world(ctx):\n" +
+			"    # before\n" +
+			"    ctx = ctx.push_directory(ctx, \"a\")\n" +
+			"    # only a comment\n" +
+			"    #\n" +
+			"    # with two lines\n" +
+			"    ctx = ctx.pop_directory(ctx)\n" +
+			"    return ctx\n"},
+		{true, "def hello_world(ctx):\n" +
+			"    # before\n" +
+			"    return ctx\n"},
+	}
+	for _, test := range tests {
+		var b strings.Builder
+		writer := NewStarlarkWriter(&b, CommentsSuppressEmpty(test.suppress))
+		if err := writer.BeginMacro("hello_world"); err != nil {
+			t.Fatal("Unexpected error writing macro: ", err)
+		}
+		if err := writer.WriteComment("before"); err != nil {
+			t.Fatal("Unexpected error writing comment: ", err)
+		}
+		if err := writer.PushDirectory("a"); err != nil {
+			t.Fatal("Unexpected error entering directory: ", err)
+		}
+		if err := writer.WriteComment("only a comment\n\nwith two lines"); err != nil {
+			t.Fatal("Unexpected error writing comment: ", err)
+		}
+		if _, err := writer.PopDirectory(); err != nil {
+			t.Fatal("Unexpected error exiting directory: ", err)
+		}
+		if err := writer.EndMacro(); err != nil {
+			t.Fatal("Unexpected error ending macro: ", err)
+		}
+		if diff := cmp.Diff(test.expected, b.String()); diff != "" {
+			t.Errorf("Unexpected writer output with CommentsSuppressEmpty(%v):\n%s", test.suppress, diff)
+		}
+	}
+}
+
+func TestWriteCommentWhitespace(t *testing.T) {
+	const comment = "trailing spaces   \n\ttabbed\tcolumns\t\n\nend"
+	tests := []struct {
+		opts     []Option
+		expected string
+	}{
+		{nil, "    # trailing spaces\n" +
+			"    # \ttabbed\tcolumns\n" +
+			"    #\n" +
+			"    # end\n"},
+		{[]Option{CommentTabWidth(4)}, "    # trailing spaces\n" +
+			"    #     tabbed  columns\n" +
+			"    #\n" +
+			"    # end\n"},
+		{[]Option{DropEmptyCommentLines(true)}, "    # trailing spaces\n" +
+			"    # \ttabbed\tcolumns\n" +
+			"    # end\n"},
+	}
+	for _, test := range tests {
+		var b strings.Builder
+		writer := NewStarlarkWriter(&b, test.opts...)
+		if err := writer.BeginMacro("hello_world"); err != nil {
+			t.Fatal("Unexpected error writing macro: ", err)
+		}
+		if err := writer.WriteComment(comment); err != nil {
+			t.Fatal("Unexpected error writing comment: ", err)
+		}
+		if err := writer.EndMacro(); err != nil {
+			t.Fatal("Unexpected error ending macro: ", err)
+		}
+		expected := "def hello_world(ctx):\n" + test.expected + "    return ctx\n"
+		if diff := cmp.Diff(expected, b.String()); diff != "" {
+			t.Error("Unexpected writer output:\n", diff)
+		}
+	}
+}
+
+func TestCommentedDirectoryWithContent(t *testing.T) {
+	var b strings.Builder
+	writer := NewStarlarkWriter(&b, CommentsSuppressEmpty(true))
+	if err := writer.BeginMacro("hello_world"); err != nil {
+		t.Fatal("Unexpected error writing macro: ", err)
+	}
+	if err := writer.PushDirectory("a"); err != nil {
+		t.Fatal("Unexpected error entering directory: ", err)
+	}
+	if err := writer.WriteComment("comment"); err != nil {
+		t.Fatal("Unexpected error writing comment: ", err)
+	}
+	if err := writer.WriteCommand("run"); err != nil {
+		t.Fatal("Unexpected error writing command: ", err)
+	}
+	if _, err := writer.PopDirectory(); err != nil {
+		t.Fatal("Unexpected error exiting directory: ", err)
+	}
+	if err := writer.EndMacro(); err != nil {
+		t.Fatal("Unexpected error ending macro: ", err)
+	}
+	expected := "def hello_world(ctx):\n" +
+		"    ctx = ctx.push_directory(ctx, \"a\")\n" +
+		"    # comment\n" +
+		"    ctx.run(ctx)\n" +
+		"    ctx = ctx.pop_directory(ctx)\n" +
+		"    return ctx\n"
+	if diff := cmp.Diff(expected, b.String()); diff != "" {
+		t.Error("Unexpected writer output:\n", diff)
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	var b strings.Builder
+	writer := NewStarlarkWriter(&b, MaxDepth(2))
+	if err := writer.BeginMacro("hello_world"); err != nil {
+		t.Fatal("Unexpected error writing macro: ", err)
+	}
+	for _, dir := range []string{"a", "b"} {
+		if err := writer.PushDirectory(dir); err != nil {
+			t.Fatal("Unexpected error entering directory: ", err)
+		}
+	}
+	if err := writer.PushDirectory("c"); err == nil {
+		t.Error("Expected error entering directory beyond the maximum depth")
+	}
+	if _, err := writer.PopDirectory(); err != nil {
+		t.Fatal("Unexpected error exiting directory: ", err)
+	}
+	if err := writer.PushDirectory("c"); err != nil {
+		t.Fatal("Unexpected error entering directory: ", err)
+	}
+	if err := writer.WriteCommand("run"); err != nil {
+		t.Fatal("Unexpected error writing command: ", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := writer.PopDirectory(); err != nil {
+			t.Fatal("Unexpected error exiting directory: ", err)
+		}
+	}
+	if err := writer.EndMacro(); err != nil {
+		t.Fatal("Unexpected error ending macro: ", err)
+	}
+	expected := "def hello_world(ctx):\n" +
+		"    ctx = ctx.push_directory(ctx, \"a\")\n" +
+		"    ctx = ctx.push_directory(ctx, \"c\")\n" +
+		"    ctx.run(ctx)\n" +
+		"    ctx = ctx.pop_directory(ctx)\n" +
+		"    ctx = ctx.pop_directory(ctx)\n" +
+		"    return ctx\n"
+	if diff := cmp.Diff(expected, b.String()); diff != "" {
+		t.Error("Unexpected writer output:\n", diff)
+	}
+}
+
+func TestDefaultMaxDepth(t *testing.T) {
+	writer := NewStarlarkWriter(&strings.Builder{})
+	if err := writer.BeginMacro("hello_world"); err != nil {
+		t.Fatal("Unexpected error writing macro: ", err)
+	}
+	for i := 0; i < DefaultMaxDepth; i++ {
+		if err := writer.PushDirectory("a"); err != nil {
+			t.Fatalf("Unexpected error entering directory at depth %d: %v", i, err)
+		}
+	}
+	if err := writer.PushDirectory("a"); err == nil {
+		t.Error("Expected error entering directory beyond the default maximum depth")
+	}
+}
+
+func TestDropEmptyArgs(t *testing.T) {
+	tests := []struct {
+		drop     bool
+		expected string
+	}{
+		{false, "def hello_world(ctx):\n" +
+			"    ctx.run(ctx, \"a\", \"\", \"b\", \"\")\n" +
+			"    ctx.run(ctx, \"\", empty = \"\")\n" +
+			"    return ctx\n"},
+		{true, "def hello_world(ctx):\n" +
+			"    ctx.run(ctx, \"a\", \"b\")\n" +
+			"    ctx.run(ctx, empty = \"\")\n" +
+			"    return ctx\n"},
+	}
+	for _, test := range tests {
+		var b strings.Builder
+		writer := NewStarlarkWriter(&b, DropEmptyArgs(test.drop))
+		if err := writer.BeginMacro("hello_world"); err != nil {
+			t.Fatal("Unexpected error writing macro: ", err)
+		}
+		if err := writer.WriteCommand("run", "a", "", "b", ""); err != nil {
+			t.Fatal("Unexpected error writing command: ", err)
+		}
+		if err := writer.WriteCommandKw("run", map[string]interface{}{"empty": ""}, ""); err != nil {
+			t.Fatal("Unexpected error writing command: ", err)
+		}
+		if err := writer.EndMacro(); err != nil {
+			t.Fatal("Unexpected error ending macro: ", err)
+		}
+		if diff := cmp.Diff(test.expected, b.String()); diff != "" {
+			t.Errorf("Unexpected writer output with DropEmptyArgs(%v):\n%s", test.drop, diff)
+		}
+	}
+}
+
+func TestOmitNoneKwargs(t *testing.T) {
+	tests := []struct {
+		omit     bool
+		expected string
+	}{
+		{false, "def hello_world(ctx):\n" +
+			"    ctx.run(ctx, \"a\", none = None, ptr = None, value = \"b\")\n" +
+			"    return ctx\n"},
+		{true, "def hello_world(ctx):\n" +
+			"    ctx.run(ctx, \"a\", value = \"b\")\n" +
+			"    return ctx\n"},
+	}
+	for _, test := range tests {
+		var b strings.Builder
+		writer := NewStarlarkWriter(&b, OmitNoneKwargs(test.omit))
+		if err := writer.BeginMacro("hello_world"); err != nil {
+			t.Fatal("Unexpected error writing macro: ", err)
+		}
+		kwargs := map[string]interface{}{"none": nil, "ptr": (*string)(nil), "value": "b"}
+		if err := writer.WriteCommandKw("run", kwargs, "a"); err != nil {
+			t.Fatal("Unexpected error writing command: ", err)
+		}
+		if err := writer.EndMacro(); err != nil {
+			t.Fatal("Unexpected error ending macro: ", err)
+		}
+		if diff := cmp.Diff(test.expected, b.String()); diff != "" {
+			t.Errorf("Unexpected writer output with OmitNoneKwargs(%v):\n%s", test.omit, diff)
+		}
+	}
+}
+
+func TestCanonicalAttributeOrder(t *testing.T) {
+	var b strings.Builder
+	writer := NewStarlarkWriter(&b, CanonicalAttributeOrder(true))
+	if err := writer.BeginMacro("hello_world"); err != nil {
+		t.Fatal("Unexpected error writing macro: ", err)
+	}
+	kwargs := map[string]interface{}{
+		"alwayslink": true,
+		"copts":      []string{"-Wall"},
+		"deps":       []string{":b"},
+		"hdrs":       []string{"a.h"},
+		"includes":   []string{"."},
+		"name":       "a",
+		"srcs":       []string{"a.cc"},
+		"testonly":   true,
+		"visibility": []string{"//visibility:public"},
+	}
+	if err := writer.WriteCommandKw("cc_library", kwargs); err != nil {
+		t.Fatal("Unexpected error writing command: ", err)
+	}
+	if err := writer.EndMacro(); err != nil {
+		t.Fatal("Unexpected error ending macro: ", err)
+	}
+	// Known attributes in buildifier's order, followed by the unknown attributes alphabetically.
+	expected := "def hello_world(ctx):\n" +
+		"    ctx.cc_library(ctx, name = \"a\", testonly = True, srcs = [\"a.cc\"], hdrs = [\"a.h\"], " +
+		"deps = [\":b\"], alwayslink = True, copts = [\"-Wall\"], includes = [\".\"], visibility = [\"//visibility:public\"])\n" +
+		"    return ctx\n"
+	if diff := cmp.Diff(expected, b.String()); diff != "" {
+		t.Error("Unexpected writer output:\n", diff)
+	}
+}
+
+func TestWriteConditionalCommands(t *testing.T) {
+	var b strings.Builder
+	writer := NewStarlarkWriter(&b)
+	if err := writer.BeginMacro("hello_world"); err != nil {
+		t.Fatal("Unexpected error writing macro: ", err)
+	}
+	err := writer.WriteConditionalCommands([]ConditionalBranch{
+		{Cond: Raw("ctx.is_true(ctx, \"WIN32\")"), Write: func(w *StarlarkWriter) error {
+			return w.WriteCommand("run", "windows.cc")
+		}},
+		{Cond: Raw("ctx.is_true(ctx, \"APPLE\")")},
+		{Write: func(w *StarlarkWriter) error {
+			if err := w.WriteCommand("run", "unix.cc"); err != nil {
+				return err
+			}
+			return w.WriteCommand("run", "posix.cc")
+		}},
+	})
+	if err != nil {
+		t.Fatal("Unexpected error writing conditional commands: ", err)
+	}
+	err = writer.WriteConditionalCommands([]ConditionalBranch{
+		{Cond: Raw("ctx.is_true(ctx, \"UNIX\")"), Write: func(w *StarlarkWriter) error {
+			return w.WriteCommand("run", "unix.cc")
+		}},
+	})
+	if err != nil {
+		t.Fatal("Unexpected error writing single conditional command: ", err)
+	}
+	for _, branches := range [][]ConditionalBranch{
+		nil,
+		{{Write: func(w *StarlarkWriter) error { return nil }}},
+		{{Cond: true}, {}, {Cond: false}},
+	} {
+		if err := writer.WriteConditionalCommands(branches); err == nil {
+			t.Errorf("Invalid conditional commands accepted: %#v", branches)
+		}
+	}
+	if err := writer.EndMacro(); err != nil {
+		t.Fatal("Unexpected error ending macro: ", err)
+	}
+	expected := "def hello_world(ctx):\n" +
+		"    if ctx.is_true(ctx, \"WIN32\"):\n" +
+		"        ctx.run(ctx, \"windows.cc\")\n" +
+		"    elif ctx.is_true(ctx, \"APPLE\"):\n" +
+		"        pass\n" +
+		"    else:\n" +
+		"        ctx.run(ctx, \"unix.cc\")\n" +
+		"        ctx.run(ctx, \"posix.cc\")\n" +
+		"    if ctx.is_true(ctx, \"UNIX\"):\n" +
+		"        ctx.run(ctx, \"unix.cc\")\n" +
+		"    return ctx\n"
+	if diff := cmp.Diff(expected, b.String()); diff != "" {
+		t.Error("Unexpected writer output:\n", diff)
+	}
+}
+
+func TestFinalizeOnFlush(t *testing.T) {
+	for _, finalize := range []bool{false, true} {
+		var b strings.Builder
+		writer := NewStarlarkWriter(&b, FinalizeOnFlush(finalize))
+		if err := writer.BeginMacro("hello_world"); err != nil {
+			t.Fatal("Unexpected error writing macro: ", err)
+		}
+		if err := writer.EndMacro(); err != nil {
+			t.Fatal("Unexpected error ending macro: ", err)
+		}
+		if err := writer.Flush(); err != nil {
+			t.Fatal("Unexpected error flushing writer: ", err)
+		}
+		err := writer.WriteCommand("run")
+		if finalize && (err == nil || err.Error() != "writer already finalized") {
+			t.Errorf("Expected finalized error but got: %v", err)
+		}
+		if err := writer.BeginMacro("again"); (err != nil) != finalize {
+			t.Errorf("Unexpected result beginning macro after Flush with FinalizeOnFlush(%v): %v", finalize, err)
+		}
+	}
+}
+
+func TestHelperLoad(t *testing.T) {
+	var b strings.Builder
+	writer := NewStarlarkWriter(&b, HelperLoad("//bzl:cmake.bzl", "cmake_context"))
+	if err := writer.WriteLoad("//bzl:rules.bzl", "cmake_library"); err != nil {
+		t.Fatal("Unexpected error writing load: ", err)
+	}
+	if err := writer.WriteLoad("//bzl:cmake.bzl", "cmake_context", "cmake_binary"); err != nil {
+		t.Fatal("Unexpected error writing load: ", err)
+	}
+	if err := writer.WriteLoad("//bzl:cmake.bzl", "cmake_context"); err != nil {
+		t.Fatal("Unexpected error writing load: ", err)
+	}
+	for _, name := range []string{"first", "second"} {
+		if err := writer.BeginMacro(name); err != nil {
+			t.Fatal("Unexpected error writing macro: ", err)
+		}
+		if err := writer.EndMacro(); err != nil {
+			t.Fatal("Unexpected error ending macro: ", err)
+		}
+	}
+	expected := "load(\"//bzl:cmake.bzl\", \"cmake_context\")\n" +
+		"load(\"//bzl:rules.bzl\", \"cmake_library\")\n" +
+		"load(\"//bzl:cmake.bzl\", \"cmake_binary\")\n" +
+		"def first(ctx):\n" +
+		"    return ctx\n" +
+		"def second(ctx):\n" +
+		"    return ctx\n"
+	if diff := cmp.Diff(expected, b.String()); diff != "" {
+		t.Error("Unexpected writer output:\n", diff)
+	}
+
+	b.Reset()
+	writer = NewStarlarkWriter(&b, HelperLoad("//bzl:cmake.bzl", "cmake_context"))
+	if err := writer.WriteLoad("//bzl:cmake.bzl", "cmake_binary"); err != nil {
+		t.Fatal("Unexpected error writing load: ", err)
+	}
+	if err := writer.BeginMacro("first"); err != nil {
+		t.Fatal("Unexpected error writing macro: ", err)
+	}
+	if err := writer.EndMacro(); err != nil {
+		t.Fatal("Unexpected error ending macro: ", err)
+	}
+	expected = "load(\"//bzl:cmake.bzl\", \"cmake_binary\", \"cmake_context\")\n" +
+		"def first(ctx):\n" +
+		"    return ctx\n"
+	if diff := cmp.Diff(expected, b.String()); diff != "" {
+		t.Error("Unexpected writer output:\n", diff)
+	}
+}
+
+func TestToLabel(t *testing.T) {
+	tests := []struct {
+		path, dir, expected string
+	}{
+		{"foo.cc", "llvm/lib", ":foo.cc"},
+		{"./foo.cc", "llvm/lib/", ":foo.cc"},
+		{"/llvm/lib/foo.cc", "llvm/lib", ":foo.cc"},
+		{"Support/foo.cc", "llvm/lib", "//llvm/lib/Support:foo.cc"},
+		{"/llvm/lib/Support/foo.cc", "llvm/lib", "//llvm/lib/Support:foo.cc"},
+		{"../include/foo.h", "llvm/lib", "//llvm/include:foo.h"},
+		{"../../foo.txt", "llvm/lib", "//:foo.txt"},
+		{"foo.txt", "", ":foo.txt"},
+		{"/clang/foo.cc", "", "//clang:foo.cc"},
+		{"../../../foo.txt", "llvm/lib", "//:foo.txt"},
+	}
+	for _, test := range tests {
+		if actual := ToLabel(test.path, test.dir); actual != test.expected {
+			t.Errorf("ToLabel(%q, %q): expected %q but got %q", test.path, test.dir, test.expected, actual)
+		}
+	}
+}
+
+func TestPathLabels(t *testing.T) {
+	var b strings.Builder
+	writer := NewStarlarkWriter(&b, PathLabels(func(arg string) bool { return strings.HasSuffix(arg, ".cc") }))
+	if err := writer.BeginMacro("hello_world"); err != nil {
+		t.Fatal("Unexpected error writing macro: ", err)
+	}
+	if err := writer.PushDirectory("llvm"); err != nil {
+		t.Fatal("Unexpected error entering directory: ", err)
+	}
+	if err := writer.PushDirectory("lib"); err != nil {
+		t.Fatal("Unexpected error entering directory: ", err)
+	}
+	if diff := cmp.Diff("llvm/lib", writer.CurrentDirectory()); diff != "" {
+		t.Error("Unexpected current directory:\n", diff)
+	}
+	if err := writer.WriteCommand("run", "name", "a.cc", "Support/b.cc", "../c.cc"); err != nil {
+		t.Fatal("Unexpected error writing command: ", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := writer.PopDirectory(); err != nil {
+			t.Fatal("Unexpected error exiting directory: ", err)
+		}
+	}
+	if err := writer.EndMacro(); err != nil {
+		t.Fatal("Unexpected error ending macro: ", err)
+	}
+	expected := "def hello_world(ctx):\n" +
+		"    ctx = ctx.push_directory(ctx, \"llvm\")\n" +
+		"    ctx = ctx.push_directory(ctx, \"lib\")\n" +
+		"    ctx.run(ctx, \"name\", \":a.cc\", \"//llvm/lib/Support:b.cc\", \"//llvm:c.cc\")\n" +
+		"    ctx = ctx.pop_directory(ctx)\n" +
+		"    ctx = ctx.pop_directory(ctx)\n" +
+		"    return ctx\n"
+	if diff := cmp.Diff(expected, b.String()); diff != "" {
+		t.Error("Unexpected writer output:\n", diff)
+	}
+}
+
+func TestWriteAlias(t *testing.T) {
+	var b strings.Builder
+	writer := NewStarlarkWriter(&b)
+	if err := writer.BeginMacro("hello_world"); err != nil {
+		t.Fatal("Unexpected error writing macro: ", err)
+	}
+	idents := NewIdentAllocator()
+	for _, name := range []string{"LLVMSupport", "llvm-tblgen"} {
+		if err := writer.WriteAlias(name, idents.Allocate(name)); err != nil {
+			t.Fatalf("Unexpected error writing alias for %s: %v", name, err)
+		}
+	}
+	if err := writer.WriteAlias("local", "//other/pkg:local"); err != nil {
+		t.Fatal("Unexpected error writing alias: ", err)
+	}
+	if err := writer.WriteAlias("pkg", "//pkg"); err != nil {
+		t.Fatal("Unexpected error writing alias: ", err)
+	}
+	for _, test := range [][2]string{{"", "a"}, {"a b", "a"}, {"a:b", "a"}, {"a/../b", "a"}, {"a", ""}, {"a", "//b:"}, {"a", "//b:c d"}} {
+		if err := writer.WriteAlias(test[0], test[1]); err == nil {
+			t.Errorf("Invalid alias %q of %q accepted", test[0], test[1])
+		}
+	}
+	if err := writer.EndMacro(); err != nil {
+		t.Fatal("Unexpected error ending macro: ", err)
+	}
+	// Only the renamed target is aliased.
+	expected := "def hello_world(ctx):\n" +
+		"    ctx.alias(ctx, name = \"llvm-tblgen\", actual = \":llvm_tblgen\")\n" +
+		"    ctx.alias(ctx, name = \"local\", actual = \"//other/pkg:local\")\n" +
+		"    ctx.alias(ctx, name = \"pkg\", actual = \"//pkg\")\n" +
+		"    return ctx\n"
+	if diff := cmp.Diff(expected, b.String()); diff != "" {
+		t.Error("Unexpected writer output:\n", diff)
+	}
+}
+
+func TestWriteFilegroup(t *testing.T) {
+	var b strings.Builder
+	writer := NewStarlarkWriter(&b)
+	if err := writer.BeginMacro("hello_world"); err != nil {
+		t.Fatal("Unexpected error writing macro: ", err)
+	}
+	if err := writer.WriteFilegroup("headers", []string{"b.h", "a.h", "include/c.h", "b.h", "a.h"}); err != nil {
+		t.Fatal("Unexpected error writing filegroup: ", err)
+	}
+	if err := writer.WriteFilegroup("empty", nil); err != nil {
+		t.Fatal("Unexpected error writing filegroup: ", err)
+	}
+	for _, name := range []string{"", "a b", "a:b", "../a"} {
+		if err := writer.WriteFilegroup(name, []string{"a.h"}); err == nil {
+			t.Errorf("Invalid filegroup name %q accepted", name)
+		}
+	}
+	if err := writer.EndMacro(); err != nil {
+		t.Fatal("Unexpected error ending macro: ", err)
+	}
+	expected := "def hello_world(ctx):\n" +
+		"    ctx.filegroup(ctx, name = \"headers\", srcs = [\"a.h\", \"b.h\", \"include/c.h\"])\n" +
+		"    ctx.filegroup(ctx, name = \"empty\", srcs = [])\n" +
+		"    return ctx\n"
+	if diff := cmp.Diff(expected, b.String()); diff != "" {
+		t.Error("Unexpected writer output:\n", diff)
+	}
+}
+
+func TestWriteExportsFiles(t *testing.T) {
+	var b strings.Builder
+	writer := NewStarlarkWriter(&b)
+	if err := writer.BeginMacro("hello_world"); err != nil {
+		t.Fatal("Unexpected error writing macro: ", err)
+	}
+	if err := writer.WriteExportsFiles([]string{"b.h", "a.h", "b.h"}, nil); err != nil {
+		t.Fatal("Unexpected error writing exports_files: ", err)
+	}
+	if err := writer.WriteExportsFiles([]string{"include/c.h"}, []string{"//clang:__pkg__", "//lldb:__subpackages__"}); err != nil {
+		t.Fatal("Unexpected error writing exports_files: ", err)
+	}
+	for _, test := range []struct {
+		files, visibility []string
+	}{
+		{nil, nil},
+		{[]string{"../a.h"}, nil},
+		{[]string{"a.h"}, []string{"//clang"}},
+		{[]string{"a.h"}, []string{PublicVisibility, "//clang:__pkg__"}},
+	} {
+		if err := writer.WriteExportsFiles(test.files, test.visibility); err == nil {
+			t.Errorf("Invalid exports_files(%q, %q) accepted", test.files, test.visibility)
+		}
+	}
+	if err := writer.EndMacro(); err != nil {
+		t.Fatal("Unexpected error ending macro: ", err)
+	}
+	expected := "def hello_world(ctx):\n" +
+		"    ctx.exports_files(ctx, [\"a.h\", \"b.h\"])\n" +
+		"    ctx.exports_files(ctx, [\"include/c.h\"], visibility = [\"//clang:__pkg__\", \"//lldb:__subpackages__\"])\n" +
+		"    return ctx\n"
+	if diff := cmp.Diff(expected, b.String()); diff != "" {
+		t.Error("Unexpected writer output:\n", diff)
+	}
+}
+
+func TestCommandKwargsOrder(t *testing.T) {
+	var b strings.Builder
+	writer := NewStarlarkWriter(&b)
+	if err := writer.BeginMacro("hello_world"); err != nil {
+		t.Fatal("Unexpected error writing macro: ", err)
+	}
+	kwargs := []Kwarg{{"name", "a"}, {"srcs", []string{"a.cc"}}, {"deps", []string{":b"}}, {"alwayslink", true}}
+	if err := writer.WriteCommandKwargs("cc_library", kwargs); err != nil {
+		t.Fatal("Unexpected error writing command: ", err)
+	}
+	if err := writer.WriteCommandKwargs("run", []Kwarg{{"z", 1}, {"a", 2}}, "arg"); err != nil {
+		t.Fatal("Unexpected error writing command: ", err)
+	}
+	if err := writer.WriteCommandKwargs("run", []Kwarg{{"a", 1}, {"b", 2}, {"a", 3}}); err == nil {
+		t.Error("Duplicate keyword argument accepted")
+	}
+	if err := writer.EndMacro(); err != nil {
+		t.Fatal("Unexpected error ending macro: ", err)
+	}
+	expected := "def hello_world(ctx):\n" +
+		"    ctx.cc_library(ctx, name = \"a\", srcs = [\"a.cc\"], deps = [\":b\"], alwayslink = True)\n" +
+		"    ctx.run(ctx, \"arg\", z = 1, a = 2)\n" +
+		"    return ctx\n"
+	if diff := cmp.Diff(expected, b.String()); diff != "" {
+		t.Error("Unexpected writer output:\n", diff)
+	}
+}
+
+func TestCaptureMacros(t *testing.T) {
+	var b strings.Builder
+	writer := NewStarlarkWriter(&b, CaptureMacros(true))
+	var macros []string
+	for _, name := range []string{"zeta", "alpha"} {
+		if err := writer.BeginMacro(name); err != nil {
+			t.Fatal("Unexpected error writing macro: ", err)
+		}
+		if err := writer.WriteCommand("run", name); err != nil {
+			t.Fatal("Unexpected error writing command: ", err)
+		}
+		if len(writer.Finish()) != 0 {
+			t.Error("Incomplete macro returned by Finish")
+		}
+		if err := writer.EndMacro(); err != nil {
+			t.Fatal("Unexpected error ending macro: ", err)
+		}
+		macros = append(macros, string(writer.Finish()))
+	}
+	if err := writer.Flush(); err != nil {
+		t.Fatal("Unexpected error flushing: ", err)
+	}
+	if b.Len() != 0 {
+		t.Errorf("Captured macros written to underlying writer: %q", b.String())
+	}
+
+	sort.Strings(macros)
+	expected := "def alpha(ctx):\n" +
+		"    ctx.run(ctx, \"alpha\")\n" +
+		"    return ctx\n" +
+		"def zeta(ctx):\n" +
+		"    ctx.run(ctx, \"zeta\")\n" +
+		"    return ctx\n"
+	if diff := cmp.Diff(expected, strings.Join(macros, "")); diff != "" {
+		t.Error("Unexpected captured macros:\n", diff)
+	}
+}
+
+func TestDirectoryComments(t *testing.T) {
+	for _, style := range []QuoteStyle{DoubleQuotes, SingleQuotes} {
+		var b strings.Builder
+		writer := NewStarlarkWriter(&b, DirectoryComments(true), Quotes(style))
+		if err := writer.BeginMacro("hello_world"); err != nil {
+			t.Fatal("Unexpected error writing macro: ", err)
+		}
+		if err := writer.PushDirectory(`it's "quoted"`); err != nil {
+			t.Fatal("Unexpected error entering directory: ", err)
+		}
+		if err := writer.WriteCommand("run"); err != nil {
+			t.Fatal("Unexpected error writing command: ", err)
+		}
+		if _, err := writer.PopDirectory(); err != nil {
+			t.Fatal("Unexpected error exiting directory: ", err)
+		}
+		if err := writer.EndMacro(); err != nil {
+			t.Fatal("Unexpected error ending macro: ", err)
+		}
+		quoted := `"it's \"quoted\""`
+		if style == SingleQuotes {
+			quoted = `'it\'s "quoted"'`
+		}
+		expected := "def hello_world(ctx):\n" +
+			"    ctx = ctx.push_directory(ctx, " + quoted + ")\n" +
+			"    ctx.run(ctx)\n" +
+			"    ctx = ctx.pop_directory(ctx)  # " + quoted + "\n" +
+			"    return ctx\n"
+		if diff := cmp.Diff(expected, b.String()); diff != "" {
+			t.Errorf("Unexpected writer output with quote style %v:\n%s", style, diff)
+		}
+	}
+}
+
+func TestWriteModuleDocstring(t *testing.T) {
+	var b strings.Builder
+	writer := NewStarlarkWriter(&b)
+	if err := writer.WriteModuleDocstring("Generated CMake targets.\n\nUses \"\"\"quotes\"\"\" and a \\ backslash, \"ending\""); err != nil {
+		t.Fatal("Unexpected error writing docstring: ", err)
+	}
+	if err := writer.WriteModuleDocstring("again"); err == nil {
+		t.Error("Second module docstring accepted")
+	}
+	if err := writer.WriteLoad("//bzl:cmake.bzl", "cmake_context"); err != nil {
+		t.Fatal("Unexpected error writing load: ", err)
+	}
+	if err := writer.BeginMacro("hello_world"); err != nil {
+		t.Fatal("Unexpected error writing macro: ", err)
+	}
+	if err := writer.EndMacro(); err != nil {
+		t.Fatal("Unexpected error ending macro: ", err)
+	}
+	expected := `"""Generated CMake targets.
+
+Uses \"\"\"quotes\"\"\" and a \\ backslash, "ending\""""
+load("//bzl:cmake.bzl", "cmake_context")
+def hello_world(ctx):
+    return ctx
+`
+	if diff := cmp.Diff(expected, b.String()); diff != "" {
+		t.Error("Unexpected writer output:\n", diff)
+	}
+}
+
+func TestModuleDocstringAfterLoad(t *testing.T) {
+	writer := NewStarlarkWriter(&strings.Builder{})
+	if err := writer.WriteLoad("//bzl:cmake.bzl", "cmake_context"); err != nil {
+		t.Fatal("Unexpected error writing load: ", err)
+	}
+	if err := writer.WriteModuleDocstring("too late"); err == nil {
+		t.Error("Module docstring accepted after a load statement")
+	}
+}
+
+func TestOnLine(t *testing.T) {
+	var b strings.Builder
+	writer := NewStarlarkWriter(&b, OnLine(func(line string) (string, bool) {
+		if strings.Contains(line, "dropped") {
+			return "", false
+		}
+		if line == "" {
+			return line, true
+		}
+		return "#> " + line, true
+	}))
+	if err := writer.WriteComment("header\n"); err != nil {
+		t.Fatal("Unexpected error writing comment: ", err)
+	}
+	if err := writer.BeginMacro("hello_world"); err != nil {
+		t.Fatal("Unexpected error writing macro: ", err)
+	}
+	if err := writer.BeginIf(Var("enabled")); err != nil {
+		t.Fatal("Unexpected error writing if: ", err)
+	}
+	if err := writer.WriteCommand("run", "dropped"); err != nil {
+		t.Fatal("Unexpected error writing command: ", err)
+	}
+	if err := writer.WriteCommand("run", Raw("[\n    1,\n]")); err != nil {
+		t.Fatal("Unexpected error writing command: ", err)
+	}
+	if err := writer.EndIf(); err != nil {
+		t.Fatal("Unexpected error ending if: ", err)
+	}
+	if err := writer.EndMacro(); err != nil {
+		t.Fatal("Unexpected error ending macro: ", err)
+	}
+	if err := writer.Flush(); err != nil {
+		t.Fatal("Unexpected error flushing writer: ", err)
+	}
+	expected := "#> # header\n" +
+		"#> #\n" +
+		"#> def hello_world(ctx):\n" +
+		"#>     if enabled:\n" +
+		"#>         ctx.run(ctx, [\n" +
+		"#>             1,\n" +
+		"#>         ])\n" +
+		"#>     return ctx\n"
+	if diff := cmp.Diff(expected, b.String()); diff != "" {
+		t.Error("Unexpected writer output:\n", diff)
+	}
+}
+
+func TestCompactMacros(t *testing.T) {
+	tests := []struct {
+		body     func(w *StarlarkWriter) error
+		expanded string
+		compact  string
+	}{
+		{func(w *StarlarkWriter) error { return w.WriteCommand("run", "a") },
+			"def hello_world(ctx):\n    ctx.run(ctx, \"a\")\n    return ctx\n",
+			"def hello_world(ctx): ctx.run(ctx, \"a\"); return ctx\n"},
+		{func(w *StarlarkWriter) error { return w.WriteReturn(Var("ctx")) },
+			"def hello_world(ctx):\n    return ctx\n",
+			"def hello_world(ctx): return ctx\n"},
+		{func(w *StarlarkWriter) error { return nil },
+			"def hello_world(ctx):\n    return ctx\n",
+			"def hello_world(ctx): return ctx\n"},
+		{func(w *StarlarkWriter) error {
+			if err := w.WriteCommand("run", "a"); err != nil {
+				return err
+			}
+			return w.WriteCommand("run", "b")
+		},
+			"def hello_world(ctx):\n    ctx.run(ctx, \"a\")\n    ctx.run(ctx, \"b\")\n    return ctx\n",
+			"def hello_world(ctx):\n    ctx.run(ctx, \"a\")\n    ctx.run(ctx, \"b\")\n    return ctx\n"},
+		{func(w *StarlarkWriter) error { return w.WriteComment("comment") },
+			"def hello_world(ctx):\n    # comment\n    return ctx\n",
+			"def hello_world(ctx):\n    # comment\n    return ctx\n"},
+		{func(w *StarlarkWriter) error { return w.WriteCommand("run", Raw("[\n    1,\n]")) },
+			"def hello_world(ctx):\n    ctx.run(ctx, [\n        1,\n    ])\n    return ctx\n",
+			"def hello_world(ctx):\n    ctx.run(ctx, [\n        1,\n    ])\n    return ctx\n"},
+	}
+	for _, test := range tests {
+		for _, compact := range []bool{false, true} {
+			var b strings.Builder
+			writer := NewStarlarkWriter(&b, CompactMacros(compact))
+			if err := writer.BeginMacro("hello_world"); err != nil {
+				t.Fatal("Unexpected error writing macro: ", err)
+			}
+			if err := test.body(writer); err != nil {
+				t.Fatal("Unexpected error writing macro body: ", err)
+			}
+			if err := writer.EndMacro(); err != nil {
+				t.Fatal("Unexpected error ending macro: ", err)
+			}
+			expected := test.expanded
+			if compact {
+				expected = test.compact
+			}
+			if diff := cmp.Diff(expected, b.String()); diff != "" {
+				t.Errorf("Unexpected writer output with CompactMacros(%v):\n%s", compact, diff)
+			}
+		}
+	}
+}
+
+func TestWritePrelude(t *testing.T) {
+	var b strings.Builder
+	writer := NewStarlarkWriter(&b)
+	if err := writer.WriteLoad("//tools:cmake.bzl", "cmake"); err != nil {
+		t.Fatal("Unexpected error writing load: ", err)
+	}
+	for _, name := range []string{"first", "second"} {
+		if err := writer.WritePreludeAssignment("_SRCS", []string{"a.cc", "b.cc"}); err != nil {
+			t.Fatal("Unexpected error writing prelude: ", err)
+		}
+		if err := writer.BeginMacro(name); err != nil {
+			t.Fatal("Unexpected error writing macro: ", err)
+		}
+		if err := writer.WriteCommand("run", Var("_SRCS")); err != nil {
+			t.Fatal("Unexpected error writing command: ", err)
+		}
+		if err := writer.EndMacro(); err != nil {
+			t.Fatal("Unexpected error ending macro: ", err)
+		}
+	}
+	if err := writer.WritePreludeAssignment("_SRCS", []string{"c.cc"}); err == nil {
+		t.Error("Conflicting prelude assignment accepted")
+	}
+	if err := writer.Flush(); err != nil {
+		t.Fatal("Unexpected error flushing writer: ", err)
+	}
+	expected := "load(\"//tools:cmake.bzl\", \"cmake\")\n" +
+		"_SRCS = [\"a.cc\", \"b.cc\"]\n" +
+		"def first(ctx):\n" +
+		"    ctx.run(ctx, _SRCS)\n" +
+		"    return ctx\n" +
+		"def second(ctx):\n" +
+		"    ctx.run(ctx, _SRCS)\n" +
+		"    return ctx\n"
+	if diff := cmp.Diff(expected, b.String()); diff != "" {
+		t.Error("Unexpected writer output:\n", diff)
+	}
+}
+
+func TestWriteWithoutMacro(t *testing.T) {
+	var b strings.Builder
+	writer := NewStarlarkWriter(&b, CaptureMacros(true))
+	if err := writer.WriteComment("Generated file.\nDo not edit."); err != nil {
+		t.Fatal("Unexpected error writing comment: ", err)
+	}
+	if err := writer.WriteLoad("//tools:cmake.bzl", "cmake"); err != nil {
+		t.Fatal("Unexpected error writing load: ", err)
+	}
+	if err := writer.Flush(); err != nil {
+		t.Fatal("Unexpected error flushing writer: ", err)
+	}
+	expected := "# Generated file.\n" +
+		"# Do not edit.\n" +
+		"load(\"//tools:cmake.bzl\", \"cmake\")\n"
+	if diff := cmp.Diff(expected, b.String()); diff != "" {
+		t.Error("Unexpected writer output:\n", diff)
+	}
+	if captured := writer.Finish(); len(captured) != 0 {
+		t.Errorf("Unexpected captured output: %q", captured)
+	}
+}
+
+func TestWriteCommentBeforeMacro(t *testing.T) {
+	var b strings.Builder
+	writer := NewStarlarkWriter(&b, HelperLoad("//bzl:cmake.bzl", "cmake_context"), CaptureMacros(true))
+	if err := writer.WritePreludeAssignment("VERSION", 17); err != nil {
+		t.Fatal("Unexpected error writing prelude: ", err)
+	}
+	if err := writer.WriteComment("Generated from llvm/lib/CMakeLists.txt"); err != nil {
+		t.Fatal("Unexpected error writing comment: ", err)
+	}
+	if err := writer.BeginMacro("llvm_lib"); err != nil {
+		t.Fatal("Unexpected error writing macro: ", err)
+	}
+	if err := writer.EndMacro(); err != nil {
+		t.Fatal("Unexpected error ending macro: ", err)
+	}
+	if err := writer.WriteComment("Trailing comment"); err != nil {
+		t.Fatal("Unexpected error writing comment: ", err)
+	}
+	if err := writer.Flush(); err != nil {
+		t.Fatal("Unexpected error flushing writer: ", err)
+	}
+	expected := "load(\"//bzl:cmake.bzl\", \"cmake_context\")\n" +
+		"VERSION = 17\n" +
+		"# Trailing comment\n"
+	if diff := cmp.Diff(expected, b.String()); diff != "" {
+		t.Error("Unexpected writer output:\n", diff)
+	}
+	expected = "# Generated from llvm/lib/CMakeLists.txt\n" +
+		"def llvm_lib(ctx):\n" +
+		"    return ctx\n"
+	if diff := cmp.Diff(expected, string(writer.Finish())); diff != "" {
+		t.Error("Unexpected captured output:\n", diff)
+	}
+}
+
+func TestSingleMacro(t *testing.T) {
+	var b strings.Builder
+	writer := NewStarlarkWriter(&b, SingleMacro("_generate"))
+	if err := writer.WriteComment("Generated file."); err != nil {
+		t.Fatal("Unexpected error writing comment: ", err)
+	}
+	for _, dir := range []string{"llvm", "clang"} {
+		if err := writer.PushDirectory(dir); err != nil {
+			t.Fatal("Unexpected error entering directory: ", err)
+		}
+		if err := writer.WriteCommand("add_library", dir+"_lib", dir+".cc"); err != nil {
+			t.Fatal("Unexpected error writing command: ", err)
+		}
+		if _, err := writer.PopDirectory(); err != nil {
+			t.Fatal("Unexpected error exiting directory: ", err)
+		}
+	}
+	if err := writer.BeginMacro("other"); err == nil {
+		t.Error("Explicit macro accepted with SingleMacro")
+	}
+	if err := writer.EndMacro(); err == nil {
+		t.Error("Explicit end of macro accepted with SingleMacro")
+	}
+	if err := writer.Flush(); err != nil {
+		t.Fatal("Unexpected error flushing writer: ", err)
+	}
+	expected := "# Generated file.\n" +
+		"def _generate(ctx):\n" +
+		"    ctx = ctx.push_directory(ctx, \"llvm\")\n" +
+		"    ctx.add_library(ctx, \"llvm_lib\", \"llvm.cc\")\n" +
+		"    ctx = ctx.pop_directory(ctx)\n" +
+		"    ctx = ctx.push_directory(ctx, \"clang\")\n" +
+		"    ctx.add_library(ctx, \"clang_lib\", \"clang.cc\")\n" +
+		"    ctx = ctx.pop_directory(ctx)\n" +
+		"    return ctx\n"
+	if diff := cmp.Diff(expected, b.String()); diff != "" {
+		t.Error("Unexpected writer output:\n", diff)
+	}
+}
+
+func TestContextName(t *testing.T) {
+	var b strings.Builder
+	writer := NewStarlarkWriter(&b, ContextName("state"))
+	if err := writer.BeginMacro("hello_world"); err != nil {
+		t.Fatal("Unexpected error writing macro: ", err)
+	}
+	if err := writer.PushDirectory("llvm"); err != nil {
+		t.Fatal("Unexpected error entering directory: ", err)
+	}
+	if err := writer.WriteCommand("run", "a"); err != nil {
+		t.Fatal("Unexpected error writing command: ", err)
+	}
+	if _, err := writer.PopDirectory(); err != nil {
+		t.Fatal("Unexpected error exiting directory: ", err)
+	}
+	if err := writer.EndMacro(); err != nil {
+		t.Fatal("Unexpected error ending macro: ", err)
+	}
+	expected := "def hello_world(state):\n" +
+		"    state = state.push_directory(state, \"llvm\")\n" +
+		"    state.run(state, \"a\")\n" +
+		"    state = state.pop_directory(state)\n" +
+		"    return state\n"
+	if diff := cmp.Diff(expected, b.String()); diff != "" {
+		t.Error("Unexpected writer output:\n", diff)
+	}
+
+	for _, name := range []string{"", "1ctx", "def", "a-b"} {
+		if err := NewStarlarkWriter(&b, ContextName(name)).BeginMacro("hello_world"); err == nil {
+			t.Errorf("Invalid context name %q accepted", name)
+		}
+	}
+}
+
+func TestBufferedStarlarkWriter(t *testing.T) {
+	writer := NewBufferedStarlarkWriter(Quotes(SingleQuotes))
+	if err := writer.BeginMacro("hello_world"); err != nil {
+		t.Fatal("Unexpected error writing macro: ", err)
+	}
+	if err := writer.WriteCommand("run", "a"); err != nil {
+		t.Fatal("Unexpected error writing command: ", err)
+	}
+	if diff := cmp.Diff("def hello_world(ctx):\n    ctx.run(ctx, 'a')\n", writer.String()); diff != "" {
+		t.Error("Unexpected partial output:\n", diff)
+	}
+	if err := writer.EndMacro(); err != nil {
+		t.Fatal("Unexpected error ending macro: ", err)
+	}
+	expected := "def hello_world(ctx):\n" +
+		"    ctx.run(ctx, 'a')\n" +
+		"    return ctx\n"
+	if diff := cmp.Diff(expected, writer.String()); diff != "" {
+		t.Error("Unexpected writer output:\n", diff)
+	}
+	if diff := cmp.Diff(expected, string(writer.Bytes())); diff != "" {
+		t.Error("Unexpected writer bytes:\n", diff)
+	}
+	var b strings.Builder
+	if n, err := writer.WriteTo(&b); err != nil || n != int64(len(expected)) {
+		t.Errorf("WriteTo returned %d, %v; expected %d, nil", n, err, len(expected))
+	}
+	if diff := cmp.Diff(expected, b.String()); diff != "" {
+		t.Error("Unexpected WriteTo output:\n", diff)
+	}
+}
+
+func TestLambdaMacros(t *testing.T) {
+	var b strings.Builder
+	writer := NewStarlarkWriter(&b, DeclareMacros(LambdaMacros))
+	if err := writer.BeginMacroParams("run_a", Param{Name: "srcs", Default: []string{}}); err != nil {
+		t.Fatal("Unexpected error writing macro: ", err)
+	}
+	if err := writer.WriteCommand("run", "a", Var("srcs")); err != nil {
+		t.Fatal("Unexpected error writing command: ", err)
+	}
+	if err := writer.WriteCommand("run", "b"); err == nil {
+		t.Error("Second statement accepted in lambda macro")
+	}
+	if err := writer.EndMacro(); err != nil {
+		t.Fatal("Unexpected error ending macro: ", err)
+	}
+	for _, name := range []string{"empty", "none", "value"} {
+		if err := writer.BeginMacro(name); err != nil {
+			t.Fatal("Unexpected error writing macro: ", err)
+		}
+		switch name {
+		case "none":
+			if err := writer.WriteReturn(nil); err != nil {
+				t.Fatal("Unexpected error writing return: ", err)
+			}
+		case "value":
+			if err := writer.WriteReturn(List{"a", 1}); err != nil {
+				t.Fatal("Unexpected error writing return: ", err)
+			}
+		}
+		if err := writer.EndMacro(); err != nil {
+			t.Fatal("Unexpected error ending macro: ", err)
+		}
+	}
+	expected := "run_a = lambda ctx, srcs = []: ctx.run(ctx, \"a\", srcs)\n" +
+		"empty = lambda ctx: ctx\n" +
+		"none = lambda ctx: None\n" +
+		"value = lambda ctx: [\"a\", 1]\n"
+	if diff := cmp.Diff(expected, b.String()); diff != "" {
+		t.Error("Unexpected writer output:\n", diff)
+	}
+}
+
+func TestLambdaMacroStatements(t *testing.T) {
+	tests := map[string]func(w *StarlarkWriter) error{
+		"assignment": func(w *StarlarkWriter) error { return w.WriteAssignment("x", 1) },
+		"if":         func(w *StarlarkWriter) error { return w.BeginIf(true) },
+		"for":        func(w *StarlarkWriter) error { return w.BeginFor("x", List{}) },
+		"directory":  func(w *StarlarkWriter) error { return w.PushDirectory("a") },
+		"comment":    func(w *StarlarkWriter) error { return w.WriteComment("a") },
+	}
+	for name, write := range tests {
+		writer := NewStarlarkWriter(&strings.Builder{}, DeclareMacros(LambdaMacros))
+		if err := writer.BeginMacro("hello_world"); err != nil {
+			t.Fatal("Unexpected error writing macro: ", err)
+		}
+		if err := write(writer); err == nil {
+			t.Errorf("Unexpected success writing %s in lambda macro", name)
+		}
+	}
+}
+
+func TestCollectErrors(t *testing.T) {
+	var b strings.Builder
+	writer := NewStarlarkWriter(&b, CollectErrors(true), Signatures(map[string]CommandSignature{
+		"cc_library": {Required: []string{"name"}},
+	}))
+	if err := writer.BeginMacro("hello_world"); err != nil {
+		t.Fatal("Unexpected error writing macro: ", err)
+	}
+	writes := []error{
+		writer.WriteCommand("not valid"),
+		writer.WriteCommand("run", "a"),
+		writer.WriteCommandKw("cc_library", map[string]interface{}{}),
+		writer.WriteAssignment("also not valid", 1),
+		writer.EndIf(),
+		writer.BeginIf(true),
+		writer.WriteCommand("run", make(chan int)),
+	}
+	if _, err := writer.PopDirectory(); err != nil {
+		t.Error("Unexpected error exiting directory: ", err)
+	}
+	for _, err := range writes {
+		if err != nil {
+			t.Error("Unexpected error while collecting errors: ", err)
+		}
+	}
+	if err := writer.EndMacro(); err != nil {
+		t.Fatal("Unexpected error ending macro: ", err)
+	}
+	var actual []string
+	for _, err := range writer.Errors() {
+		actual = append(actual, err.Error())
+	}
+	expected := []string{
+		"invalid Starlark identifier: not valid",
+		`invalid arguments to cc_library: missing required keyword argument "name"`,
+		"invalid Starlark identifier: also not valid",
+		"endif without matching if",
+		"unsupported type: chan int",
+		"no current directory",
+		"unclosed if block in macro hello_world",
+	}
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Error("Unexpected errors:\n", diff)
+	}
+	if !strings.Contains(b.String(), "    ctx.run(ctx, \"a\")\n") {
+		t.Errorf("Valid command missing from output:\n%s", b.String())
+	}
+}
+
+func TestWrapValues(t *testing.T) {
+	var b strings.Builder
+	writer := NewStarlarkWriter(&b, WrapValues(true))
+	if err := writer.BeginMacro("hello_world"); err != nil {
+		t.Fatal("Unexpected error writing macro: ", err)
+	}
+	if err := writer.BeginIf(Var("enabled")); err != nil {
+		t.Fatal("Unexpected error beginning if: ", err)
+	}
+	if err := writer.WriteCommandKwargs("cc_library", []Kwarg{{"name", "a"}, {"srcs", []string{"a.cc", "b.cc"}}, {"deps", []string{}}}); err != nil {
+		t.Fatal("Unexpected error writing command: ", err)
+	}
+	if err := writer.EndIf(); err != nil {
+		t.Fatal("Unexpected error ending if: ", err)
+	}
+	if err := writer.EndMacro(); err != nil {
+		t.Fatal("Unexpected error ending macro: ", err)
+	}
+	expected := `def hello_world(ctx):
+    if enabled:
+        ctx.cc_library(ctx, name = "a", srcs = [
+            "a.cc",
+            "b.cc",
+        ], deps = [])
+    return ctx
+`
+	if diff := cmp.Diff(expected, b.String()); diff != "" {
+		t.Error("Unexpected writer output:\n", diff)
+	}
+}
+
+func TestCommandCounts(t *testing.T) {
+	writer := NewStarlarkWriter(&strings.Builder{}, CountCommands(true))
+	if err := writer.BeginMacro("hello_world"); err != nil {
+		t.Fatal("Unexpected error writing macro: ", err)
+	}
+	for _, cmd := range []string{"cc_library", "filegroup", "cc_library", "cc_library"} {
+		if err := writer.WriteCommandKw(cmd, map[string]interface{}{"name": "a"}); err != nil {
+			t.Fatal("Unexpected error writing command: ", err)
+		}
+	}
+	if err := writer.WriteCommand("not valid"); err == nil {
+		t.Error("Invalid command accepted")
+	}
+	if err := writer.EndMacro(); err != nil {
+		t.Fatal("Unexpected error ending macro: ", err)
+	}
+	if diff := cmp.Diff(map[string]int{"cc_library": 3, "filegroup": 1}, writer.CommandCounts()); diff != "" {
+		t.Error("Unexpected command counts:\n", diff)
+	}
+
+	if counts := NewStarlarkWriter(&strings.Builder{}).CommandCounts(); len(counts) != 0 {
+		t.Errorf("Unexpected command counts without CountCommands: %v", counts)
+	}
+}
@@ -0,0 +1,138 @@
+/*
+ * Copyright 2019 The Kythe Authors. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package writer
+
+import "sync"
+
+// SyncWriter is a MacroWriter which guards another with a mutex, making it safe
+// for concurrent use. Each call is written atomically, but the order of concurrent
+// calls is nondeterministic unless coordinated by the caller; SyncWriter
+// provides safety, not ordering.
+type SyncWriter struct {
+	mu sync.Mutex
+	w  MacroWriter
+}
+
+// NewSyncWriter returns a new SyncWriter guarding w.
+func NewSyncWriter(w MacroWriter) *SyncWriter {
+	return &SyncWriter{w: w}
+}
+
+// WriteLoad implements MacroWriter.
+func (s *SyncWriter) WriteLoad(file string, symbols ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.WriteLoad(file, symbols...)
+}
+
+// BeginMacro implements MacroWriter.
+func (s *SyncWriter) BeginMacro(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.BeginMacro(name)
+}
+
+// EndMacro implements MacroWriter.
+func (s *SyncWriter) EndMacro() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.EndMacro()
+}
+
+// BeginIf implements MacroWriter.
+func (s *SyncWriter) BeginIf(cond interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.BeginIf(cond)
+}
+
+// ElseIf implements MacroWriter.
+func (s *SyncWriter) ElseIf(cond interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.ElseIf(cond)
+}
+
+// Else implements MacroWriter.
+func (s *SyncWriter) Else() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Else()
+}
+
+// EndIf implements MacroWriter.
+func (s *SyncWriter) EndIf() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.EndIf()
+}
+
+// BeginFor implements MacroWriter.
+func (s *SyncWriter) BeginFor(name string, iterable interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.BeginFor(name, iterable)
+}
+
+// EndFor implements MacroWriter.
+func (s *SyncWriter) EndFor() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.EndFor()
+}
+
+// PushDirectory implements MacroWriter.
+func (s *SyncWriter) PushDirectory(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.PushDirectory(path)
+}
+
+// PopDirectory implements MacroWriter.
+func (s *SyncWriter) PopDirectory() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.PopDirectory()
+}
+
+// WriteCommand implements MacroWriter.
+func (s *SyncWriter) WriteCommand(cmd string, args ...interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.WriteCommand(cmd, args...)
+}
+
+// WriteCommandKw implements MacroWriter.
+func (s *SyncWriter) WriteCommandKw(cmd string, kwargs map[string]interface{}, args ...interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.WriteCommandKw(cmd, kwargs, args...)
+}
+
+// WriteAssignment implements MacroWriter.
+func (s *SyncWriter) WriteAssignment(name string, value interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.WriteAssignment(name, value)
+}
+
+// Flush implements MacroWriter.
+func (s *SyncWriter) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Flush()
+}
@@ -0,0 +1,69 @@
+/*
+ * Copyright 2019 The Kythe Authors. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package writer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSyncWriter(t *testing.T) {
+	const goroutines, commands = 16, 100
+	var b strings.Builder
+	writer := NewSyncWriter(NewStarlarkWriter(&b))
+	if err := writer.BeginMacro("hello_world"); err != nil {
+		t.Fatal("Unexpected error writing macro: ", err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < commands; j++ {
+				if err := writer.WriteCommand("run", fmt.Sprintf("%d-%d", i, j)); err != nil {
+					t.Error("Unexpected error writing command: ", err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if err := writer.EndMacro(); err != nil {
+		t.Fatal("Unexpected error ending macro: ", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	if len(lines) != goroutines*commands+2 {
+		t.Fatalf("Unexpected line count: %d", len(lines))
+	}
+	var expected []string
+	for i := 0; i < goroutines; i++ {
+		for j := 0; j < commands; j++ {
+			expected = append(expected, fmt.Sprintf("    ctx.run(ctx, \"%d-%d\")", i, j))
+		}
+	}
+	actual := lines[1 : len(lines)-1]
+	sort.Strings(expected)
+	sort.Strings(actual)
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Error("Unexpected commands:\n", diff)
+	}
+}
@@ -0,0 +1,395 @@
+/*
+ * Copyright 2019 The Kythe Authors. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package writer
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Raw is a literal Starlark expression which is written verbatim.
+type Raw string
+
+// MarshalStarlark implements Marshaler.
+func (r Raw) MarshalStarlark() ([]byte, error) {
+	return []byte(r), nil
+}
+
+// Var is a reference to a Starlark variable, written as a bare identifier.
+type Var string
+
+// MarshalStarlark implements Marshaler.
+func (v Var) MarshalStarlark() ([]byte, error) {
+	name, err := identName(string(v))
+	if err != nil {
+		return nil, err
+	}
+	return []byte(name), nil
+}
+
+// Concat is a sequence of values joined with the + operator, such as when building paths.
+// Each element is marshaled in turn and the whole expression is parenthesized
+// so that it may be safely nested within a larger expression.
+type Concat []interface{}
+
+// MarshalStarlark implements Marshaler.
+func (c Concat) MarshalStarlark() ([]byte, error) {
+	return c.marshalStarlark(MarshalOptions{})
+}
+
+func (c Concat) marshalStarlark(o MarshalOptions) ([]byte, error) {
+	if len(c) == 0 {
+		return o.Marshal("")
+	}
+	terms := make([]string, len(c))
+	for i, v := range c {
+		val, err := o.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		terms[i] = string(val)
+	}
+	return []byte("(" + strings.Join(terms, " + ") + ")"), nil
+}
+
+// List is a sequence of values which is always written as a Starlark list,
+// formatted according to the marshal options in use.
+type List []interface{}
+
+// MarshalStarlark implements Marshaler.
+func (l List) MarshalStarlark() ([]byte, error) {
+	return l.marshalStarlark(MarshalOptions{})
+}
+
+func (l List) marshalStarlark(o MarshalOptions) ([]byte, error) {
+	if l == nil {
+		return []byte("[]"), nil
+	}
+	return o.Marshal([]interface{}(l))
+}
+
+// SortedSet is a list of strings which is written sorted and without duplicates,
+// such as a list of dependencies accumulated from several sources.
+type SortedSet []string
+
+// MarshalStarlark implements Marshaler.
+func (ss SortedSet) MarshalStarlark() ([]byte, error) {
+	return ss.marshalStarlark(MarshalOptions{})
+}
+
+func (ss SortedSet) marshalStarlark(o MarshalOptions) ([]byte, error) {
+	sorted := sortedStrings(ss)
+	unique := sorted[:0]
+	for i, s := range sorted {
+		if i == 0 || s != sorted[i-1] {
+			unique = append(unique, s)
+		}
+	}
+	return o.Marshal(unique)
+}
+
+// Tuple is a sequence of values written as a Starlark tuple.
+type Tuple []interface{}
+
+// MarshalStarlark implements Marshaler.
+func (t Tuple) MarshalStarlark() ([]byte, error) {
+	return t.marshalStarlark(MarshalOptions{})
+}
+
+func (t Tuple) marshalStarlark(o MarshalOptions) ([]byte, error) {
+	elems := make([]string, len(t))
+	for i, v := range t {
+		val, err := o.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		elems[i] = string(val)
+	}
+	if len(elems) == 1 {
+		// A single-element tuple requires a trailing comma to distinguish it from a parenthesized expression.
+		return []byte("(" + elems[0] + ",)"), nil
+	}
+	return []byte("(" + strings.Join(elems, ", ") + ")"), nil
+}
+
+// ListFormat controls the formatting of a FormattedList.
+type ListFormat struct {
+	Multiline     bool // If true, each element is written on its own line, followed by a comma.
+	TrailingComma bool // If true, a comma follows the final element of a single-line list.
+}
+
+// FormattedList is a List written with a specific format, regardless of the marshal options in use.
+type FormattedList struct {
+	List   List
+	Format ListFormat
+}
+
+// MarshalStarlark implements Marshaler.
+func (fl FormattedList) MarshalStarlark() ([]byte, error) {
+	return fl.marshalStarlark(MarshalOptions{})
+}
+
+func (fl FormattedList) marshalStarlark(o MarshalOptions) ([]byte, error) {
+	if len(fl.List) == 0 {
+		return []byte("[]"), nil
+	}
+	indent := o.Indent
+	if indent == "" {
+		indent = "    "
+	}
+	elems := make([]string, len(fl.List))
+	for i, v := range fl.List {
+		val, err := o.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		elems[i] = string(val)
+	}
+	if fl.Format.Multiline {
+		var b strings.Builder
+		b.WriteString("[\n")
+		for _, e := range elems {
+			b.WriteString(indent + strings.Replace(e, "\n", "\n"+indent, -1) + ",\n")
+		}
+		b.WriteString("]")
+		return []byte(b.String()), nil
+	}
+	text := "[" + strings.Join(elems, ", ")
+	if fl.Format.TrailingComma {
+		text += ","
+	}
+	return []byte(text + "]"), nil
+}
+
+// QuotedIdent is an identifier which must be written as a quoted string,
+// such as a symbol named in a load statement.
+type QuotedIdent string
+
+// MarshalStarlark implements Marshaler.
+func (qi QuotedIdent) MarshalStarlark() ([]byte, error) {
+	return qi.marshalStarlark(MarshalOptions{})
+}
+
+func (qi QuotedIdent) marshalStarlark(o MarshalOptions) ([]byte, error) {
+	if !validIdentPattern.MatchString(string(qi)) || starlarkReserved.Contains(string(qi)) {
+		return nil, fmt.Errorf("invalid Starlark identifier: %s", string(qi))
+	}
+	return o.Marshal(string(qi))
+}
+
+// Struct is a set of named fields written as a call to the Starlark struct constructor.
+// Field names are written as bare identifiers, in sorted order.
+type Struct map[string]interface{}
+
+// MarshalStarlark implements Marshaler.
+func (s Struct) MarshalStarlark() ([]byte, error) {
+	return s.marshalStarlark(MarshalOptions{})
+}
+
+func (s Struct) marshalStarlark(o MarshalOptions) ([]byte, error) {
+	keys := make([]string, 0, len(s))
+	for k := range s {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	fields := make([]string, len(keys))
+	for i, k := range keys {
+		name, err := identName(k)
+		if err != nil {
+			return nil, err
+		}
+		val, err := o.Marshal(s[k])
+		if err != nil {
+			return nil, err
+		}
+		fields[i] = fmt.Sprintf("%s = %s", name, val)
+	}
+	return []byte("struct(" + strings.Join(fields, ", ") + ")"), nil
+}
+
+// DictEntry is a single entry of an AnnotatedDict.
+type DictEntry struct {
+	Key     interface{}
+	Value   interface{}
+	Comment string // If non-empty, written at the end of the entry's line.
+}
+
+// AnnotatedDict is a dict whose entries may each carry a comment, written in the order given.
+// As comments can only be written when each entry is on its own line, marshaling
+// an AnnotatedDict containing comments without an Indent is an error.
+type AnnotatedDict []DictEntry
+
+// MarshalStarlark implements Marshaler.
+func (d AnnotatedDict) MarshalStarlark() ([]byte, error) {
+	return d.marshalStarlark(MarshalOptions{})
+}
+
+func (d AnnotatedDict) marshalStarlark(o MarshalOptions) ([]byte, error) {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, e := range d {
+		if strings.Contains(e.Comment, "\n") {
+			return nil, fmt.Errorf("multi-line comment on dict entry: %#v", e.Comment)
+		}
+		key, err := o.Marshal(e.Key)
+		if err != nil {
+			return nil, err
+		}
+		val, err := o.Marshal(e.Value)
+		if err != nil {
+			return nil, err
+		}
+		if o.Indent == "" {
+			if e.Comment != "" {
+				return nil, fmt.Errorf("comment on dict entry %s requires an indented encoding", key)
+			}
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			fmt.Fprintf(&b, "%s: %s", key, val)
+			continue
+		}
+		entry := fmt.Sprintf("%s: %s", key, val)
+		b.WriteString("\n" + o.Indent + strings.Replace(entry, "\n", "\n"+o.Indent, -1) + ",")
+		if e.Comment != "" {
+			b.WriteString("  # " + e.Comment)
+		}
+	}
+	if o.Indent != "" && len(d) > 0 {
+		b.WriteByte('\n')
+	}
+	b.WriteByte('}')
+	return []byte(b.String()), nil
+}
+
+// DefaultCondition is the condition label which matches any configuration in a Select.
+const DefaultCondition = "//conditions:default"
+
+// Select is a mapping from configuration condition labels to values, written as a call to
+// the Starlark select function. Conditions are written in sorted order, as are the entries
+// of any dicts nested within the values.
+type Select map[string]interface{}
+
+// MarshalStarlark implements Marshaler.
+func (s Select) MarshalStarlark() ([]byte, error) {
+	return s.marshalStarlark(MarshalOptions{})
+}
+
+func (s Select) marshalStarlark(o MarshalOptions) ([]byte, error) {
+	if _, ok := s[DefaultCondition]; !ok && o.RequireSelectDefault {
+		return nil, fmt.Errorf("select without %s", DefaultCondition)
+	}
+	dict, err := o.Marshal(map[string]interface{}(s))
+	if err != nil {
+		return nil, err
+	}
+	return []byte("select(" + string(dict) + ")"), nil
+}
+
+// ListPlusSelect is a list of values followed by a Select of additional values,
+// written as [...] + select({...}), such as for configuration-dependent copts.
+// An empty Base or Select is omitted.
+type ListPlusSelect struct {
+	Base   []interface{}
+	Select Select
+}
+
+// MarshalStarlark implements Marshaler.
+func (ls ListPlusSelect) MarshalStarlark() ([]byte, error) {
+	return ls.marshalStarlark(MarshalOptions{})
+}
+
+func (ls ListPlusSelect) marshalStarlark(o MarshalOptions) ([]byte, error) {
+	switch {
+	case len(ls.Select) == 0:
+		return List(ls.Base).marshalStarlark(o)
+	case len(ls.Base) == 0:
+		return ls.Select.marshalStarlark(o)
+	}
+	return BinOp{Op: "+", X: List(ls.Base), Y: ls.Select}.marshalStarlark(o)
+}
+
+// Glob is a call to the Starlark glob function, with the patterns written in sorted order.
+// Exclude and AllowEmpty are written in that order as keyword arguments, and omitted when empty or false.
+type Glob struct {
+	Include    []string
+	Exclude    []string
+	AllowEmpty bool
+}
+
+// MarshalStarlark implements Marshaler.
+func (g Glob) MarshalStarlark() ([]byte, error) {
+	return g.marshalStarlark(MarshalOptions{})
+}
+
+func (g Glob) marshalStarlark(o MarshalOptions) ([]byte, error) {
+	args := []Expr{sortedStrings(g.Include)}
+	if len(g.Exclude) > 0 {
+		args = append(args, keywordArg{"exclude", sortedStrings(g.Exclude)})
+	}
+	if g.AllowEmpty {
+		args = append(args, keywordArg{"allow_empty", true})
+	}
+	return Call{Func: Var("glob"), Args: args}.marshalStarlark(o)
+}
+
+// Constants defining the visibility labels with special meaning.
+const (
+	PublicVisibility  = "//visibility:public"
+	PrivateVisibility = "//visibility:private"
+)
+
+// visibilityPattern matches the package specifications permitted in a Visibility,
+// other than the public and private visibility labels.
+var visibilityPattern = regexp.MustCompile(`^((@[\w.~-]*)?//([\w.+-]+(/[\w.+-]+)*)?)?:__(pkg|subpackages)__$`)
+
+// Visibility is the value of a visibility attribute, written as a sorted list of labels without duplicates.
+// Each label must be PublicVisibility, PrivateVisibility, or name a package or package tree as
+// "//pkg:__pkg__" or "//pkg:__subpackages__", optionally with a repository, or ":__pkg__" for the
+// current package. The public and private visibility labels may not be combined with any others.
+type Visibility []string
+
+// MarshalStarlark implements Marshaler.
+func (v Visibility) MarshalStarlark() ([]byte, error) {
+	return v.marshalStarlark(MarshalOptions{})
+}
+
+func (v Visibility) marshalStarlark(o MarshalOptions) ([]byte, error) {
+	for _, label := range v {
+		switch {
+		case label == PublicVisibility || label == PrivateVisibility:
+			for _, other := range v {
+				if other != label {
+					return nil, fmt.Errorf("visibility %s may not be combined with %s", label, other)
+				}
+			}
+		case !visibilityPattern.MatchString(label):
+			return nil, fmt.Errorf("invalid visibility label %q: must be %s, %s, or a package specification ending in :__pkg__ or :__subpackages__",
+				label, PublicVisibility, PrivateVisibility)
+		}
+	}
+	return SortedSet(v).marshalStarlark(o)
+}
+
+// sortedStrings returns a sorted copy of ss, which is never nil.
+func sortedStrings(ss []string) []string {
+	sorted := append([]string{}, ss...)
+	sort.Strings(sorted)
+	return sorted
+}